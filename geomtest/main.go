@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/wizgrao/simple3d/graphics"
 	"image"
-	"image/color"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
@@ -62,12 +61,8 @@ func main() {
 	imfile.Close()
 
 	im := image.NewRGBA(image.Rect(0, 0, *size, *size))
-	bg := &color.RGBA{0, 0, 0, 255}
-	for i := 0; i < *size; i++ {
-		for j := 0; j < *size; j++ {
-			im.Set(i, j, bg)
-		}
-	}
+	bg := &graphics.Color{0, 0, 0, 255}
+	graphics.DrawBackground(im, &graphics.SolidEnvironment{bg})
 	triangles := graphics.ImgSphere(*inputSize, textureIm)
 
 	lit1 := &graphics.DirectionLight{
@@ -0,0 +1,313 @@
+package graphics
+
+import (
+	"math"
+	"sort"
+)
+
+// OrientedBounds is a box turned to fit what it bounds. Axes are its unit
+// axes and Extents how far it reaches from Center along each.
+type OrientedBounds struct {
+	Center  *Vector3
+	Axes    [3]*Vector3
+	Extents [3]float64
+}
+
+// Volume returns the volume of b.
+func (b *OrientedBounds) Volume() float64 {
+	return 8 * b.Extents[0] * b.Extents[1] * b.Extents[2]
+}
+
+// Corners returns the eight corners of b.
+func (b *OrientedBounds) Corners() []*Vector3 {
+	var ret []*Vector3
+	for k := 0; k < 8; k++ {
+		p := b.Center
+		for a, axis := range b.Axes {
+			s := b.Extents[a]
+			if k>>uint(a)&1 == 1 {
+				s = -s
+			}
+			p = p.Add(axis.Scale(s))
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// Fit returns the transform that centers b on the origin and scales it
+// uniformly to fit in a cube of side size, so Fit(1) fits the unit box.
+func (b *Bounds) Fit(size float64) *Mat4 {
+	d := b.Max.Sub(b.Min)
+	c := b.Center()
+	ret := Translate(-c.X, -c.Y, -c.Z)
+	if longest := max3(d.X, d.Y, d.Z); longest > 0 {
+		ret = Scale(size / longest).Mult(ret)
+	}
+	return ret
+}
+
+// face returns the points of the i-th face of m.
+func (m *Mesh) face(i int) (a, b, c *Vector3) {
+	f := m.Face(i)
+	return m.Positions[f[0]], m.Positions[f[1]], m.Positions[f[2]]
+}
+
+// Area returns the surface area of m.
+func (m *Mesh) Area() float64 {
+	sum := 0.0
+	for i := 0; i < m.NumFaces(); i++ {
+		a, b, c := m.face(i)
+		sum += Cross(b.Sub(a), c.Sub(a)).Norm() / 2
+	}
+	return sum
+}
+
+// Volume returns the volume m encloses, positive when its faces are wound
+// outward as those of Cube are and negative when they are wound inward. It
+// is only meaningful for a watertight mesh.
+func (m *Mesh) Volume() float64 {
+	sum := 0.0
+	for i := 0; i < m.NumFaces(); i++ {
+		a, b, c := m.face(i)
+		sum += a.Dot(Cross(b, c)) / 6
+	}
+	return sum
+}
+
+// Centroid returns the center of mass of the solid m encloses, or of its
+// surface when it encloses nothing, as for an open or flat mesh.
+func (m *Mesh) Centroid() *Vector3 {
+	volume, area := 0.0, 0.0
+	byVolume, byArea := &Vector3{}, &Vector3{}
+	for i := 0; i < m.NumFaces(); i++ {
+		a, b, c := m.face(i)
+		// Each face makes a tetrahedron with the origin, its center a
+		// quarter of the way from the origin to the sum of its corners.
+		v := a.Dot(Cross(b, c)) / 6
+		s := Cross(b.Sub(a), c.Sub(a)).Norm() / 2
+		sum := a.Add(b).Add(c)
+		byVolume = byVolume.Add(sum.Scale(v / 4))
+		byArea = byArea.Add(sum.Scale(s / 3))
+		volume += v
+		area += s
+	}
+	if !m.Watertight() || math.Abs(volume) <= 1e-12*area*math.Sqrt(area) {
+		if area == 0 {
+			return m.Bounds().Center()
+		}
+		return byArea.Scale(1 / area)
+	}
+	return byVolume.Scale(1 / volume)
+}
+
+// BoundingSphere returns a sphere around every position of m, by Ritter's
+// method: no more than a few percent larger than the smallest.
+func (m *Mesh) BoundingSphere() (center *Vector3, radius float64) {
+	if len(m.Positions) == 0 {
+		return &Vector3{}, 0
+	}
+	farthest := func(from *Vector3) *Vector3 {
+		ret, best := from, 0.0
+		for _, p := range m.Positions {
+			if d := p.Sub(from).Norm(); d > best {
+				ret, best = p, d
+			}
+		}
+		return ret
+	}
+	a := farthest(m.Positions[0])
+	b := farthest(a)
+	center, radius = a.Add(b).Scale(.5), a.Sub(b).Norm()/2
+	for _, p := range m.Positions {
+		if d := p.Sub(center).Norm(); d > radius {
+			// Grow just enough to take in p, keeping the far side put.
+			radius = (radius + d) / 2
+			center = p.Add(center.Sub(p).Scale(radius / d))
+		}
+	}
+	return center, radius
+}
+
+// OrientedBounds returns a small box around m, which fits much tighter than
+// Bounds around a turned model. It tries the principal axes of the surface
+// of m, the axes of the scene and the frames of the sides of its largest
+// faces, and keeps whichever box is smallest.
+func (m *Mesh) OrientedBounds() *OrientedBounds {
+	if len(m.Positions) == 0 {
+		return nil
+	}
+	candidates := [][3]*Vector3{
+		m.principalAxes(),
+		{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}},
+	}
+	// Flat sided models are best boxed along their faces, and the principal
+	// axes of a cube could be any.
+	faces := make([]int, m.NumFaces())
+	for i := range faces {
+		faces[i] = i
+	}
+	area := func(i int) float64 {
+		a, b, c := m.face(i)
+		return Cross(b.Sub(a), c.Sub(a)).Norm()
+	}
+	sort.SliceStable(faces, func(i, j int) bool { return area(faces[i]) > area(faces[j]) })
+	for _, i := range faces[:mini(len(faces), 16)] {
+		a, b, c := m.face(i)
+		n := Cross(b.Sub(a), c.Sub(a))
+		if n.Norm() == 0 {
+			continue
+		}
+		// Along the normal and each side of the face.
+		z := n.Normalize()
+		for _, side := range []*Vector3{b.Sub(a), c.Sub(b), a.Sub(c)} {
+			x := side.Normalize()
+			candidates = append(candidates, [3]*Vector3{x, Cross(z, x), z})
+		}
+	}
+
+	var ret *OrientedBounds
+	for _, axes := range candidates {
+		b := &OrientedBounds{Center: &Vector3{}, Axes: axes}
+		for a, axis := range axes {
+			lo, hi := math.Inf(1), math.Inf(-1)
+			for _, p := range m.Positions {
+				d := p.Dot(axis)
+				lo, hi = math.Min(lo, d), math.Max(hi, d)
+			}
+			b.Center = b.Center.Add(axis.Scale((lo + hi) / 2))
+			b.Extents[a] = (hi - lo) / 2
+		}
+		if ret == nil || b.Volume() < ret.Volume() {
+			ret = b
+		}
+	}
+	return ret
+}
+
+// principalAxes returns the principal axes of the surface of m, each face
+// weighing by its area, or of its positions when it has no area.
+func (m *Mesh) principalAxes() [3]*Vector3 {
+	var moment [3][3]float64
+	total := 0.0
+	mean := &Vector3{}
+	add := func(p *Vector3, w float64) {
+		v := [3]float64{p.X, p.Y, p.Z}
+		for i := range v {
+			for j := range v {
+				moment[i][j] += w * v[i] * v[j]
+			}
+		}
+	}
+	for i := 0; i < m.NumFaces(); i++ {
+		a, b, c := m.face(i)
+		s := Cross(b.Sub(a), c.Sub(a)).Norm() / 2
+		sum := a.Add(b).Add(c)
+		for _, p := range []*Vector3{a, b, c, sum} {
+			add(p, s/12)
+		}
+		mean = mean.Add(sum.Scale(s / 3))
+		total += s
+	}
+	if total == 0 {
+		moment = [3][3]float64{}
+		for _, p := range m.Positions {
+			add(p, 1)
+			mean = mean.Add(p)
+		}
+		total = float64(len(m.Positions))
+	}
+	mean = mean.Scale(1 / total)
+	c := [3]float64{mean.X, mean.Y, mean.Z}
+	for i := range moment {
+		for j := range moment[i] {
+			moment[i][j] = moment[i][j]/total - c[i]*c[j]
+		}
+	}
+	return symmetricEigenvectors(moment)
+}
+
+// symmetricEigenvectors returns the unit eigenvectors of the symmetric
+// matrix a by Jacobi rotations, as a right handed frame.
+func symmetricEigenvectors(a [3][3]float64) [3]*Vector3 {
+	v := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 50; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-30*(a[0][0]*a[0][0]+a[1][1]*a[1][1]+a[2][2]*a[2][2]+1e-300) {
+			break
+		}
+		for _, pq := range [][2]int{{0, 1}, {0, 2}, {1, 2}} {
+			p, q := pq[0], pq[1]
+			if a[p][q] == 0 {
+				continue
+			}
+			// The rotation in the p, q plane that zeroes a[p][q].
+			theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+			t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+			if theta < 0 {
+				t = -t
+			}
+			cos := 1 / math.Sqrt(t*t+1)
+			sin := t * cos
+			for k := 0; k < 3; k++ {
+				a[k][p], a[k][q] = cos*a[k][p]-sin*a[k][q], sin*a[k][p]+cos*a[k][q]
+			}
+			for k := 0; k < 3; k++ {
+				a[p][k], a[q][k] = cos*a[p][k]-sin*a[q][k], sin*a[p][k]+cos*a[q][k]
+			}
+			for k := 0; k < 3; k++ {
+				v[k][p], v[k][q] = cos*v[k][p]-sin*v[k][q], sin*v[k][p]+cos*v[k][q]
+			}
+		}
+	}
+	x := (&Vector3{v[0][0], v[1][0], v[2][0]}).Normalize()
+	y := (&Vector3{v[0][1], v[1][1], v[2][1]}).Normalize()
+	return [3]*Vector3{x, y, Cross(x, y).Normalize()}
+}
+
+// BoundaryEdges returns the edges of m with only one face, in order. A
+// watertight mesh has none.
+func (m *Mesh) BoundaryEdges() []Edge {
+	return m.edgesWhere(func(faces []int) bool { return len(faces) == 1 })
+}
+
+// NonManifoldEdges returns the edges of m with more than two faces, in
+// order.
+func (m *Mesh) NonManifoldEdges() []Edge {
+	return m.edgesWhere(func(faces []int) bool { return len(faces) > 2 })
+}
+
+func (m *Mesh) edgesWhere(f func(faces []int) bool) []Edge {
+	var ret []Edge
+	for e, faces := range m.EdgeFaces() {
+		if f(faces) {
+			ret = append(ret, e)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i][0] < ret[j][0] || ret[i][0] == ret[j][0] && ret[i][1] < ret[j][1]
+	})
+	return ret
+}
+
+// Watertight reports whether m is a closed, consistently wound surface:
+// every edge has two faces, which run along it in opposite directions.
+func (m *Mesh) Watertight() bool {
+	if m.NumFaces() == 0 {
+		return false
+	}
+	// The edges of the faces, each the way its face runs along it.
+	directed := map[[2]int]int{}
+	for i := 0; i < m.NumFaces(); i++ {
+		f := m.Face(i)
+		for k := range f {
+			directed[[2]int{f[k], f[(k+1)%3]}]++
+		}
+	}
+	for e, n := range directed {
+		if n != 1 || directed[[2]int{e[1], e[0]}] != 1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMesh_Analysis(t *testing.T) {
+	mat := &SolidMaterial{}
+	moved := Translate(3, -1, 2).Mult(RotZ(.3)).Mult(RotX(.5))
+	cube := NewMesh(Cube(mat)).Transform(moved)
+	if a := cube.Area(); math.Abs(a-24) > 1e-9 {
+		t.Errorf("cube has area %v, want 24", a)
+	}
+	if v := cube.Volume(); math.Abs(v-8) > 1e-9 {
+		t.Errorf("cube has volume %v, want 8", v)
+	}
+	if !cube.Watertight() || len(cube.BoundaryEdges()) != 0 || len(cube.NonManifoldEdges()) != 0 {
+		t.Errorf("cube is not watertight")
+	}
+	if c := cube.Centroid(); c.Sub(&Vector3{3, -1, 2}).Norm() > 1e-9 {
+		t.Errorf("cube has centroid %v, want 3, -1, 2", c)
+	}
+	if c, r := cube.BoundingSphere(); r < math.Sqrt(3) || r > 1.05*math.Sqrt(3) || c.Sub(&Vector3{3, -1, 2}).Norm() > r-math.Sqrt(3)+1e-9 {
+		t.Errorf("cube has bounding sphere at %v of radius %v", c, r)
+	}
+	for _, p := range cube.Positions {
+		if c, r := cube.BoundingSphere(); p.Sub(c).Norm() > r+1e-9 {
+			t.Errorf("%v is outside the bounding sphere", p)
+		}
+	}
+	b := cube.OrientedBounds()
+	if math.Abs(b.Volume()-8) > 1e-6 || b.Center.Sub(&Vector3{3, -1, 2}).Norm() > 1e-6 {
+		t.Errorf("oriented bounds of the cube are %v around %v, want 8 around 3, -1, 2", b.Volume(), b.Center)
+	}
+	for _, p := range b.Corners() {
+		if transformPoint(moved, &Vector3{1, 1, 1}).Sub(b.Center).Norm() < p.Sub(b.Center).Norm()-1e-6 {
+			t.Errorf("corner %v is outside the cube", p)
+		}
+	}
+	// A long, smooth shape is boxed along its principal axes.
+	long := NewMesh(Icosphere(2, mat))
+	for i, p := range long.Positions {
+		long.Positions[i] = &Vector3{4 * p.X, p.Y, p.Z}
+	}
+	long = long.Transform(RotZ(.7).Mult(RotY(.4)))
+	aabb := long.Bounds().Max.Sub(long.Bounds().Min)
+	if v := long.OrientedBounds().Volume(); v > 32 || v > aabb.X*aabb.Y*aabb.Z/2 {
+		t.Errorf("oriented bounds of an ellipsoid are %v, axis aligned %v", v, aabb.X*aabb.Y*aabb.Z)
+	}
+	fit := cube.Transform(cube.Bounds().Fit(1)).Bounds()
+	if d := fit.Max.Sub(fit.Min); fit.Center().Norm() > 1e-9 || math.Abs(max3(d.X, d.Y, d.Z)-1) > 1e-9 {
+		t.Errorf("fit cube spans %v to %v, want the unit box", fit.Min, fit.Max)
+	}
+
+	// Turning one face of the cube over leaves it closed but not watertight.
+	flipped := NewMesh(Cube(mat))
+	flipped.Indices[1], flipped.Indices[2] = flipped.Indices[2], flipped.Indices[1]
+	if flipped.Watertight() {
+		t.Errorf("cube with a face turned over is watertight")
+	}
+
+	plane := NewMesh(Plane(4, mat))
+	if plane.Watertight() || len(plane.BoundaryEdges()) != 16 {
+		t.Errorf("plane has %d boundary edges, want 16", len(plane.BoundaryEdges()))
+	}
+	if c := plane.Centroid(); c.Norm() > 1e-9 {
+		t.Errorf("plane has centroid %v, want the origin", c)
+	}
+	plane.Positions = append(plane.Positions, &Vector3{0, 1, 0})
+	plane.AddFace(0, 1, len(plane.Positions)-1, 0)
+	plane.AddFace(1, 0, len(plane.Positions)-1, 0)
+	if e := plane.NonManifoldEdges(); len(e) != 1 || e[0] != NewEdge(0, 1) {
+		t.Errorf("plane with two fins has non-manifold edges %v, want 0 to 1", e)
+	}
+}
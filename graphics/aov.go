@@ -0,0 +1,205 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+)
+
+// AOVs are the render outputs besides color, for compositing and debugging:
+// what the nearest fragment of every pixel was. Set Framebuffer.AOVs to have
+// DrawTriangles fill them in. Pixels no triangle covers keep an infinite
+// Depth, nil Normal and UV, and -1 for Triangle and Material.
+type AOVs struct {
+	Width  int
+	Height int
+	// Depth is the distance along Z from the eye.
+	Depth []float64
+	// Normal is the unit shading normal, in scene coordinates.
+	Normal []*Vector3
+	// UV is the texture coordinates, nil on untextured triangles.
+	UV []*Vector2
+	// Triangle is the index of the triangle among those of the last
+	// DrawTriangles.
+	Triangle []int
+	// Material is the index of the material of the triangle in Materials,
+	// which holds every material drawn in the order they first appear.
+	Material  []int
+	Materials []Material
+	// Light holds the diffuse and specular light each of Lights gives every
+	// pixel, unshadowed and without the ambient and emitted light.
+	Lights []Light
+	Light  []*Framebuffer
+}
+
+// NewAOVs returns empty width by height AOVs, with a light buffer for each
+// of lights.
+func NewAOVs(width, height int, lights []Light) *AOVs {
+	a := &AOVs{
+		Width:    width,
+		Height:   height,
+		Depth:    make([]float64, width*height),
+		Normal:   make([]*Vector3, width*height),
+		UV:       make([]*Vector2, width*height),
+		Triangle: make([]int, width*height),
+		Material: make([]int, width*height),
+		Lights:   lights,
+	}
+	for k := range a.Depth {
+		a.Depth[k] = math.Inf(1)
+		a.Triangle[k] = -1
+		a.Material[k] = -1
+	}
+	for range lights {
+		a.Light = append(a.Light, NewFramebuffer(width, height))
+	}
+	return a
+}
+
+// recorder returns the function that records the fragments of t in a, which
+// must be called with the pixel locked, or nil for nil AOVs.
+func (a *AOVs) recorder(t []*Triangle) func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) {
+	if a == nil {
+		return nil
+	}
+	triangles := make(map[*Triangle]int, len(t))
+	materials := map[Material]int{}
+	for k, m := range a.Materials {
+		materials[m] = k
+	}
+	for k, tri := range t {
+		triangles[tri] = k
+		if _, ok := materials[tri.Material]; !ok {
+			materials[tri.Material] = len(a.Materials)
+			a.Materials = append(a.Materials, tri.Material)
+		}
+	}
+	return func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) {
+		k := j*a.Width + i
+		a.Depth[k] = v.Z
+		a.Normal[k] = normal
+		a.UV[k] = nil
+		if tri.UV0 != nil {
+			a.UV[k] = tri.TexCoord(uv)
+		}
+		a.Triangle[k] = triangles[tri]
+		a.Material[k] = materials[tri.Material]
+		for n, l := range a.Lights {
+			a.Light[n].Set(i, j, shadeLight(m, normal, camera, l, v, uv))
+		}
+	}
+}
+
+// DepthImage returns Depth as a grayscale image, white at the nearest point
+// and black at the farthest and where nothing was drawn.
+func (a *AOVs) DepthImage() *image.Gray16 {
+	near, far := math.Inf(1), math.Inf(-1)
+	for _, d := range a.Depth {
+		if !math.IsInf(d, 1) {
+			near, far = math.Min(near, d), math.Max(far, d)
+		}
+	}
+	im := image.NewGray16(image.Rect(0, 0, a.Width, a.Height))
+	for k, d := range a.Depth {
+		if math.IsInf(d, 1) {
+			continue
+		}
+		g := 1.0
+		if far > near {
+			g = (far - d) / (far - near)
+		}
+		im.SetGray16(k%a.Width, k/a.Width, color.Gray16{uint16(math.Round(g * 0xffff))})
+	}
+	return im
+}
+
+// NormalImage returns Normal with each component mapped from -1..1 to 0..255
+// in red, green and blue, and black where nothing was drawn.
+func (a *AOVs) NormalImage() *image.RGBA {
+	return a.image(func(k int) (color.RGBA, bool) {
+		n := a.Normal[k]
+		if n == nil {
+			return color.RGBA{}, false
+		}
+		c := func(x float64) uint8 { return uint8(math.Round((x + 1) / 2 * 255)) }
+		return color.RGBA{c(n.X), c(n.Y), c(n.Z), 255}, true
+	})
+}
+
+// UVImage returns UV with U in red and V in green, wrapped into 0..1.
+func (a *AOVs) UVImage() *image.RGBA {
+	return a.image(func(k int) (color.RGBA, bool) {
+		uv := a.UV[k]
+		if uv == nil {
+			return color.RGBA{}, false
+		}
+		c := func(x float64) uint8 { return uint8(math.Round((x - math.Floor(x)) * 255)) }
+		return color.RGBA{c(uv.X), c(uv.Y), 0, 255}, true
+	})
+}
+
+// IDImage returns ids, such as Triangle or Material, with a distinct color
+// for every id and black for -1.
+func (a *AOVs) IDImage(ids []int) *image.RGBA {
+	return a.image(func(k int) (color.RGBA, bool) {
+		if ids[k] < 0 {
+			return color.RGBA{}, false
+		}
+		// Spread consecutive ids apart with a multiplicative hash.
+		h := uint32(ids[k]+1) * 2654435761
+		return color.RGBA{uint8(h >> 24), uint8(h >> 16), uint8(h >> 8), 255}, true
+	})
+}
+
+// image returns the image with the color at(k) for every pixel k, opaque
+// black where it has none.
+func (a *AOVs) image(at func(k int) (color.RGBA, bool)) *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, a.Width, a.Height))
+	for k := 0; k < a.Width*a.Height; k++ {
+		c, ok := at(k)
+		if !ok {
+			c = color.RGBA{A: 255}
+		}
+		im.SetRGBA(k%a.Width, k/a.Width, c)
+	}
+	return im
+}
+
+// Save writes every buffer of a to files named prefix and the buffer: PNGs
+// prefix_depth.png, prefix_normal.png, prefix_uv.png, prefix_triangle.png and
+// prefix_material.png, and the linear EXRs prefix_light0.exr and on for the
+// lights.
+func (a *AOVs) Save(prefix string) error {
+	images := []struct {
+		name string
+		im   image.Image
+	}{
+		{"depth", a.DepthImage()},
+		{"normal", a.NormalImage()},
+		{"uv", a.UVImage()},
+		{"triangle", a.IDImage(a.Triangle)},
+		{"material", a.IDImage(a.Material)},
+	}
+	for _, im := range images {
+		f, err := os.Create(prefix + "_" + im.name + ".png")
+		if err != nil {
+			return err
+		}
+		if err := png.Encode(f, im.im); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	for n, l := range a.Light {
+		if err := SaveHDR(fmt.Sprintf("%s_light%d.exr", prefix, n), l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
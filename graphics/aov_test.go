@@ -0,0 +1,53 @@
+package graphics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAOVs(t *testing.T) {
+	mat := &SolidMaterial{Color: &Color{200, 100, 50, 255}, SpecColor_: &Color{}, SpecCoeff_: 1, AmbientCoeff_: .1}
+	cube := ApplyTransform(Cube(mat), Translate(0, 0, 4))
+	lit := &DirectionLight{Direction: (&Vector3{0, 1, 1}).Normalize(), Color: White}
+	fb := NewFramebuffer(32, 32)
+	fb.AOVs = NewAOVs(32, 32, []Light{lit})
+	fb.DrawTriangles(cube, PhongShader([]Light{lit}))
+	a := fb.AOVs
+
+	center := 16*32 + 16
+	if d := a.Depth[center]; math.Abs(d-3) > 1e-9 {
+		t.Errorf("depth %v at the center, want 3", d)
+	}
+	if n := a.Normal[center]; n.Sub(&Vector3{0, 0, -1}).Norm() > 1e-9 {
+		t.Errorf("normal %v at the center, want 0, 0, -1", n)
+	}
+	if tri := a.Triangle[center]; tri < 0 || cube[tri].Norm.Z > -.999 || a.UV[center] == nil {
+		t.Errorf("triangle %d at the center with UV %v", tri, a.UV[center])
+	}
+	if m := a.Material[center]; len(a.Materials) != 1 || m != 0 || a.Materials[0] != mat {
+		t.Errorf("material %d of %v at the center", m, a.Materials)
+	}
+	if !math.IsInf(a.Depth[0], 1) || a.Normal[0] != nil || a.Triangle[0] != -1 || a.Material[0] != -1 {
+		t.Errorf("corner has depth %v, triangle %d and material %d, want nothing", a.Depth[0], a.Triangle[0], a.Material[0])
+	}
+	// The ambient light and the light buffer add up to the color.
+	sum := ColorAdd(unlit(mat, nil), a.Light[0].At(16, 16))
+	if c := fb.At(16, 16); math.Abs(c.R-sum.R)+math.Abs(c.G-sum.G)+math.Abs(c.B-sum.B) > 1e-9 {
+		t.Errorf("color %v at the center, lights and ambient %v", c, sum)
+	}
+
+	prefix := filepath.Join(t.TempDir(), "aov")
+	if err := a.Save(prefix); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"_depth.png", "_normal.png", "_uv.png", "_triangle.png", "_material.png", "_light0.exr"} {
+		if _, err := os.Stat(prefix + name); err != nil {
+			t.Error(err)
+		}
+	}
+	if g := a.DepthImage().Gray16At(16, 16).Y; g != 0xffff {
+		t.Errorf("nearest point has depth image value %d, want white", g)
+	}
+}
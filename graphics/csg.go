@@ -0,0 +1,428 @@
+package graphics
+
+// Constructive solid geometry on closed meshes, after Evan Wallace's csg.js:
+// each mesh is put in a BSP tree of its polygons, and each tree clips the
+// polygons of the other to keep those inside or outside it. Which side of a
+// triangle is out is taken from its vertex normals, so the winding of the
+// input does not matter. The results keep the material, normals and texture
+// coordinates of the faces they come from, and their faces are split where
+// others meet them so they are as closed as the input.
+
+import (
+	"math"
+	"sort"
+)
+
+// csgEpsilon is how far from a plane a point may be and still lie on it.
+const csgEpsilon = 1e-5
+
+type csgVertex struct {
+	p  *Vector3
+	n  *Vector3
+	uv *Vector2
+}
+
+func (v *csgVertex) lerp(o *csgVertex, t float64) *csgVertex {
+	ret := &csgVertex{
+		p: v.p.Add(o.p.Sub(v.p).Scale(t)),
+		n: v.n.Add(o.n.Sub(v.n).Scale(t)),
+	}
+	if v.uv != nil && o.uv != nil {
+		ret.uv = v.uv.Add(o.uv.Sub(v.uv).Scale(t))
+	}
+	return ret
+}
+
+type csgPlane struct {
+	n *Vector3
+	w float64
+}
+
+type csgPolygon struct {
+	vertices []*csgVertex
+	plane    *csgPlane
+	material Material
+}
+
+func newCSGPolygon(vertices []*csgVertex, material Material) *csgPolygon {
+	n := CalcNorm(vertices[0].p, vertices[1].p, vertices[2].p)
+	return &csgPolygon{vertices, &csgPlane{n, n.Dot(vertices[0].p)}, material}
+}
+
+func (p *csgPolygon) flip() *csgPolygon {
+	vertices := make([]*csgVertex, len(p.vertices))
+	for i, v := range p.vertices {
+		vertices[len(vertices)-1-i] = &csgVertex{v.p, v.n.Scale(-1), v.uv}
+	}
+	return &csgPolygon{vertices, &csgPlane{p.plane.n.Scale(-1), -p.plane.w}, p.material}
+}
+
+const (
+	csgCoplanar = 0
+	csgFront    = 1
+	csgBack     = 2
+	csgSpanning = 3
+)
+
+// split sorts polygon into the lists for the sides of plane it lies on,
+// cutting it in two if it spans the plane.
+func (plane *csgPlane) split(polygon *csgPolygon, coplanarFront, coplanarBack, front, back *[]*csgPolygon) {
+	kind := 0
+	types := make([]int, len(polygon.vertices))
+	for i, v := range polygon.vertices {
+		t := plane.n.Dot(v.p) - plane.w
+		switch {
+		case t < -csgEpsilon:
+			types[i] = csgBack
+		case t > csgEpsilon:
+			types[i] = csgFront
+		}
+		kind |= types[i]
+	}
+	switch kind {
+	case csgCoplanar:
+		if plane.n.Dot(polygon.plane.n) > 0 {
+			*coplanarFront = append(*coplanarFront, polygon)
+		} else {
+			*coplanarBack = append(*coplanarBack, polygon)
+		}
+	case csgFront:
+		*front = append(*front, polygon)
+	case csgBack:
+		*back = append(*back, polygon)
+	case csgSpanning:
+		var f, b []*csgVertex
+		for i, vi := range polygon.vertices {
+			j := (i + 1) % len(polygon.vertices)
+			ti, tj, vj := types[i], types[j], polygon.vertices[j]
+			if ti != csgBack {
+				f = append(f, vi)
+			}
+			if ti != csgFront {
+				b = append(b, vi)
+			}
+			if ti|tj == csgSpanning {
+				t := (plane.w - plane.n.Dot(vi.p)) / plane.n.Dot(vj.p.Sub(vi.p))
+				v := vi.lerp(vj, t)
+				f = append(f, v)
+				b = append(b, v)
+			}
+		}
+		if len(f) >= 3 {
+			*front = append(*front, &csgPolygon{f, polygon.plane, polygon.material})
+		}
+		if len(b) >= 3 {
+			*back = append(*back, &csgPolygon{b, polygon.plane, polygon.material})
+		}
+	}
+}
+
+// csgNode is a node of a BSP tree: the polygons on its plane, and the trees
+// in front of and behind it.
+type csgNode struct {
+	plane    *csgPlane
+	front    *csgNode
+	back     *csgNode
+	polygons []*csgPolygon
+}
+
+func newCSGNode(polygons []*csgPolygon) *csgNode {
+	n := &csgNode{}
+	n.build(polygons)
+	return n
+}
+
+// invert turns the solid inside out.
+func (n *csgNode) invert() {
+	for i, p := range n.polygons {
+		n.polygons[i] = p.flip()
+	}
+	if n.plane != nil {
+		n.plane = &csgPlane{n.plane.n.Scale(-1), -n.plane.w}
+	}
+	if n.front != nil {
+		n.front.invert()
+	}
+	if n.back != nil {
+		n.back.invert()
+	}
+	n.front, n.back = n.back, n.front
+}
+
+// clipPolygons returns the parts of polygons outside the solid.
+func (n *csgNode) clipPolygons(polygons []*csgPolygon) []*csgPolygon {
+	if n.plane == nil {
+		return append([]*csgPolygon(nil), polygons...)
+	}
+	var front, back []*csgPolygon
+	for _, p := range polygons {
+		n.plane.split(p, &front, &back, &front, &back)
+	}
+	if n.front != nil {
+		front = n.front.clipPolygons(front)
+	}
+	if n.back != nil {
+		back = n.back.clipPolygons(back)
+	} else {
+		back = nil
+	}
+	return append(front, back...)
+}
+
+// clipTo removes the parts of the polygons of n inside the solid of o.
+func (n *csgNode) clipTo(o *csgNode) {
+	n.polygons = o.clipPolygons(n.polygons)
+	if n.front != nil {
+		n.front.clipTo(o)
+	}
+	if n.back != nil {
+		n.back.clipTo(o)
+	}
+}
+
+func (n *csgNode) allPolygons() []*csgPolygon {
+	ret := append([]*csgPolygon(nil), n.polygons...)
+	if n.front != nil {
+		ret = append(ret, n.front.allPolygons()...)
+	}
+	if n.back != nil {
+		ret = append(ret, n.back.allPolygons()...)
+	}
+	return ret
+}
+
+func (n *csgNode) build(polygons []*csgPolygon) {
+	if len(polygons) == 0 {
+		return
+	}
+	if n.plane == nil {
+		n.plane = polygons[0].plane
+	}
+	var front, back []*csgPolygon
+	for _, p := range polygons {
+		n.plane.split(p, &n.polygons, &n.polygons, &front, &back)
+	}
+	if len(front) > 0 {
+		if n.front == nil {
+			n.front = &csgNode{}
+		}
+		n.front.build(front)
+	}
+	if len(back) > 0 {
+		if n.back == nil {
+			n.back = &csgNode{}
+		}
+		n.back.build(back)
+	}
+}
+
+func csgPolygons(t []*Triangle) []*csgPolygon {
+	ret := make([]*csgPolygon, 0, len(t))
+	for _, tri := range t {
+		if tri.Area() == 0 {
+			continue
+		}
+		vertices := []*csgVertex{{tri.P0, tri.N0, tri.UV0}, {tri.P1, tri.N1, tri.UV1}, {tri.P2, tri.N2, tri.UV2}}
+		p := newCSGPolygon(vertices, tri.Material)
+		if p.plane.n.Dot(tri.N0.Add(tri.N1).Add(tri.N2)) < 0 {
+			vertices[1], vertices[2] = vertices[2], vertices[1]
+			p = newCSGPolygon(vertices, tri.Material)
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// csgWeld makes the vertices of polygons within csgEpsilon of each other
+// share one point, dropping the sides that shrink away, and returns the
+// points.
+func csgWeld(polygons []*csgPolygon) []*Vector3 {
+	cell := func(p *Vector3) [3]int64 {
+		return [3]int64{int64(math.Floor(p.X / csgEpsilon)), int64(math.Floor(p.Y / csgEpsilon)), int64(math.Floor(p.Z / csgEpsilon))}
+	}
+	// Points within csgEpsilon are in the same or neighboring cells.
+	cells := map[[3]int64][]*Vector3{}
+	find := func(p *Vector3) *Vector3 {
+		c := cell(p)
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, q := range cells[[3]int64{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						if q.Sub(p).Norm() <= csgEpsilon {
+							return q
+						}
+					}
+				}
+			}
+		}
+		cells[c] = append(cells[c], p)
+		return p
+	}
+	var points []*Vector3
+	seen := map[*Vector3]bool{}
+	for i, poly := range polygons {
+		var vertices []*csgVertex
+		for _, v := range poly.vertices {
+			p := find(v.p)
+			if !seen[p] {
+				seen[p] = true
+				points = append(points, p)
+			}
+			if n := len(vertices); n > 0 && vertices[n-1].p == p {
+				continue
+			}
+			vertices = append(vertices, &csgVertex{p, v.n, v.uv})
+		}
+		if n := len(vertices); n > 1 && vertices[n-1].p == vertices[0].p {
+			vertices = vertices[:n-1]
+		}
+		polygons[i] = &csgPolygon{vertices, poly.plane, poly.material}
+	}
+	return points
+}
+
+// csgSplitSides puts into the sides of polygons the points that lie along
+// them, so that no face meets another at a T junction.
+func csgSplitSides(polygons []*csgPolygon, points []*Vector3) {
+	points = append([]*Vector3(nil), points...)
+	sort.Slice(points, func(i, j int) bool { return points[i].X < points[j].X })
+	type cut struct {
+		t float64
+		p *Vector3
+	}
+	for _, poly := range polygons {
+		var vertices []*csgVertex
+		for i, a := range poly.vertices {
+			b := poly.vertices[(i+1)%len(poly.vertices)]
+			vertices = append(vertices, a)
+			d := b.p.Sub(a.p)
+			lo, hi := math.Min(a.p.X, b.p.X)-csgEpsilon, math.Max(a.p.X, b.p.X)+csgEpsilon
+			var cuts []cut
+			for k := sort.Search(len(points), func(k int) bool { return points[k].X >= lo }); k < len(points) && points[k].X <= hi; k++ {
+				p := points[k]
+				if p == a.p || p == b.p {
+					continue
+				}
+				t := p.Sub(a.p).Dot(d) / d.Dot(d)
+				if t <= 0 || t >= 1 || a.p.Add(d.Scale(t)).Sub(p).Norm() > csgEpsilon {
+					continue
+				}
+				cuts = append(cuts, cut{t, p})
+			}
+			sort.Slice(cuts, func(i, j int) bool { return cuts[i].t < cuts[j].t })
+			for _, c := range cuts {
+				v := a.lerp(b, c.t)
+				v.p = c.p
+				vertices = append(vertices, v)
+			}
+		}
+		poly.vertices = vertices
+	}
+}
+
+// csgCenter returns the vertex at the middle of the vertices of p.
+func csgCenter(p *csgPolygon) *csgVertex {
+	ret := &csgVertex{&Vector3{}, &Vector3{}, &Vector2{}}
+	for _, v := range p.vertices {
+		ret.p, ret.n = ret.p.Add(v.p), ret.n.Add(v.n)
+		if v.uv == nil || ret.uv == nil {
+			ret.uv = nil
+		} else {
+			ret.uv = ret.uv.Add(v.uv)
+		}
+	}
+	s := 1 / float64(len(p.vertices))
+	ret.p, ret.n = ret.p.Scale(s), ret.n.Scale(s)
+	if ret.uv != nil {
+		ret.uv = ret.uv.Scale(s)
+	}
+	return ret
+}
+
+func csgTriangles(polygons []*csgPolygon) []*Triangle {
+	csgSplitSides(polygons, csgWeld(polygons))
+	var ret []*Triangle
+	textured := false
+	add := func(a, b, c *csgVertex, material Material) {
+		if Cross(b.p.Sub(a.p), c.p.Sub(a.p)).Norm() == 0 {
+			return
+		}
+		t := NewTriangle(a.p, b.p, c.p, material)
+		t.N0, t.N1, t.N2 = a.n.Normalize(), b.n.Normalize(), c.n.Normalize()
+		if a.uv != nil && b.uv != nil && c.uv != nil {
+			t.UV0, t.UV1, t.UV2 = a.uv, b.uv, c.uv
+			textured = true
+		}
+		ret = append(ret, t)
+	}
+	for _, p := range polygons {
+		v := p.vertices
+		if len(v) < 3 {
+			continue
+		}
+		// A fan from the first vertex would leave out the sides of a straight
+		// run of points next to it, so such polygons fan from their middle.
+		straight := false
+		for i, b := range v {
+			a, c := v[(i+len(v)-1)%len(v)], v[(i+1)%len(v)]
+			if d := c.p.Sub(a.p); Cross(d, b.p.Sub(a.p)).Norm() <= csgEpsilon*d.Norm() {
+				straight = true
+			}
+		}
+		if !straight {
+			for k := 1; k+1 < len(v); k++ {
+				add(v[0], v[k], v[k+1], p.material)
+			}
+			continue
+		}
+		center := csgCenter(p)
+		for k := range v {
+			add(center, v[k], v[(k+1)%len(v)], p.material)
+		}
+	}
+	if textured {
+		ComputeTangents(ret)
+	}
+	return ret
+}
+
+// CSGUnion returns the surface of everything inside a or b, which should be
+// closed meshes.
+func CSGUnion(a, b []*Triangle) []*Triangle {
+	na, nb := newCSGNode(csgPolygons(a)), newCSGNode(csgPolygons(b))
+	na.clipTo(nb)
+	nb.clipTo(na)
+	nb.invert()
+	nb.clipTo(na)
+	nb.invert()
+	na.build(nb.allPolygons())
+	return csgTriangles(na.allPolygons())
+}
+
+// CSGDifference returns the surface of a with b cut out of it. The faces of
+// the cut keep the material of b.
+func CSGDifference(a, b []*Triangle) []*Triangle {
+	na, nb := newCSGNode(csgPolygons(a)), newCSGNode(csgPolygons(b))
+	na.invert()
+	na.clipTo(nb)
+	nb.clipTo(na)
+	nb.invert()
+	nb.clipTo(na)
+	nb.invert()
+	na.build(nb.allPolygons())
+	na.invert()
+	return csgTriangles(na.allPolygons())
+}
+
+// CSGIntersection returns the surface of everything inside both a and b.
+func CSGIntersection(a, b []*Triangle) []*Triangle {
+	na, nb := newCSGNode(csgPolygons(a)), newCSGNode(csgPolygons(b))
+	na.invert()
+	nb.clipTo(na)
+	nb.invert()
+	na.clipTo(nb)
+	nb.clipTo(na)
+	na.build(nb.allPolygons())
+	na.invert()
+	return csgTriangles(na.allPolygons())
+}
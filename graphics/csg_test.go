@@ -0,0 +1,57 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCSG(t *testing.T) {
+	ma, mb := &SolidMaterial{}, &SolidMaterial{}
+	a := Cube(ma)
+	b := ApplyTransform(Cube(mb), Translate(1, 1, 1))
+	c := ApplyTransform(Cube(mb), Translate(.5, .5, .5))
+	for _, tc := range []struct {
+		name   string
+		result []*Triangle
+		volume float64
+	}{
+		{"union", CSGUnion(a, b), 15},
+		{"difference", CSGDifference(a, b), 7},
+		{"intersection", CSGIntersection(a, b), 1},
+		{"overlapping union", CSGUnion(a, c), 16 - 1.5*1.5*1.5},
+		{"overlapping difference", CSGDifference(a, c), 8 - 1.5*1.5*1.5},
+		{"overlapping intersection", CSGIntersection(a, c), 1.5 * 1.5 * 1.5},
+	} {
+		if v := NewMesh(tc.result).Volume(); math.Abs(v-tc.volume) > 1e-9 {
+			t.Errorf("%s has volume %v, want %v", tc.name, v, tc.volume)
+		}
+		if n := openEdges(tc.result); n != 0 {
+			t.Errorf("%s has %d open edges", tc.name, n)
+		}
+		materials := map[Material]bool{}
+		for _, tri := range tc.result {
+			materials[tri.Material] = true
+			for _, n := range []*Vector3{tri.N0, tri.N1, tri.N2} {
+				if n.Dot(tri.Norm) < .999 {
+					t.Fatalf("%s: normal %v disagrees with the face %v", tc.name, n, tri.Norm)
+				}
+			}
+		}
+		if !materials[ma] || !materials[mb] || len(materials) != 2 {
+			t.Errorf("%s lost the materials of its faces", tc.name)
+		}
+	}
+
+	// A cube through a sphere takes the half of the sphere inside it. The
+	// sphere is wound inward, which the result is not.
+	sphere := SphereMat(24, ma)
+	cube := ApplyTransform(Cube(mb), Translate(1, 0, 0))
+	half := CSGDifference(sphere, cube)
+	whole, cut := NewMesh(sphere).Volume(), NewMesh(half).Volume()
+	if want := math.Abs(whole) / 2; math.Abs(cut-want) > .01*want {
+		t.Errorf("half sphere has volume %v, want %v", cut, want)
+	}
+	if n := openEdges(half); n != 0 {
+		t.Errorf("half sphere has %d open edges", n)
+	}
+}
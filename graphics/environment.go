@@ -0,0 +1,326 @@
+package graphics
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// Environment is the light arriving from infinitely far away along a
+// direction. It is what rays see when they miss every triangle.
+type Environment interface {
+	At(dir *Vector3) *Color
+}
+
+type SolidEnvironment struct {
+	Color *Color
+}
+
+func (s *SolidEnvironment) At(_ *Vector3) *Color {
+	return s.Color
+}
+
+// floatImage is an image.Image converted to float colors once, so lookups do
+// not go through the color.Color interface.
+type floatImage struct {
+	Width  int
+	Height int
+	Pix    []*Color
+}
+
+func newFloatImage(im image.Image) *floatImage {
+	b := im.Bounds()
+	f := &floatImage{
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Pix:    make([]*Color, b.Dx()*b.Dy()),
+	}
+	for j := 0; j < f.Height; j++ {
+		for i := 0; i < f.Width; i++ {
+			f.Pix[j*f.Width+i] = ToColor(im.At(b.Min.X+i, b.Min.Y+j))
+		}
+	}
+	return f
+}
+
+// bilinear samples at continuous texel coordinates, wrapping horizontally and
+// clamping vertically.
+func (f *floatImage) bilinear(x, y float64) *Color {
+	return f.filter(x, y, WrapRepeat, WrapClamp, 0, 0, f.Width, f.Height)
+}
+
+// EquirectEnvironment maps an equirectangular (latitude/longitude) image
+// around the scene. The top row of the image is straight up, which is -Y in
+// screen space, and the center column looks down +Z.
+type EquirectEnvironment struct {
+	im *floatImage
+}
+
+func NewEquirectEnvironment(im image.Image) *EquirectEnvironment {
+	return &EquirectEnvironment{newFloatImage(im)}
+}
+
+// NewHDREquirectEnvironment wraps a framebuffer, such as one loaded with
+// OpenHDR, without clamping its values.
+func NewHDREquirectEnvironment(f *Framebuffer) *EquirectEnvironment {
+	return &EquirectEnvironment{&floatImage{f.Width, f.Height, f.Pix}}
+}
+
+func (e *EquirectEnvironment) At(dir *Vector3) *Color {
+	u, v := equirectUV(dir.Normalize())
+	return e.im.bilinear(u*float64(e.im.Width), v*float64(e.im.Height))
+}
+
+func equirectUV(d *Vector3) (float64, float64) {
+	u := .5 + math.Atan2(d.X, d.Z)/(2*math.Pi)
+	v := math.Acos(max(min(-d.Y, 1), -1)) / math.Pi
+	return u, v
+}
+
+func equirectDir(u, v float64) *Vector3 {
+	phi := (u - .5) * 2 * math.Pi
+	theta := v * math.Pi
+	return &Vector3{
+		X: math.Sin(theta) * math.Sin(phi),
+		Y: -math.Cos(theta),
+		Z: math.Sin(theta) * math.Cos(phi),
+	}
+}
+
+// CubeEnvironment maps six square images around the scene in the usual
+// +X, -X, +Y, -Y, +Z, -Z order, with +Y being up (-Y in screen space).
+type CubeEnvironment struct {
+	faces [6]*floatImage
+}
+
+func NewCubeEnvironment(faces [6]image.Image) *CubeEnvironment {
+	c := &CubeEnvironment{}
+	for i, f := range faces {
+		c.faces[i] = newFloatImage(f)
+	}
+	return c
+}
+
+func (c *CubeEnvironment) At(dir *Vector3) *Color {
+	d := &Vector3{dir.X, -dir.Y, dir.Z}
+	f := cubeFace(d)
+	var ma, sc, tc float64
+	switch f {
+	case 0:
+		ma, sc, tc = d.X, -d.Z, -d.Y
+	case 1:
+		ma, sc, tc = -d.X, d.Z, -d.Y
+	case 2:
+		ma, sc, tc = d.Y, d.X, d.Z
+	case 3:
+		ma, sc, tc = -d.Y, d.X, -d.Z
+	case 4:
+		ma, sc, tc = d.Z, d.X, -d.Y
+	case 5:
+		ma, sc, tc = -d.Z, -d.X, -d.Y
+	}
+	face := c.faces[f]
+	s := (sc/ma + 1) / 2
+	t := (tc/ma + 1) / 2
+	x := min(max(s*float64(face.Width), .5), float64(face.Width)-.5)
+	y := min(max(t*float64(face.Height), .5), float64(face.Height)-.5)
+	return face.bilinear(x, y)
+}
+
+// DrawBackground fills every pixel of im with what the camera sees of the
+// environment through it.
+func DrawBackground(im *image.RGBA, sky Environment) {
+	width := im.Rect.Max.X - im.Rect.Min.X
+	height := im.Rect.Max.Y - im.Rect.Min.Y
+	for i := 0; i < width; i++ {
+		for j := 0; j < height; j++ {
+			coordx := lin(float64(i), 0, float64(width), -1, 1)
+			coordy := lin(float64(j), 0, float64(height), -1, 1)
+			im.Set(i, j, sky.At((&Vector2{coordx, coordy}).Hom()).ToRGBA())
+		}
+	}
+}
+
+// IBL lights surfaces with an Environment. Diffuse light comes from the
+// irradiance of the environment, projected once onto nine spherical
+// harmonics. Specular light comes from copies of the environment blurred
+// with Phong lobes of increasing sharpness.
+type IBL struct {
+	Environment Environment
+	Intensity   float64
+
+	sh       [9]*Color
+	specular []*floatImage
+}
+
+// iblExponents are the Phong exponents the specular copies are blurred with.
+// Sharper highlights read the environment directly.
+var iblExponents = []float64{1, 4, 16, 64}
+
+const (
+	iblSourceWidth   = 64
+	iblSpecularWidth = 32
+)
+
+func NewIBL(sky Environment, intensity float64) *IBL {
+	b := &IBL{
+		Environment: sky,
+		Intensity:   intensity,
+		specular:    make([]*floatImage, len(iblExponents)),
+	}
+	source := sampleEnvironment(sky, iblSourceWidth)
+	for k := range b.sh {
+		b.sh[k] = &Color{}
+	}
+	for _, s := range source {
+		basis := shBasis(s.dir)
+		for k := range b.sh {
+			b.sh[k] = ColorAdd(b.sh[k], ColorScale(s.c, basis[k]*s.weight))
+		}
+	}
+	wg := sync.WaitGroup{}
+	for k, e := range iblExponents {
+		wg.Add(1)
+		go func(k int, e float64) {
+			b.specular[k] = prefilter(source, e, iblSpecularWidth)
+			wg.Done()
+		}(k, e)
+	}
+	wg.Wait()
+	return b
+}
+
+type envSample struct {
+	dir    *Vector3
+	c      *Color
+	weight float64
+}
+
+// sampleEnvironment reads the environment on a latitude/longitude grid,
+// weighting each sample by the solid angle it covers.
+func sampleEnvironment(sky Environment, width int) []*envSample {
+	height := width / 2
+	res := make([]*envSample, 0, width*height)
+	for j := 0; j < height; j++ {
+		v := (float64(j) + .5) / float64(height)
+		weight := math.Sin(v*math.Pi) * (2 * math.Pi / float64(width)) * (math.Pi / float64(height))
+		for i := 0; i < width; i++ {
+			dir := equirectDir((float64(i)+.5)/float64(width), v)
+			res = append(res, &envSample{dir, sky.At(dir), weight})
+		}
+	}
+	return res
+}
+
+func prefilter(source []*envSample, exponent float64, width int) *floatImage {
+	height := width / 2
+	f := &floatImage{
+		Width:  width,
+		Height: height,
+		Pix:    make([]*Color, width*height),
+	}
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			r := equirectDir((float64(i)+.5)/float64(width), (float64(j)+.5)/float64(height))
+			sum := &Color{}
+			var total float64
+			for _, s := range source {
+				cos := r.Dot(s.dir)
+				if cos <= 0 {
+					continue
+				}
+				w := math.Pow(cos, exponent) * s.weight
+				sum = ColorAdd(sum, ColorScale(s.c, w))
+				total += w
+			}
+			f.Pix[j*width+i] = ColorScale(sum, 1/total)
+		}
+	}
+	return f
+}
+
+func shBasis(d *Vector3) [9]float64 {
+	return [9]float64{
+		.282095,
+		.488603 * d.Y,
+		.488603 * d.Z,
+		.488603 * d.X,
+		1.092548 * d.X * d.Y,
+		1.092548 * d.Y * d.Z,
+		.315392 * (3*d.Z*d.Z - 1),
+		1.092548 * d.X * d.Z,
+		.546274 * (d.X*d.X - d.Y*d.Y),
+	}
+}
+
+// shBand is the cosine lobe convolution for each coefficient, divided by pi
+// so that a uniform environment has an irradiance equal to its color.
+var shBand = [9]float64{1, 2.0 / 3, 2.0 / 3, 2.0 / 3, .25, .25, .25, .25, .25}
+
+// Irradiance is the cosine weighted average of the environment around n.
+func (b *IBL) Irradiance(n *Vector3) *Color {
+	basis := shBasis(n)
+	ret := &Color{}
+	for k, c := range b.sh {
+		ret = ColorAdd(ret, ColorScale(c, basis[k]*shBand[k]))
+	}
+	ret.A = 255
+	ret.R = max(ret.R, 0)
+	ret.G = max(ret.G, 0)
+	ret.B = max(ret.B, 0)
+	return ColorScale(ret, b.Intensity)
+}
+
+// Specular is the environment around the reflection direction r, blurred
+// with a Phong lobe of the given exponent.
+func (b *IBL) Specular(r *Vector3, exponent float64) *Color {
+	r = r.Normalize()
+	last := len(iblExponents) - 1
+	if exponent >= 4*iblExponents[last] {
+		return ColorScale(b.Environment.At(r), b.Intensity)
+	}
+	level := math.Log2(max(exponent, 1)) / 2
+	k := mini(int(level), last)
+	var c *Color
+	if k == last {
+		c = ColorAdd(
+			ColorScale(b.lookup(k, r), 1-(level-float64(k))),
+			ColorScale(b.Environment.At(r), level-float64(k)),
+		)
+	} else {
+		c = ColorAdd(
+			ColorScale(b.lookup(k, r), 1-(level-float64(k))),
+			ColorScale(b.lookup(k+1, r), level-float64(k)),
+		)
+	}
+	return ColorScale(c, b.Intensity)
+}
+
+func (b *IBL) lookup(k int, r *Vector3) *Color {
+	u, v := equirectUV(r)
+	f := b.specular[k]
+	return f.bilinear(u*float64(f.Width), v*float64(f.Height))
+}
+
+// RenderIBL shades like Render and adds the diffuse and specular light of the
+// image based lighting.
+func RenderIBL(m Material, normal, camera *Vector3, lights []Light, ibl *IBL, v *Vector3, uv *Vector2) *Color {
+	ret := Render(m, normal, camera, lights, v, uv)
+	n := normal
+	if n.Dot(camera) > 0 {
+		n = n.Scale(-1)
+	}
+	reflect := camera.Sub(n.Scale(2 * n.Dot(camera)))
+	diffColor := ColorMult(m.C(uv), ibl.Irradiance(n))
+	specColor := ColorMult(m.SpecColor(uv), ibl.Specular(reflect, m.SpecCoeff(uv)))
+	return ColorAdd(ret, ColorAdd(diffColor, specColor))
+}
+
+// DrawTrianglesParallelIBL rasterizes like DrawTrianglesParallel over the
+// environment of ibl, lighting the triangles with it as well as with l.
+func DrawTrianglesParallelIBL(im *image.RGBA, t []*Triangle, l []Light, ibl *IBL) {
+	DrawBackground(im, ibl.Environment)
+	forEachFragment(im.Rect.Dx(), im.Rect.Dy(), t, func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) {
+		im.Set(i, j, RenderIBL(m, normal, camera, l, ibl, v, uv).ToRGBA())
+	})
+}
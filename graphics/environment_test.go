@@ -0,0 +1,80 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestEquirectUV(t *testing.T) {
+	for _, d := range []*Vector3{{0, 0, 1}, {1, 0, 0}, {0, -1, .001}, {.3, .4, -.5}} {
+		d = d.Normalize()
+		u, v := equirectUV(d)
+		if back := equirectDir(u, v); back.Sub(d).Norm() > 1e-9 {
+			t.Errorf("direction %v maps back to %v", d, back)
+		}
+	}
+}
+
+func TestCubeEnvironment(t *testing.T) {
+	// Each face has a color of its own in each quarter, red for the face and
+	// green for the quarter: top left, top right, bottom left, bottom right.
+	var faces [6]image.Image
+	for f := range faces {
+		im := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for j := 0; j < 8; j++ {
+			for i := 0; i < 8; i++ {
+				im.Set(i, j, color.RGBA{uint8(40 * f), uint8(60 * (i/4 + 2*(j/4))), 0, 255})
+			}
+		}
+		faces[f] = im
+	}
+	c := NewCubeEnvironment(faces)
+	// Where each face is, and which ways its right and top point, seen from
+	// inside the cube. Up in the scene is -Y.
+	for f, frame := range [6][3]*Vector3{
+		{{1, 0, 0}, {0, 0, -1}, {0, -1, 0}},
+		{{-1, 0, 0}, {0, 0, 1}, {0, -1, 0}},
+		{{0, -1, 0}, {1, 0, 0}, {0, 0, -1}},
+		{{0, 1, 0}, {1, 0, 0}, {0, 0, 1}},
+		{{0, 0, 1}, {1, 0, 0}, {0, -1, 0}},
+		{{0, 0, -1}, {-1, 0, 0}, {0, -1, 0}},
+	} {
+		forward, right, up := frame[0], frame[1], frame[2]
+		for q := 0; q < 4; q++ {
+			x, y := float64(q%2)-.5, .5-float64(q/2)
+			got := c.At(forward.Add(right.Scale(x)).Add(up.Scale(y)))
+			if got.R != float64(40*f) || got.G != float64(60*q) {
+				t.Errorf("face %d, quarter %d is %v, want red %d and green %d", f, q, got, 40*f, 60*q)
+			}
+		}
+	}
+}
+
+func TestIBL_Uniform(t *testing.T) {
+	sky := &SolidEnvironment{&Color{100, 50, 25, 255}}
+	ibl := NewIBL(sky, 1)
+	for _, n := range []*Vector3{{0, 1, 0}, {0, 0, -1}, (&Vector3{1, 1, 1}).Normalize()} {
+		for _, c := range []*Color{ibl.Irradiance(n), ibl.Specular(n, 8)} {
+			if math.Abs(c.R-100) > 1 || math.Abs(c.G-50) > 1 || math.Abs(c.B-25) > 1 {
+				t.Errorf("uniform environment lights %v with %v", n, c)
+			}
+		}
+	}
+}
+
+func TestIBL_Irradiance(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 16; j++ {
+			im.Set(i, j, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	ibl := NewIBL(NewEquirectEnvironment(im), 1)
+	up := ibl.Irradiance(&Vector3{0, -1, 0})
+	down := ibl.Irradiance(&Vector3{0, 1, 0})
+	if up.R < 200 || down.R > 55 {
+		t.Errorf("white sky gives irradiance %v facing up and %v facing down", up.R, down.R)
+	}
+}
@@ -0,0 +1,375 @@
+package graphics
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// EXRCompression is the compression of the scanline blocks of an OpenEXR
+// file. Only the lossless none and ZIP schemes are supported.
+type EXRCompression uint8
+
+const (
+	EXRNone EXRCompression = 0
+	EXRZips EXRCompression = 2 // ZIP, one scanline per block
+	EXRZip  EXRCompression = 3 // ZIP, sixteen scanlines per block
+)
+
+func (c EXRCompression) linesPerBlock() int {
+	if c == EXRZip {
+		return 16
+	}
+	return 1
+}
+
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+// WriteEXR writes f as a single part scanline OpenEXR file with 32 bit float
+// R, G and B channels.
+func WriteEXR(w io.Writer, f *Framebuffer, compression EXRCompression) error {
+	if compression != EXRNone && compression != EXRZips && compression != EXRZip {
+		return fmt.Errorf("exr: unsupported compression %d", compression)
+	}
+	header := &bytes.Buffer{}
+	le := binary.LittleEndian
+	header.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0})
+
+	channels := &bytes.Buffer{}
+	for _, name := range []string{"B", "G", "R"} {
+		channels.WriteString(name)
+		channels.WriteByte(0)
+		binary.Write(channels, le, []int32{exrFloat, 0, 1, 1})
+	}
+	channels.WriteByte(0)
+	window := []int32{0, 0, int32(f.Width - 1), int32(f.Height - 1)}
+	writeEXRAttribute(header, "channels", "chlist", channels.Bytes())
+	writeEXRAttribute(header, "compression", "compression", []byte{byte(compression)})
+	writeEXRAttribute(header, "dataWindow", "box2i", exrBytes(window))
+	writeEXRAttribute(header, "displayWindow", "box2i", exrBytes(window))
+	writeEXRAttribute(header, "lineOrder", "lineOrder", []byte{0})
+	writeEXRAttribute(header, "pixelAspectRatio", "float", exrBytes(float32(1)))
+	writeEXRAttribute(header, "screenWindowCenter", "v2f", exrBytes([]float32{0, 0}))
+	writeEXRAttribute(header, "screenWindowWidth", "float", exrBytes(float32(1)))
+	header.WriteByte(0)
+
+	lines := compression.linesPerBlock()
+	var chunks [][]byte
+	for y := 0; y < f.Height; y += lines {
+		raw := &bytes.Buffer{}
+		for j := y; j < mini(y+lines, f.Height); j++ {
+			for _, channel := range []func(*Color) float64{
+				func(c *Color) float64 { return c.B },
+				func(c *Color) float64 { return c.G },
+				func(c *Color) float64 { return c.R },
+			} {
+				for i := 0; i < f.Width; i++ {
+					binary.Write(raw, le, float32(channel(f.At(i, j))/255))
+				}
+			}
+		}
+		data := raw.Bytes()
+		if compression != EXRNone {
+			if packed := exrZip(data); len(packed) < len(data) {
+				data = packed
+			}
+		}
+		chunk := &bytes.Buffer{}
+		binary.Write(chunk, le, []int32{int32(y), int32(len(data))})
+		chunk.Write(data)
+		chunks = append(chunks, chunk.Bytes())
+	}
+
+	offset := uint64(header.Len() + 8*len(chunks))
+	for _, c := range chunks {
+		binary.Write(header, le, offset)
+		offset += uint64(len(c))
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := w.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEXRAttribute(w *bytes.Buffer, name, kind string, value []byte) {
+	w.WriteString(name)
+	w.WriteByte(0)
+	w.WriteString(kind)
+	w.WriteByte(0)
+	binary.Write(w, binary.LittleEndian, int32(len(value)))
+	w.Write(value)
+}
+
+func exrBytes(v interface{}) []byte {
+	b := &bytes.Buffer{}
+	binary.Write(b, binary.LittleEndian, v)
+	return b.Bytes()
+}
+
+// exrZip splits the bytes into even and odd halves, delta encodes them and
+// deflates the result, as the OpenEXR ZIP compressor does.
+func exrZip(raw []byte) []byte {
+	tmp := make([]byte, len(raw))
+	half := (len(raw) + 1) / 2
+	for i, b := range raw {
+		if i%2 == 0 {
+			tmp[i/2] = b
+		} else {
+			tmp[half+i/2] = b
+		}
+	}
+	for i := len(tmp) - 1; i > 0; i-- {
+		tmp[i] = byte(int(tmp[i]) - int(tmp[i-1]) + 128 + 256)
+	}
+	out := &bytes.Buffer{}
+	zw := zlib.NewWriter(out)
+	zw.Write(tmp)
+	zw.Close()
+	return out.Bytes()
+}
+
+func exrUnzip(data []byte, size int) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tmp := make([]byte, size)
+	if _, err := io.ReadFull(zr, tmp); err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = byte(int(tmp[i-1]) + int(tmp[i]) - 128)
+	}
+	raw := make([]byte, size)
+	half := (size + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			raw[i] = tmp[i/2]
+		} else {
+			raw[i] = tmp[half+i/2]
+		}
+	}
+	return raw, nil
+}
+
+type exrChannel struct {
+	name string
+	kind int32
+}
+
+func (c *exrChannel) size() int {
+	if c.kind == exrHalf {
+		return 2
+	}
+	return 4
+}
+
+// ReadEXR reads a single part scanline OpenEXR file that is uncompressed or
+// ZIP compressed. R, G and B channels become the color, a lone Y channel
+// becomes gray, and A is kept as alpha.
+func ReadEXR(r io.Reader) (*Framebuffer, error) {
+	file, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	if len(file) < 8 || le.Uint32(file) != 20000630 {
+		return nil, fmt.Errorf("exr: bad magic number")
+	}
+	if file[4] != 2 || file[5]&0x1e != 0 {
+		return nil, fmt.Errorf("exr: only single part scanline files are supported")
+	}
+	pos := 8
+	cstring := func() (string, error) {
+		end := bytes.IndexByte(file[pos:], 0)
+		if end < 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		s := string(file[pos : pos+end])
+		pos += end + 1
+		return s, nil
+	}
+
+	var channels []*exrChannel
+	compression := EXRNone
+	var window []int32
+	for {
+		name, err := cstring()
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		if _, err := cstring(); err != nil {
+			return nil, err
+		}
+		if pos+4 > len(file) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		size := int(int32(le.Uint32(file[pos:])))
+		pos += 4
+		if size < 0 || pos+size > len(file) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		value := file[pos : pos+size]
+		pos += size
+		switch name {
+		case "channels":
+			for len(value) > 1 {
+				end := bytes.IndexByte(value, 0)
+				if end < 0 || end+17 > len(value) {
+					return nil, fmt.Errorf("exr: bad channel list")
+				}
+				c := &exrChannel{string(value[:end]), int32(le.Uint32(value[end+1:]))}
+				if le.Uint32(value[end+9:]) != 1 || le.Uint32(value[end+13:]) != 1 {
+					return nil, fmt.Errorf("exr: subsampled channel %s", c.name)
+				}
+				channels = append(channels, c)
+				value = value[end+17:]
+			}
+		case "compression":
+			if len(value) != 1 {
+				return nil, fmt.Errorf("exr: bad compression attribute")
+			}
+			compression = EXRCompression(value[0])
+		case "dataWindow":
+			window = make([]int32, 4)
+			if err := binary.Read(bytes.NewReader(value), le, window); err != nil || len(value) != 16 {
+				return nil, fmt.Errorf("exr: bad dataWindow attribute")
+			}
+		}
+	}
+	if window == nil || len(channels) == 0 {
+		return nil, fmt.Errorf("exr: missing channels or dataWindow")
+	}
+	if compression != EXRNone && compression != EXRZips && compression != EXRZip {
+		return nil, fmt.Errorf("exr: unsupported compression %d", compression)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+
+	// The window is in int64 so that its corners cannot wrap around.
+	w64 := int64(window[2]) - int64(window[0]) + 1
+	h64 := int64(window[3]) - int64(window[1]) + 1
+	if w64 <= 0 || h64 <= 0 || w64 > maxReadPixels || h64 > maxReadPixels {
+		return nil, fmt.Errorf("exr: bad data window")
+	}
+	width, height := int(w64), int(h64)
+	pixelSize := 0
+	for _, c := range channels {
+		pixelSize += c.size()
+	}
+	// The pixels must fit in the file, or in what the file could inflate to
+	// when compressed, as deflate shrinks data at most 1032 times.
+	room := len(file)
+	if compression != EXRNone {
+		room = mini(room, math.MaxInt/1032) * 1032
+	}
+	if !readableSize(width, height) || width > room/pixelSize/height {
+		return nil, fmt.Errorf("exr: data window %dx%d is too large for the file", width, height)
+	}
+	lineSize := pixelSize * width
+	lines := compression.linesPerBlock()
+	blocks := (height + lines - 1) / lines
+	if blocks > (len(file)-pos)/8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	values := map[string][]float64{}
+	for _, c := range channels {
+		values[c.name] = make([]float64, width*height)
+	}
+	for b := 0; b < blocks; b++ {
+		offset := int(le.Uint64(file[pos+8*b:]))
+		if offset < 0 || offset > len(file)-8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		y := int(int32(le.Uint32(file[offset:]))) - int(window[1])
+		size := int(int32(le.Uint32(file[offset+4:])))
+		if y < 0 || y >= height || size < 0 || size > len(file)-offset-8 {
+			return nil, fmt.Errorf("exr: bad block %d", b)
+		}
+		n := mini(lines, height-y)
+		data := file[offset+8 : offset+8+size]
+		if size < n*lineSize {
+			if data, err = exrUnzip(data, n*lineSize); err != nil {
+				return nil, err
+			}
+		}
+		p := 0
+		for j := y; j < y+n; j++ {
+			for _, c := range channels {
+				v := values[c.name]
+				for i := 0; i < width; i++ {
+					v[j*width+i] = exrValue(data[p:], c.kind)
+					p += c.size()
+				}
+			}
+		}
+	}
+
+	f := NewFramebuffer(width, height)
+	gray := values["Y"]
+	for k := range f.Pix {
+		c := &Color{A: 255}
+		if gray != nil {
+			c.R, c.G, c.B = 255*gray[k], 255*gray[k], 255*gray[k]
+		}
+		if v, ok := values["R"]; ok {
+			c.R = 255 * v[k]
+		}
+		if v, ok := values["G"]; ok {
+			c.G = 255 * v[k]
+		}
+		if v, ok := values["B"]; ok {
+			c.B = 255 * v[k]
+		}
+		if v, ok := values["A"]; ok {
+			c.A = 255 * v[k]
+		}
+		f.Pix[k] = c
+	}
+	return f, nil
+}
+
+func exrValue(b []byte, kind int32) float64 {
+	switch kind {
+	case exrHalf:
+		return halfToFloat(binary.LittleEndian.Uint16(b))
+	case exrFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	return float64(binary.LittleEndian.Uint32(b))
+}
+
+func halfToFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(1+frac/1024, exp-15)
+}
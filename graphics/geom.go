@@ -140,6 +140,22 @@ type Triangle struct {
 	N0 *Vector3
 	N1 *Vector3
 	N2 *Vector3
+	// UV0, UV1 and UV2 are the texture coordinates of P0, P1 and P2, nil for
+	// an untextured triangle.
+	UV0 *Vector2
+	UV1 *Vector2
+	UV2 *Vector2
+	// Tan0, Tan1 and Tan2 are the unit tangents, along increasing U, at P0,
+	// P1 and P2. See ComputeTangents.
+	Tan0 *Vector3
+	Tan1 *Vector3
+	Tan2 *Vector3
+	// Rest0, Rest1 and Rest2 are where P0, P1 and P2 were before
+	// ApplyTransform first moved them, in the coordinates of the object, so
+	// that procedural patterns stay on it as it moves. Nil until then.
+	Rest0 *Vector3
+	Rest1 *Vector3
+	Rest2 *Vector3
 
 	Norm *Vector3
 	Material
@@ -363,7 +379,18 @@ func ApplyTransform(triangles []*Triangle, mat *Mat4) []*Triangle {
 		res[i].N0 = mat.Dot(t.N0.Ext()).Unex().Normalize()
 		res[i].N1 = mat.Dot(t.N1.Ext()).Unex().Normalize()
 		res[i].N2 = mat.Dot(t.N2.Ext()).Unex().Normalize()
-
+		res[i].UV0 = t.UV0
+		res[i].UV1 = t.UV1
+		res[i].UV2 = t.UV2
+		res[i].Rest0, res[i].Rest1, res[i].Rest2 = t.Rest0, t.Rest1, t.Rest2
+		if t.Rest0 == nil {
+			res[i].Rest0, res[i].Rest1, res[i].Rest2 = t.P0, t.P1, t.P2
+		}
+		if t.Tan0 != nil {
+			res[i].Tan0 = mat.Dot(t.Tan0.Ext()).Unex().Normalize()
+			res[i].Tan1 = mat.Dot(t.Tan1.Ext()).Unex().Normalize()
+			res[i].Tan2 = mat.Dot(t.Tan2.Ext()).Unex().Normalize()
+		}
 	}
 	return res
 }
@@ -0,0 +1,255 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/wizgrao/blow/maps"
+)
+
+// Framebuffer holds linear, unclamped colors on the same 0..255 scale as the
+// rest of the package, where 255 is a diffuse white. Values above 255 are
+// kept until the framebuffer is encoded to an image.
+type Framebuffer struct {
+	Width  int
+	Height int
+	Pix    []*Color
+	// AOVs, when set, are filled in by DrawTriangles along with the colors.
+	AOVs *AOVs
+}
+
+// maxReadPixels is the most pixels an image file may claim to hold, so that a
+// corrupt header cannot have the readers allocate without bound.
+const maxReadPixels = 1 << 26
+
+// readableSize reports whether an image file claiming to be width by height
+// is small enough to read.
+func readableSize(width, height int) bool {
+	return width > 0 && height > 0 && width <= maxReadPixels/height
+}
+
+func NewFramebuffer(width, height int) *Framebuffer {
+	f := &Framebuffer{
+		Width:  width,
+		Height: height,
+		Pix:    make([]*Color, width*height),
+	}
+	for i := range f.Pix {
+		f.Pix[i] = &Color{A: 255}
+	}
+	return f
+}
+
+func (f *Framebuffer) At(i, j int) *Color {
+	return f.Pix[j*f.Width+i]
+}
+
+func (f *Framebuffer) Set(i, j int, c *Color) {
+	f.Pix[j*f.Width+i] = c
+}
+
+// DrawBackground fills every pixel with what the camera sees of sky through
+// it.
+func (f *Framebuffer) DrawBackground(sky Environment) {
+	for i := 0; i < f.Width; i++ {
+		for j := 0; j < f.Height; j++ {
+			coordx := lin(float64(i), 0, float64(f.Width), -1, 1)
+			coordy := lin(float64(j), 0, float64(f.Height), -1, 1)
+			f.Set(i, j, sky.At((&Vector2{coordx, coordy}).Hom()))
+		}
+	}
+}
+
+// Shader computes the color of the visible point v of tri. m is the material
+// to shade with, normal the interpolated unit normal, camera the unit
+// direction from the eye to v and uv the barycentric coordinates of v.
+type Shader func(tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) *Color
+
+// DrawTriangles rasterizes t in parallel with a z-buffer, shading the nearest
+// fragment of each pixel with shade.
+func (f *Framebuffer) DrawTriangles(t []*Triangle, shade Shader) {
+	record := f.AOVs.recorder(t)
+	forEachFragment(f.Width, f.Height, t, func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) {
+		f.Set(i, j, shade(tri, m, v, normal, camera, uv))
+		if record != nil {
+			record(i, j, tri, m, v, normal, camera, uv)
+		}
+	})
+}
+
+func PhongShader(l []Light) Shader {
+	return func(tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) *Color {
+		return Render(m, normal, camera, l, v, uv)
+	}
+}
+
+// ShadowShader shades with exact shadows, testing every triangle of env.
+func ShadowShader(env []*Triangle, l []Light) Shader {
+	return func(tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) *Color {
+		return RenderShadow(tri, env, m, normal, camera, v, l, uv)
+	}
+}
+
+// ShadowMapShader shades with shadow maps built from env for every light.
+func ShadowMapShader(env []*Triangle, l []Light, opts *ShadowOptions) Shader {
+	shadows := NewShadowMaps(l, env, opts)
+	return func(tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) *Color {
+		return RenderShadowMap(m, normal, camera, l, shadows, v, uv)
+	}
+}
+
+func IBLShader(l []Light, ibl *IBL) Shader {
+	return func(tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) *Color {
+		return RenderIBL(m, normal, camera, l, ibl, v, uv)
+	}
+}
+
+// ToneMapper compresses a linear value in [0, inf) into [0, 1].
+type ToneMapper interface {
+	Map(x float64) float64
+}
+
+// ClampToneMapper cuts off everything brighter than white.
+type ClampToneMapper struct{}
+
+func (ClampToneMapper) Map(x float64) float64 {
+	return math.Min(math.Max(x, 0), 1)
+}
+
+// ReinhardToneMapper is x / (1 + x), extended so that White maps to 1. A zero
+// White never reaches 1.
+type ReinhardToneMapper struct {
+	White float64
+}
+
+func (r ReinhardToneMapper) Map(x float64) float64 {
+	x = math.Max(x, 0)
+	num := x
+	if r.White > 0 {
+		num = x * (1 + x/(r.White*r.White))
+	}
+	return math.Min(num/(1+x), 1)
+}
+
+// ACESToneMapper is Narkowicz's curve fit of the ACES filmic reference
+// rendering transform.
+type ACESToneMapper struct{}
+
+func (ACESToneMapper) Map(x float64) float64 {
+	x = math.Max(x, 0)
+	return math.Min(math.Max((x*(2.51*x+.03))/(x*(2.43*x+.59)+.14), 0), 1)
+}
+
+// FilmicToneMapper is Hable's curve from Uncharted 2, with a linear white
+// point of 11.2.
+type FilmicToneMapper struct{}
+
+func hable(x float64) float64 {
+	a, b, c, d, e, f := .15, .5, .1, .2, .02, .3
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+func (FilmicToneMapper) Map(x float64) float64 {
+	x = math.Max(x, 0)
+	return math.Min(hable(2*x)/hable(11.2), 1)
+}
+
+// Encoding turns linear framebuffer values into 8 bit pixels. Exposure is in
+// stops, a nil ToneMapper clamps, and SRGB applies the sRGB transfer curve.
+// The zero Encoding clamps values much like Color.ToRGBA.
+type Encoding struct {
+	Exposure   float64
+	ToneMapper ToneMapper
+	SRGB       bool
+}
+
+func (e *Encoding) encode(x float64) uint8 {
+	tm := e.ToneMapper
+	if tm == nil {
+		tm = ClampToneMapper{}
+	}
+	y := tm.Map(x / 255 * math.Exp2(e.Exposure))
+	if e.SRGB {
+		y = EncodeSRGB(y)
+	}
+	return uint8(math.Round(y * 255))
+}
+
+// Image encodes the framebuffer into a new image.RGBA.
+func (f *Framebuffer) Image(e *Encoding) *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, f.Width, f.Height))
+	for j := 0; j < f.Height; j++ {
+		for i := 0; i < f.Width; i++ {
+			c := f.At(i, j)
+			im.SetRGBA(i, j, color.RGBA{
+				R: e.encode(c.R),
+				G: e.encode(c.G),
+				B: e.encode(c.B),
+				A: uint8(max(min(c.A, 255), 0)),
+			})
+		}
+	}
+	return im
+}
+
+// EncodeSRGB applies the sRGB transfer curve to a linear value in [0, 1].
+func EncodeSRGB(x float64) float64 {
+	if x <= .0031308 {
+		return 12.92 * x
+	}
+	return 1.055*math.Pow(x, 1/2.4) - .055
+}
+
+// DecodeSRGB is the inverse of EncodeSRGB.
+func DecodeSRGB(x float64) float64 {
+	if x <= .04045 {
+		return x / 12.92
+	}
+	return math.Pow((x+.055)/1.055, 2.4)
+}
+
+// LinearColor decodes an sRGB color such as one picked in a paint program.
+func LinearColor(c *Color) *Color {
+	return &Color{
+		R: 255 * DecodeSRGB(c.R/255),
+		G: 255 * DecodeSRGB(c.G/255),
+		B: 255 * DecodeSRGB(c.B/255),
+		A: c.A,
+	}
+}
+
+// Linearize decodes an sRGB image, such as a loaded texture, into a 16 bit
+// linear image so that it can be lit in the linear pipeline.
+func Linearize(im image.Image) *image.RGBA64 {
+	b := im.Bounds()
+	res := image.NewRGBA64(b)
+	for j := b.Min.Y; j < b.Max.Y; j++ {
+		for i := b.Min.X; i < b.Max.X; i++ {
+			r, g, bl, a := im.At(i, j).RGBA()
+			res.SetRGBA64(i, j, color.RGBA64{
+				R: uint16(math.Round(DecodeSRGB(float64(r)/0xffff) * 0xffff)),
+				G: uint16(math.Round(DecodeSRGB(float64(g)/0xffff) * 0xffff)),
+				B: uint16(math.Round(DecodeSRGB(float64(bl)/0xffff) * 0xffff)),
+				A: uint16(a),
+			})
+		}
+	}
+	return res
+}
+
+// FramebufferWriter is the WriterMapper counterpart for ray traced pixels
+// written into a Framebuffer.
+type FramebufferWriter struct {
+	*Framebuffer
+	Ct  int
+	Max int
+}
+
+func (w *FramebufferWriter) Do(pix maps.Keyed, outchan chan<- maps.Keyed) {
+	pixel := pix.(*Pixel)
+	w.Set(pixel.I, pixel.J, pixel.C)
+	w.Ct++
+	fmt.Printf("\r %d of %d (%d%%)", w.Ct, w.Max, int(100*float64(w.Ct)/float64(w.Max)))
+}
@@ -0,0 +1,51 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToneMappers(t *testing.T) {
+	for _, tm := range []ToneMapper{ClampToneMapper{}, ReinhardToneMapper{}, ReinhardToneMapper{White: 4}, ACESToneMapper{}, FilmicToneMapper{}} {
+		prev := tm.Map(0)
+		if prev < 0 || prev > .01 {
+			t.Errorf("%T maps black to %v", tm, prev)
+		}
+		for x := .01; x < 100; x *= 1.1 {
+			y := tm.Map(x)
+			if y < prev || y > 1 {
+				t.Errorf("%T maps %v to %v after %v", tm, x, y, prev)
+			}
+			prev = y
+		}
+	}
+	if y := (ReinhardToneMapper{White: 4}).Map(4); y != 1 {
+		t.Errorf("extended Reinhard maps its white point to %v", y)
+	}
+}
+
+func TestSRGB(t *testing.T) {
+	for x := 0.0; x <= 1; x += .01 {
+		if y := DecodeSRGB(EncodeSRGB(x)); math.Abs(x-y) > 1e-9 {
+			t.Errorf("sRGB round trip of %v gives %v", x, y)
+		}
+	}
+}
+
+func TestFramebuffer_Image(t *testing.T) {
+	fb := NewFramebuffer(2, 1)
+	fb.Set(0, 0, &Color{1000, 128, 0, 255})
+	fb.Set(1, 0, &Color{255 * DecodeSRGB(.5), 0, 0, 255})
+	im := fb.Image(&Encoding{})
+	if c := im.RGBAAt(0, 0); c.R != 255 || c.G != 128 || c.B != 0 {
+		t.Errorf("zero encoding gives %v", c)
+	}
+	im = fb.Image(&Encoding{SRGB: true, Exposure: 1})
+	if c := im.RGBAAt(1, 0); c.R <= 128 {
+		t.Errorf("one stop of exposure gives %v", c)
+	}
+	im = fb.Image(&Encoding{SRGB: true})
+	if c := im.RGBAAt(1, 0); c.R != 128 {
+		t.Errorf("sRGB encoding gives %v, want 128", c.R)
+	}
+}
@@ -0,0 +1,167 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func testFramebuffer() *Framebuffer {
+	fb := NewFramebuffer(37, 21)
+	for j := 0; j < fb.Height; j++ {
+		for i := 0; i < fb.Width; i++ {
+			if i < 10 {
+				fb.Set(i, j, &Color{500, 500, 500, 255})
+				continue
+			}
+			fb.Set(i, j, &Color{float64(i * j), 2000 * float64(i) / 37, .01 * float64(j), 255})
+		}
+	}
+	return fb
+}
+
+func TestHDRRoundTrip(t *testing.T) {
+	formats := []struct {
+		name      string
+		write     func(io.Writer, *Framebuffer) error
+		read      func(io.Reader) (*Framebuffer, error)
+		tolerance float64
+	}{
+		{"pfm", WritePFM, ReadPFM, 1e-6},
+		{"rgbe", WriteRGBE, ReadRGBE, 1.0 / 128},
+		{"exr", func(w io.Writer, f *Framebuffer) error { return WriteEXR(w, f, EXRNone) }, ReadEXR, 1e-6},
+		{"exr zips", func(w io.Writer, f *Framebuffer) error { return WriteEXR(w, f, EXRZips) }, ReadEXR, 1e-6},
+		{"exr zip", func(w io.Writer, f *Framebuffer) error { return WriteEXR(w, f, EXRZip) }, ReadEXR, 1e-6},
+	}
+	fb := testFramebuffer()
+	for _, format := range formats {
+		buf := &bytes.Buffer{}
+		if err := format.write(buf, fb); err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		res, err := format.read(buf)
+		if err != nil {
+			t.Fatalf("%s: %v", format.name, err)
+		}
+		if res.Width != fb.Width || res.Height != fb.Height {
+			t.Fatalf("%s: size %dx%d", format.name, res.Width, res.Height)
+		}
+		for k, c := range fb.Pix {
+			r := res.Pix[k]
+			m := math.Max(c.R, math.Max(c.G, c.B))
+			for _, d := range []float64{r.R - c.R, r.G - c.G, r.B - c.B} {
+				if math.Abs(d) > format.tolerance*m+1e-9 {
+					t.Fatalf("%s: pixel %d is %v, want %v", format.name, k, r, c)
+				}
+			}
+		}
+	}
+}
+
+func TestReadRGBE_BadSize(t *testing.T) {
+	for _, resolution := range []string{"-Y 0 +X 4", "-Y 4 +X -3"} {
+		r := strings.NewReader("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n" + resolution + "\n")
+		if _, err := ReadRGBE(r); err == nil {
+			t.Errorf("ReadRGBE read an image of %s", resolution)
+		}
+	}
+}
+
+func TestReadEXR_BadCompression(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteEXR(buf, testFramebuffer(), EXRNone); err != nil {
+		t.Fatal(err)
+	}
+	// Empty the value of the compression attribute.
+	attr := []byte("compression\x00compression\x00\x01\x00\x00\x00")
+	k := bytes.Index(buf.Bytes(), attr)
+	if k < 0 {
+		t.Fatal("no compression attribute")
+	}
+	b := buf.Bytes()
+	bad := append(append(append([]byte{}, b[:k]...), "compression\x00compression\x00\x00\x00\x00\x00"...), b[k+len(attr)+1:]...)
+	if _, err := ReadEXR(bytes.NewReader(bad)); err == nil {
+		t.Errorf("ReadEXR read an empty compression attribute")
+	}
+}
+
+func TestReadEXR_Corrupt(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fb := testFramebuffer()
+	if err := WriteEXR(buf, fb, EXRNone); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	le := binary.LittleEndian
+	// The offset table is where the first offset points just past it, one
+	// scanline to a block.
+	table := -1
+	for k := 8; k+8 <= len(good); k++ {
+		if le.Uint64(good[k:]) == uint64(k+8*fb.Height) {
+			table = k
+			break
+		}
+	}
+	window := bytes.Index(good, []byte("dataWindow\x00box2i\x00")) + len("dataWindow\x00box2i\x00")
+	if table < 0 || window < len("dataWindow\x00box2i\x00") {
+		t.Fatal("no offset table or dataWindow")
+	}
+	first := int(le.Uint64(good[table:]))
+	for _, tc := range []struct {
+		name    string
+		corrupt func(b []byte) []byte
+	}{
+		{"offset near the largest int", func(b []byte) []byte {
+			le.PutUint64(b[table:], 0x7ffffffffffffffc)
+			return b
+		}},
+		{"offset past the largest int", func(b []byte) []byte {
+			le.PutUint64(b[table:], 0xfffffffffffffff0)
+			return b
+		}},
+		{"block size past the end", func(b []byte) []byte {
+			le.PutUint32(b[first+4:], 0x7ffffff0)
+			return b
+		}},
+		{"window that wraps around", func(b []byte) []byte {
+			le.PutUint32(b[window+4:], 0x80000000)
+			le.PutUint32(b[window+12:], 0x7fffffff)
+			return b
+		}},
+		{"window too large for the file", func(b []byte) []byte {
+			le.PutUint32(b[window+12:], 100000)
+			le.PutUint32(b[window+16:], 100000)
+			return b
+		}},
+		{"short window", func(b []byte) []byte {
+			le.PutUint32(b[window:], 8)
+			return append(append([]byte{}, b[:window+12]...), b[window+20:]...)
+		}},
+	} {
+		bad := tc.corrupt(append([]byte{}, good...))
+		if _, err := ReadEXR(bytes.NewReader(bad)); err == nil {
+			t.Errorf("ReadEXR read a file with a %s", tc.name)
+		}
+	}
+}
+
+func TestReadHDR_TooLarge(t *testing.T) {
+	if _, err := ReadPFM(strings.NewReader("PF\n1000000 1000000\n-1\n")); err == nil {
+		t.Error("ReadPFM read a header of a trillion pixels")
+	}
+	r := strings.NewReader("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 1000000 +X 1000000\n")
+	if _, err := ReadRGBE(r); err == nil {
+		t.Error("ReadRGBE read a header of a trillion pixels")
+	}
+}
+
+func TestHalfToFloat(t *testing.T) {
+	for h, want := range map[uint16]float64{0x3c00: 1, 0xc000: -2, 0x7bff: 65504, 0x0001: math.Ldexp(1, -24), 0x3555: 0.333251953125} {
+		if got := halfToFloat(h); got != want {
+			t.Errorf("halfToFloat(%#x) = %v, want %v", h, got, want)
+		}
+	}
+}
@@ -1,14 +1,10 @@
 package graphics
 
 import (
-	"bufio"
 	"fmt"
 	"image"
 	"image/color"
 	"math"
-	"os"
-	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"github.com/wizgrao/blow/maps"
@@ -74,10 +70,34 @@ type RayTraceMapper struct {
 
 	Lights []Light
 	Mesh []*Triangle
+	// EmissiveSamples is the number of shadow rays towards the emissive
+	// triangles of Mesh, which are lit as a MeshLight.
+	EmissiveSamples int
+	// Environment is seen by rays that miss Mesh, black when nil.
+	Environment Environment
+	// Shapes is traced along with Mesh, nil for none. Put large meshes in
+	// a BVH here rather than in Mesh, which every ray tests triangle by
+	// triangle.
+	Shapes Shape
+
+	// lights is Lights and the MeshLight of Mesh, built once by the first
+	// call to Do and shared by every tile after.
+	lightsOnce sync.Once
+	lights []Light
 }
 
 func (r *RayTraceMapper) Do(k maps.Keyed, outchan chan<- maps.Keyed) {
 	portion := k.(*Portion)
+	r.lightsOnce.Do(func() {
+		r.lights = withMeshLight(r.Lights, r.Mesh, r.EmissiveSamples)
+	})
+	lights := r.lights
+	diff := &rayDiff{
+		Px: zero,
+		Py: zero,
+		Dx: &Vector3{(r.XMax - r.XMin) / float64(r.Width), 0, 0},
+		Dy: &Vector3{0, (r.YMax - r.YMin) / float64(r.Height), 0},
+	}
 	for i:= portion.MinX; i < portion.MaxX; i ++ {
 		for j := portion.MinY; j < portion.MaxY; j ++ {
 			coordx := lin(float64(i), 0, float64(r.Width), r.XMin, r.XMax)
@@ -88,13 +108,26 @@ func (r *RayTraceMapper) Do(k maps.Keyed, outchan chan<- maps.Keyed) {
 			outchan <- &Pixel{
 				I: i,
 				J: j,
-				C: RayCast(r.Mesh, r.Lights, homCoords, r.Bounces),
+				C: rayCast(r.Mesh, r.Shapes, lights, r.Environment, zero, homCoords, diff, r.Bounces),
 			}
 		}
 	}
 
 }
 
+// defaultEmissiveSamples is the number of shadow rays towards the emissive
+// triangles of renderers that take no count.
+const defaultEmissiveSamples = 8
+
+// withMeshLight appends a MeshLight for the emissive triangles of env to
+// lights, if there are any.
+func withMeshLight(lights []Light, env []*Triangle, samples int) []Light {
+	if m := NewMeshLight(env, samples); m != nil {
+		return append(lights[:len(lights):len(lights)], m)
+	}
+	return lights
+}
+
 func (*RayTraceMapper) InEncoder() maps.Encoder {
 	return &PortionEncoder{}
 }
@@ -234,7 +267,7 @@ func (d *DirectionLight) Intensity(_ *Vector3) *Color {
 
 func (d *DirectionLight) Transform(m *Mat4) Light {
 	return &DirectionLight{
-		Direction: m.Dot(d.Direction.Ext()).Dehom(),
+		Direction: m.Dot(d.Direction.Ext()).Unex(),
 		Color:     d.Color,
 	}
 }
@@ -246,16 +279,42 @@ type Material interface {
 	AmbientCoeff(vector2 *Vector2) float64
 }
 
+// Emitter is implemented by materials that give off light of their own.
+type Emitter interface {
+	Emission(*Vector2) *Color
+}
+
+// unlit is the color of a surface before any light reaches it: its ambient
+// term plus whatever it emits.
+func unlit(m Material, uv *Vector2) *Color {
+	ret := ColorScale(m.C(uv), m.AmbientCoeff(uv))
+	if e, ok := m.(Emitter); ok {
+		if c := e.Emission(uv); c != nil {
+			ret = ColorAdd(ret, c)
+		}
+	}
+	return ret
+}
+
 type SolidMaterial struct {
 	Color         *Color
 	SpecColor_    *Color
 	SpecCoeff_    float64
 	AmbientCoeff_ float64
+	Emission_     *Color
+	// Normals, when set, perturbs the shading normal of triangles with UVs.
+	Normals *NormalMap
 }
 
 func (s *SolidMaterial) C(_ *Vector2) *Color {
 	return s.Color
 }
+func (s *SolidMaterial) PerturbNormal(st *Vector2, normal, tangent, bitangent *Vector3) *Vector3 {
+	if s.Normals == nil {
+		return normal
+	}
+	return s.Normals.Perturb(st, normal, tangent, bitangent)
+}
 func (s *SolidMaterial) SpecColor(_ *Vector2) *Color {
 	return s.SpecColor_
 }
@@ -265,29 +324,90 @@ func (s *SolidMaterial) SpecCoeff(_ *Vector2) float64 {
 func (s *SolidMaterial) AmbientCoeff(vector2 *Vector2) float64 {
 	return s.AmbientCoeff_
 }
+func (s *SolidMaterial) Emission(_ *Vector2) *Color {
+	return s.Emission_
+}
 
+// TextureMaterial maps an image onto triangles. The texture coordinates come
+// from P1, P2 and P3, which tie the material to a single triangle, or, when
+// those are nil, from the UV0, UV1 and UV2 of the triangle being shaded so
+// that one material serves a whole mesh.
 type TextureMaterial struct {
 	Im image.Image
-	P1 *Vector2
-	P2 *Vector2
-	P3 *Vector2
+	// Texture, when set, is sampled instead of Im with mipmapping and its
+	// wrap modes. It is usually shared by all the triangles that use the same
+	// image.
+	Texture *Texture
+	P1      *Vector2
+	P2      *Vector2
+	P3      *Vector2
+	// UV, when set, transforms the interpolated texture coordinates.
+	UV *UVTransform
+	// Region, when set, is the part of an atlas Texture that the texture
+	// coordinates span.
+	Region *TextureRegion
+	// Normals, when set, perturbs the shading normal at the same texture
+	// coordinates as the color, after UV.
+	Normals *NormalMap
 
 	SpecColor_    *Color
 	SpecCoeff_    float64
 	AmbientCoeff_ float64
+	Emission_     *Color
 }
 
-func (s *TextureMaterial) C(vec *Vector2) *Color {
+// texCoord interpolates P1, P2 and P3. Without them the material is meant to
+// be shared by triangles with UVs, and falls back to the barycentric uv.
+func (s *TextureMaterial) texCoord(vec *Vector2) *Vector2 {
+	if s.P1 == nil {
+		return vec
+	}
 	u := vec.X
 	v := vec.Y
 	w := 1 - u - v
-	texNormalCoordinate := s.P1.Scale(u).Add(s.P2.Scale(v)).Add(s.P3.Scale(w))
-	texCoordinateX := lin(texNormalCoordinate.X, 0, 1, float64(s.Im.Bounds().Min.X), float64(s.Im.Bounds().Max.X))
-	texCoordinateY := lin(texNormalCoordinate.Y, 0, 1, float64(s.Im.Bounds().Min.Y), float64(s.Im.Bounds().Max.Y))
-	bl := ToColor(s.Im.At(int(math.Floor(texCoordinateX)), int(math.Floor(texCoordinateY))))
-	br := ToColor(s.Im.At(int(math.Ceil(texCoordinateX)), int(math.Floor(texCoordinateY))))
-	tl := ToColor(s.Im.At(int(math.Floor(texCoordinateX)), int(math.Ceil(texCoordinateY))))
-	tr := ToColor(s.Im.At(int(math.Ceil(texCoordinateX)), int(math.Ceil(texCoordinateY))))
+	return s.P1.Scale(u).Add(s.P2.Scale(v)).Add(s.P3.Scale(w))
+}
+
+func (s *TextureMaterial) C(vec *Vector2) *Color {
+	return s.CAt(s.texCoord(vec), nil, nil)
+}
+
+// CFiltered samples over the pixel footprint given by the barycentric
+// derivatives dx and dy.
+func (s *TextureMaterial) CFiltered(vec, dx, dy *Vector2) *Color {
+	if s.P1 == nil {
+		return s.CAt(vec, nil, nil)
+	}
+	// w = 1 - u - v, so dw = -du - dv.
+	deriv := func(d *Vector2) *Vector2 {
+		return s.P1.Scale(d.X).Add(s.P2.Scale(d.Y)).Add(s.P3.Scale(-d.X - d.Y))
+	}
+	return s.CAt(s.texCoord(vec), deriv(dx), deriv(dy))
+}
+
+// CAt looks up texture coordinates st, before UV is applied, filtering over
+// dx and dy when they are given and Texture is set.
+func (s *TextureMaterial) CAt(texNormalCoordinate, dx, dy *Vector2) *Color {
+	if s.UV != nil {
+		texNormalCoordinate = s.UV.Apply(texNormalCoordinate)
+		if dx != nil && dy != nil {
+			dx, dy = s.UV.linear(dx), s.UV.linear(dy)
+		}
+	}
+	if s.Texture != nil {
+		return s.Texture.SampleRegion(s.Region, texNormalCoordinate, dx, dy)
+	}
+	b := s.Im.Bounds()
+	texCoordinateX := lin(texNormalCoordinate.X, 0, 1, float64(b.Min.X), float64(b.Max.X))
+	texCoordinateY := lin(texNormalCoordinate.Y, 0, 1, float64(b.Min.Y), float64(b.Max.Y))
+	x0 := maxi(mini(int(math.Floor(texCoordinateX)), b.Max.X-1), b.Min.X)
+	y0 := maxi(mini(int(math.Floor(texCoordinateY)), b.Max.Y-1), b.Min.Y)
+	x1 := mini(x0+1, b.Max.X-1)
+	y1 := mini(y0+1, b.Max.Y-1)
+	bl := ToColor(s.Im.At(x0, y0))
+	br := ToColor(s.Im.At(x1, y0))
+	tl := ToColor(s.Im.At(x0, y1))
+	tr := ToColor(s.Im.At(x1, y1))
 
 	fracX := texCoordinateX - math.Floor(texCoordinateX)
 	fracY := texCoordinateY - math.Floor(texCoordinateY)
@@ -301,12 +421,22 @@ func (s *TextureMaterial) C(vec *Vector2) *Color {
 func ToColor(c color.Color) *Color {
 	r, g, b, _ := c.RGBA()
 	return &Color{
-		R: float64(r / 256),
-		G: float64(g / 256),
-		B: float64(b / 256),
+		R: float64(r) / 257,
+		G: float64(g) / 257,
+		B: float64(b) / 257,
 		A: 255,
 	}
 }
+func (s *TextureMaterial) PerturbNormal(st *Vector2, normal, tangent, bitangent *Vector3) *Vector3 {
+	if s.Normals == nil {
+		return normal
+	}
+	if s.UV != nil {
+		st = s.UV.Apply(st)
+	}
+	return s.Normals.Perturb(st, normal, tangent, bitangent)
+}
+
 func (s *TextureMaterial) SpecColor(_ *Vector2) *Color {
 	return s.SpecColor_
 }
@@ -316,70 +446,102 @@ func (s *TextureMaterial) SpecCoeff(_ *Vector2) float64 {
 func (s *TextureMaterial) AmbientCoeff(vector2 *Vector2) float64 {
 	return s.AmbientCoeff_
 }
+func (s *TextureMaterial) Emission(_ *Vector2) *Color {
+	return s.Emission_
+}
 
 func Render(m Material, normal, camera *Vector3, lights []Light, v *Vector3, uv *Vector2) *Color {
-	ret := ColorScale(m.C(uv), m.AmbientCoeff(uv))
+	ret := unlit(m, uv)
 	for _, l := range lights {
-		lnorm := l.Norm(v)
-		lintense := l.Intensity(v)
-
-		inc := -normal.Dot(l.Norm(v))
-		if inc < 0 {
-			inc = 0
-		}
-		reflecc := normal.Scale(2 * normal.Dot(l.Norm(v))).Sub(lnorm)
-		specCos := reflecc.Dot(camera)
-		if specCos < 0 {
-			specCos = 0
-		}
-		specColor := ColorMult(ColorScale(m.SpecColor(uv), math.Pow(specCos, m.SpecCoeff(uv))), lintense)
-		diffColor := ColorMult(ColorScale(m.C(uv), inc), lintense)
-		ret = ColorAdd(ret, ColorAdd(specColor, diffColor))
+		ret = ColorAdd(ret, shadeLight(m, normal, camera, l, v, uv))
 	}
 	return ret
 }
 
+// shadeLight is the diffuse and specular contribution of a single light.
+func shadeLight(m Material, normal, camera *Vector3, l Light, v *Vector3, uv *Vector2) *Color {
+	lnorm := l.Norm(v)
+	lintense := l.Intensity(v)
+
+	inc := -normal.Dot(lnorm)
+	if inc < 0 {
+		inc = 0
+	}
+	reflecc := normal.Scale(2 * normal.Dot(lnorm)).Sub(lnorm)
+	specCos := reflecc.Dot(camera)
+	if specCos < 0 {
+		specCos = 0
+	}
+	specColor := ColorMult(ColorScale(m.SpecColor(uv), math.Pow(specCos, m.SpecCoeff(uv))), lintense)
+	diffColor := ColorMult(ColorScale(m.C(uv), inc), lintense)
+	return ColorAdd(specColor, diffColor)
+}
+
 var zero = &Vector3{}
 
 func GetSpecularShadow(env []*Triangle, m Material, camera, normal *Vector3, lights []Light, uv *Vector2) *Color {
-	ret := ColorScale(m.C(uv), m.AmbientCoeff(uv))
+	return getSpecularShadow(env, nil, zero, m, camera, normal, lights, uv)
+}
+
+// getSpecularShadow is GetSpecularShadow with shapes, which may be nil, also
+// casting shadows. Unlike env they are not moved, so at is the shaded point
+// in their coordinates.
+func getSpecularShadow(env []*Triangle, shapes Shape, at *Vector3, m Material, camera, normal *Vector3, lights []Light, uv *Vector2) *Color {
+	ret := unlit(m, uv)
 	for _, l := range lights {
-		shouldrender := true
-		lnorm := l.Norm(zero)
-		for _, tri := range env {
-			intersect := tri.DePerp(lnorm.Dehom()) //interesct is the vector from the surface to the surface in the way of the light
-			if !tri.In(intersect) || intersect.Norm() < .001 {
-				continue
-			}
-			lintersect := l.Norm(intersect) //lintersect is the vector from the light to the norm
-			if lintersect.Dot(intersect) < 0 {
-				shouldrender = false
-				break
+		if al, ok := l.(AreaLight); ok {
+			n := al.SampleCount()
+			for k := 0; k < n; k++ {
+				ret = ColorAdd(ret, ColorScale(specularShadowLight(env, shapes, at, m, camera, normal, al.Sample(zero), uv), 1/float64(n)))
 			}
+			continue
 		}
-		if !shouldrender {
+		ret = ColorAdd(ret, specularShadowLight(env, shapes, at, m, camera, normal, l, uv))
+	}
+	return ret
+}
+
+// specularShadowLight shades the origin with a single light, returning black
+// when any triangle of env or any of shapes lies between the two.
+func specularShadowLight(env []*Triangle, shapes Shape, at *Vector3, m Material, camera, normal *Vector3, l Light, uv *Vector2) *Color {
+	lnorm := l.Norm(zero)
+	for _, tri := range env {
+		intersect := tri.DePerp(lnorm.Dehom()) //interesct is the vector from the surface to the surface in the way of the light
+		if !tri.In(intersect) || intersect.Norm() < .001 {
 			continue
 		}
-		lintense := l.Intensity(zero)
-		inc := -normal.Dot(l.Norm(zero))
-		if inc < 0 {
-			inc = 0
+		lintersect := l.Norm(intersect) //lintersect is the vector from the light to the norm
+		if lintersect.Dot(intersect) < 0 {
+			return &Color{}
 		}
-		diffColor := ColorMult(ColorScale(m.C(uv), inc), lintense)
-		reflecc := normal.Scale(2 * normal.Dot(l.Norm(zero))).Sub(lnorm)
-		specCos := reflecc.Dot(camera)
-		if specCos < 0 {
-			specCos = 0
+	}
+	if shapes != nil {
+		if h := shapes.Intersect(at, lnorm.Scale(-1), shapeEpsilon, math.Inf(1)); h != nil {
+			intersect := h.P.Sub(at)
+			if l.Norm(intersect).Dot(intersect) < 0 {
+				return &Color{}
+			}
 		}
-		specColor := ColorMult(ColorScale(m.SpecColor(uv), math.Pow(specCos, m.SpecCoeff(uv))), lintense)
-
-		ret = ColorAdd(ret, diffColor)
-		ret = ColorAdd(ret, specColor)
 	}
-	return ret
+	return shadeLight(m, normal, camera, l, zero, uv)
 }
 
 func RayCast(env []*Triangle, lights []Light, vec *Vector3, bounce int) *Color {
+	return RayCastEnv(env, lights, nil, vec, bounce)
+}
+
+// RayCastEnv traces like RayCast, returning the color of sky for rays that
+// miss every triangle so that it shows in the background and in reflections.
+func RayCastEnv(env []*Triangle, lights []Light, sky Environment, vec *Vector3, bounce int) *Color {
+	return rayCast(env, nil, lights, sky, zero, vec, nil, bounce)
+}
+
+// rayCast is RayCastEnv with the ray differentials of vec, used to filter
+// textures over the footprint of the pixel, origin, where the ray starts in
+// the coordinates of the scene before it was moved to put the ray at the
+// origin, and shapes, which are not moved and are traced from origin. diff
+// and shapes may be nil.
+func rayCast(env []*Triangle, shapes Shape, lights []Light, sky Environment, origin, vec *Vector3, diff *rayDiff, bounce int) *Color {
 	var mindist float64
 	var mintriangle *Triangle
 	var minInteresction *Vector3
@@ -398,25 +560,58 @@ func RayCast(env []*Triangle, lights []Light, vec *Vector3, bounce int) *Color {
 			minInteresction = intersection
 		}
 	}
-	if mintriangle == nil {
+	var hit *Hit
+	if shapes != nil {
+		tMax := math.Inf(1)
+		if mintriangle != nil {
+			tMax = mindist / vec.Dot(vec)
+		}
+		hit = shapes.Intersect(origin, vec, shapeEpsilon/vec.Norm(), tMax)
+	}
+	if mintriangle == nil && hit == nil {
+		if sky != nil {
+			return sky.At(vec)
+		}
 		return &Color{
 			A: 255,
 		}
 	}
 
-	u, v, w := mintriangle.Bary(minInteresction)
-	norm := mintriangle.N0.Scale(u).Add(mintriangle.N1.Scale(v)).Add(mintriangle.N2.Scale(w)).Normalize()
+	var norm *Vector3
+	var uv *Vector2
+	if hit != nil {
+		minInteresction = hit.P.Sub(origin)
+		norm = hit.shadingNormal()
+		uv = hit.UV
+	} else {
+		u, v, w := mintriangle.Bary(minInteresction)
+		norm = mintriangle.N0.Scale(u).Add(mintriangle.N1.Scale(v)).Add(mintriangle.N2.Scale(w)).Normalize()
+		norm = shadingNormal(mintriangle, &Vector2{u, v}, norm)
+		uv = &Vector2{u, v}
+	}
 	reflect := minInteresction.Sub(norm.Scale(2 * norm.Dot(minInteresction))).Normalize()
 	newLights := make([]Light, len(lights))
 	transform := Translate(-minInteresction.X, -minInteresction.Y, -minInteresction.Z)
 	for i, light := range lights {
 		newLights[i] = light.Transform(transform)
 	}
-	uv := &Vector2{u, v}
 	newEnv := ApplyTransform(env, transform)
-	c := GetSpecularShadow(newEnv, mintriangle.Material, vec.Normalize(), norm, newLights, uv)
+	var m Material
+	var reflectDiff *rayDiff
+	switch {
+	case hit != nil:
+		m = hit.bind()
+	case diff != nil:
+		hx, hy, du, dv := diff.transfer(mintriangle, vec, minInteresction)
+		m = bind(mintriangle.Material, mintriangle, origin, du, dv)
+		reflectDiff = diff.reflect(vec, norm, hx, hy)
+	default:
+		m = bind(mintriangle.Material, mintriangle, origin, nil, nil)
+	}
+	at := origin.Add(minInteresction)
+	c := getSpecularShadow(newEnv, shapes, at, m, vec.Normalize(), norm, newLights, uv)
 	if bounce > 0 {
-		c = ColorAdd(c, ColorMult(RayCast(newEnv, newLights, reflect, bounce-1), mintriangle.Material.SpecColor(uv)))
+		c = ColorAdd(c, ColorMult(rayCast(newEnv, shapes, newLights, sky, at, reflect, reflectDiff, bounce-1), m.SpecColor(uv)))
 	}
 	return c
 
@@ -424,7 +619,7 @@ func RayCast(env []*Triangle, lights []Light, vec *Vector3, bounce int) *Color {
 
 func RenderShadow(t *Triangle, env []*Triangle, m Material, normal, camera, v *Vector3, lights []Light, uv *Vector2) *Color {
 	newenv := ApplyTransform(env, Translate(-v.X, -v.Y, -v.Z))
-	ret := ColorScale(m.C(uv), m.AmbientCoeff(uv))
+	ret := unlit(m, uv)
 
 	for _, l := range lights {
 		shouldrender := true
@@ -464,8 +659,17 @@ func RenderShadow(t *Triangle, env []*Triangle, m Material, normal, camera, v *V
 }
 
 func DrawTrianglesParallel(im *image.RGBA, t []*Triangle, l []Light) {
-	width := im.Rect.Max.X - im.Rect.Min.X
-	height := im.Rect.Max.Y - im.Rect.Min.Y
+	forEachFragment(im.Rect.Dx(), im.Rect.Dy(), t, func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) {
+		im.Set(i, j, Render(m, normal, camera, l, v, uv).ToRGBA())
+	})
+}
+
+// forEachFragment rasterizes t in parallel against a shared width by height
+// z-buffer, calling shade for every fragment that is nearest so far. shade
+// runs while the pixel is locked, so it may write to pixel (i, j) directly.
+// m is the triangle's material, bound to the triangle and pixel footprint if
+// it uses them.
+func forEachFragment(width, height int, t []*Triangle, shade func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2)) {
 	zbuf := make([][]float64, width, width)
 	zbuflock := make([][]sync.Mutex, width, width)
 	wg := sync.WaitGroup{}
@@ -504,7 +708,13 @@ func DrawTrianglesParallel(im *image.RGBA, t []*Triangle, l []Light) {
 					zbuf[i][j] = dePerp.Z
 					u, v, w := tri.Bary(dePerp)
 					norm := tri.N0.Scale(u).Add(tri.N1.Scale(v)).Add(tri.N2.Scale(w)).Normalize()
-					im.Set(i, j, Render(tri.Material, norm, screenCoord.Hom().Normalize(), l, dePerp, &Vector2{u, v}).ToRGBA())
+					norm = shadingNormal(tri, &Vector2{u, v}, norm)
+					var dx, dy *Vector2
+					if needsFootprint(tri.Material) {
+						dx, dy = screenFootprint(tri, coordx, coordy, 2/float64(width), 2/float64(height))
+					}
+					m := bind(tri.Material, tri, zero, dx, dy)
+					shade(i, j, tri, m, dePerp, norm, screenCoord.Hom().Normalize(), &Vector2{u, v})
 
 					zbuflock[i][j].Unlock()
 
@@ -557,7 +767,7 @@ func DrawTrianglesParallelFaster(im *image.RGBA, t []*Triangle, l []Light) {
 					zbuf[i][j] = dePerp.Z
 					u, v, w := tri.Bary(dePerp)
 					norm := tri.N0.Scale(u).Add(tri.N1.Scale(v)).Add(tri.N2.Scale(w)).FastNormalize()
-					im.Set(i, j, Render(tri.Material, norm, screenCoord.Hom().FastNormalize(), l, dePerp, &Vector2{u, v}).ToRGBA())
+					im.Set(i, j, Render(bind(tri.Material, tri, zero, nil, nil), norm, screenCoord.Hom().FastNormalize(), l, dePerp, &Vector2{u, v}).ToRGBA())
 
 					zbuflock[i][j].Unlock()
 				}
@@ -611,7 +821,7 @@ func DrawTrianglesParallelShadow(im *image.RGBA, t []*Triangle, l []Light) {
 					zbuf[i][j] = dePerp.Z
 					u, v, w := tri.Bary(dePerp)
 					norm := tri.N0.Scale(u).Add(tri.N1.Scale(v)).Add(tri.N2.Scale(w)).Normalize()
-					im.Set(i, j, RenderShadow(tri, t, tri.Material, norm, screenCoord.Hom().Normalize(), dePerp, l, &Vector2{u, v}).ToRGBA())
+					im.Set(i, j, RenderShadow(tri, t, bind(tri.Material, tri, zero, nil, nil), norm, screenCoord.Hom().Normalize(), dePerp, l, &Vector2{u, v}).ToRGBA())
 					zbuflock[i][j].Unlock()
 
 				}
@@ -626,6 +836,7 @@ func DrawTrianglesParallelShadow(im *image.RGBA, t []*Triangle, l []Light) {
 func DrawTrianglesRayTracer(im *image.RGBA, t []*Triangle, l []Light) {
 	width := im.Rect.Max.X - im.Rect.Min.X
 	height := im.Rect.Max.Y - im.Rect.Min.Y
+	l = withMeshLight(l, t, defaultEmissiveSamples)
 	wg := sync.WaitGroup{}
 	for i := 0; i < width; i++ {
 		for j := 0; j < height; j++ {
@@ -680,101 +891,14 @@ func ColorScale(c *Color, s float64) *Color {
 	}
 }
 
+// OpenObj reads the triangles of an OBJ file, which share their vertices.
+// See OpenObjMesh.
 func OpenObj(filename string, rgba *Color) ([]*Triangle, error) {
-	f, err := os.Open(filename)
+	m, err := OpenObjMesh(filename, rgba)
 	if err != nil {
 		return nil, err
 	}
-
-	reader := bufio.NewScanner(f)
-	reader.Split(bufio.ScanWords)
-	var points []*Vector3
-	var normals []*Vector3
-	var triangles []*Triangle
-
-	for reader.Scan() {
-		t := reader.Text()
-		if t == "v" {
-			reader.Scan()
-			xs := reader.Text()
-			reader.Scan()
-			ys := reader.Text()
-			reader.Scan()
-			zs := reader.Text()
-
-			x, _ := strconv.ParseFloat(xs, 64)
-			y, _ := strconv.ParseFloat(ys, 64)
-			z, _ := strconv.ParseFloat(zs, 64)
-
-			points = append(points, &Vector3{x, y, z})
-		}
-		if t == "vn" {
-			reader.Scan()
-			xs := reader.Text()
-			reader.Scan()
-			ys := reader.Text()
-			reader.Scan()
-			zs := reader.Text()
-
-			x, _ := strconv.ParseFloat(xs, 64)
-			y, _ := strconv.ParseFloat(ys, 64)
-			z, _ := strconv.ParseFloat(zs, 64)
-
-			normals = append(normals, &Vector3{x, y, z})
-		}
-		if t == "f" {
-			var xn, yn, zn string
-			reader.Scan()
-			val := strings.Split(reader.Text(), "/")
-			xs := val[0]
-			if len(val) == 3 {
-				xn = val[2]
-			} else {
-				xn = "0"
-			}
-			reader.Scan()
-			val = strings.Split(reader.Text(), "/")
-			ys := val[0]
-			if len(val) == 3 {
-				yn = val[2]
-			} else {
-				yn = "0"
-			}
-			reader.Scan()
-			val = strings.Split(reader.Text(), "/")
-			zs := val[0]
-			if len(val) == 3 {
-				zn = val[2]
-			} else {
-				zn = "0"
-			}
-			x, _ := strconv.ParseInt(xs, 10, 32)
-			y, _ := strconv.ParseInt(ys, 10, 32)
-			z, _ := strconv.ParseInt(zs, 10, 32)
-			xnn, _ := strconv.ParseInt(xn, 10, 32)
-			ynn, _ := strconv.ParseInt(yn, 10, 32)
-			znn, _ := strconv.ParseInt(zn, 10, 32)
-			t := NewTriangle(points[x-1], points[y-1], points[z-1], &SolidMaterial{
-				Color:         rgba,
-				SpecColor_:    &Color{10, 10, 10, 255},
-				SpecCoeff_:    8,
-				AmbientCoeff_: .01,
-			})
-			if xnn != 0 {
-				t.N0 = normals[xnn-1]
-				t.N1 = normals[ynn-1]
-				t.N2 = normals[znn-1]
-			} else {
-				t.N0 = t.Norm
-				t.N1 = t.Norm
-				t.N2 = t.Norm
-			}
-			triangles = append(triangles, t)
-
-		}
-	}
-	return triangles, nil
-
+	return m.Triangles(), nil
 }
 
 func lin(p, mini, maxi, mino, maxo float64) float64 {
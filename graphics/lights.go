@@ -0,0 +1,242 @@
+package graphics
+
+import (
+	"math"
+	"math/rand"
+)
+
+// AreaLight is a Light with an emitting surface. The ray tracer averages
+// SampleCount lights returned by Sample to produce soft shadows, while the
+// rasterizer uses the light as a point emitter at its center.
+type AreaLight interface {
+	Light
+	SampleCount() int
+	// Sample picks a random point on the surface and returns a point light
+	// there carrying the intensity it sends towards v.
+	Sample(v *Vector3) Light
+}
+
+// SpotLight is a point light restricted to a cone around Direction. The
+// intensity is full inside InnerAngle, zero outside OuterAngle, and falls off
+// in between with the exponent Falloff (1 when unset).
+type SpotLight struct {
+	Location   *Vector3
+	Direction  *Vector3
+	InnerAngle float64
+	OuterAngle float64
+	Falloff    float64
+	R          float64
+	G          float64
+	B          float64
+}
+
+func (s *SpotLight) Norm(v *Vector3) *Vector3 {
+	return v.Sub(s.Location).Normalize()
+}
+
+func (s *SpotLight) Intensity(v *Vector3) *Color {
+	d := v.Sub(s.Location)
+	dist := d.Norm()
+	cos := d.Dot(s.Direction) / (dist * s.Direction.Norm())
+	cosInner := math.Cos(s.InnerAngle)
+	cosOuter := math.Cos(s.OuterAngle)
+	var spot float64
+	switch {
+	case cos >= cosInner:
+		spot = 1
+	case cos > cosOuter:
+		falloff := s.Falloff
+		if falloff == 0 {
+			falloff = 1
+		}
+		spot = math.Pow((cos-cosOuter)/(cosInner-cosOuter), falloff)
+	}
+	return &Color{
+		R: spot * s.R / (dist * dist),
+		G: spot * s.G / (dist * dist),
+		B: spot * s.B / (dist * dist),
+		A: 255,
+	}
+}
+
+func (s *SpotLight) Transform(m *Mat4) Light {
+	return &SpotLight{
+		Location:   m.Dot(s.Location.Hom()).Dehom(),
+		Direction:  m.Dot(s.Direction.Ext()).Unex(),
+		InnerAngle: s.InnerAngle,
+		OuterAngle: s.OuterAngle,
+		Falloff:    s.Falloff,
+		R:          s.R,
+		G:          s.G,
+		B:          s.B,
+	}
+}
+
+// RectLight is a one sided rectangular emitter spanning Center ± U ± V. It
+// emits towards Cross(U, V).
+type RectLight struct {
+	Center  *Vector3
+	U       *Vector3
+	V       *Vector3
+	R       float64
+	G       float64
+	B       float64
+	Samples int
+}
+
+func (r *RectLight) Norm(v *Vector3) *Vector3 {
+	return v.Sub(r.Center).Normalize()
+}
+
+func (r *RectLight) Intensity(v *Vector3) *Color {
+	return planarIntensity(r.Center, Cross(r.U, r.V).Normalize(), v, r.R, r.G, r.B)
+}
+
+func (r *RectLight) Transform(m *Mat4) Light {
+	return &RectLight{
+		Center:  m.Dot(r.Center.Hom()).Dehom(),
+		U:       m.Dot(r.U.Ext()).Unex(),
+		V:       m.Dot(r.V.Ext()).Unex(),
+		R:       r.R,
+		G:       r.G,
+		B:       r.B,
+		Samples: r.Samples,
+	}
+}
+
+func (r *RectLight) SampleCount() int {
+	return maxi(r.Samples, 1)
+}
+
+func (r *RectLight) Sample(v *Vector3) Light {
+	p := r.Center.
+		Add(r.U.Scale(2*rand.Float64() - 1)).
+		Add(r.V.Scale(2*rand.Float64() - 1))
+	return planarSample(p, Cross(r.U, r.V).Normalize(), v, r.R, r.G, r.B)
+}
+
+// DiskLight is a one sided circular emitter facing Normal.
+type DiskLight struct {
+	Center  *Vector3
+	Normal  *Vector3
+	Radius  float64
+	R       float64
+	G       float64
+	B       float64
+	Samples int
+}
+
+func (d *DiskLight) Norm(v *Vector3) *Vector3 {
+	return v.Sub(d.Center).Normalize()
+}
+
+func (d *DiskLight) Intensity(v *Vector3) *Color {
+	return planarIntensity(d.Center, d.Normal.Normalize(), v, d.R, d.G, d.B)
+}
+
+func (d *DiskLight) Transform(m *Mat4) Light {
+	return &DiskLight{
+		Center:  m.Dot(d.Center.Hom()).Dehom(),
+		Normal:  m.Dot(d.Normal.Ext()).Unex().Normalize(),
+		Radius:  d.Radius,
+		R:       d.R,
+		G:       d.G,
+		B:       d.B,
+		Samples: d.Samples,
+	}
+}
+
+func (d *DiskLight) SampleCount() int {
+	return maxi(d.Samples, 1)
+}
+
+func (d *DiskLight) Sample(v *Vector3) Light {
+	n := d.Normal.Normalize()
+	t, b := orthoBasis(n)
+	r := d.Radius * math.Sqrt(rand.Float64())
+	phi := 2 * math.Pi * rand.Float64()
+	p := d.Center.Add(t.Scale(r * math.Cos(phi))).Add(b.Scale(r * math.Sin(phi)))
+	return planarSample(p, n, v, d.R, d.G, d.B)
+}
+
+// SphereLight is a spherical emitter that radiates equally in every
+// direction.
+type SphereLight struct {
+	Center  *Vector3
+	Radius  float64
+	R       float64
+	G       float64
+	B       float64
+	Samples int
+}
+
+func (s *SphereLight) Norm(v *Vector3) *Vector3 {
+	return v.Sub(s.Center).Normalize()
+}
+
+func (s *SphereLight) Intensity(v *Vector3) *Color {
+	return (&PointLight{Location: s.Center, R: s.R, G: s.G, B: s.B}).Intensity(v)
+}
+
+func (s *SphereLight) Transform(m *Mat4) Light {
+	return &SphereLight{
+		Center:  m.Dot(s.Center.Hom()).Dehom(),
+		Radius:  s.Radius,
+		R:       s.R,
+		G:       s.G,
+		B:       s.B,
+		Samples: s.Samples,
+	}
+}
+
+func (s *SphereLight) SampleCount() int {
+	return maxi(s.Samples, 1)
+}
+
+// Sample picks a point on the hemisphere facing v. Weighting by twice the
+// cosine keeps the average equal to a point light at the center.
+func (s *SphereLight) Sample(v *Vector3) Light {
+	dir := randomUnitVector()
+	if dir.Dot(v.Sub(s.Center)) < 0 {
+		dir = dir.Scale(-1)
+	}
+	return planarSample(s.Center.Add(dir.Scale(s.Radius)), dir, v, 2*s.R, 2*s.G, 2*s.B)
+}
+
+func randomUnitVector() *Vector3 {
+	z := 2*rand.Float64() - 1
+	phi := 2 * math.Pi * rand.Float64()
+	r := math.Sqrt(1 - z*z)
+	return &Vector3{r * math.Cos(phi), r * math.Sin(phi), z}
+}
+
+// planarIntensity is the intensity at v of an emitter at p whose output
+// falls off with the cosine to its normal n.
+func planarIntensity(p, n, v *Vector3, r, g, b float64) *Color {
+	d := v.Sub(p)
+	dist := d.Norm()
+	cos := n.Dot(d) / dist
+	if cos < 0 {
+		cos = 0
+	}
+	s := cos / (dist * dist)
+	return &Color{
+		R: r * s,
+		G: g * s,
+		B: b * s,
+		A: 255,
+	}
+}
+
+func planarSample(p, n, v *Vector3, r, g, b float64) Light {
+	cos := n.Dot(v.Sub(p).Normalize())
+	if cos < 0 {
+		cos = 0
+	}
+	return &PointLight{
+		Location: p,
+		R:        r * cos,
+		G:        g * cos,
+		B:        b * cos,
+	}
+}
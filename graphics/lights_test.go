@@ -0,0 +1,56 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDirectionLight_Transform(t *testing.T) {
+	d := &DirectionLight{Direction: &Vector3{0, 0, 1}, Color: White}
+	// A direction is not a point: the translation must not move it, and it
+	// has no homogeneous coordinate to divide by.
+	l := d.Transform(Translate(3, -2, 5).Mult(RotY(math.Pi / 2))).(*DirectionLight)
+	if want := (&Vector3{-1, 0, 0}); !(l.Direction.Sub(want).Norm() <= 1e-9) {
+		t.Errorf("turned direction is %v, want %v", l.Direction, want)
+	}
+}
+
+func TestSpotLight_Intensity(t *testing.T) {
+	s := &SpotLight{
+		Location:   &Vector3{0, 0, 0},
+		Direction:  &Vector3{0, 0, 1},
+		InnerAngle: math.Pi / 8,
+		OuterAngle: math.Pi / 4,
+		R:          100,
+	}
+	if c := s.Intensity(&Vector3{0, 0, 1}); c.R != 100 {
+		t.Errorf("intensity on axis is %v, want 100", c.R)
+	}
+	if c := s.Intensity(&Vector3{1, 0, .1}); c.R != 0 {
+		t.Errorf("intensity outside cone is %v, want 0", c.R)
+	}
+	edge := s.Intensity(&Vector3{math.Tan(3 * math.Pi / 16), 0, 1})
+	if edge.R <= 0 || edge.R >= 100 {
+		t.Errorf("intensity in penumbra is %v, want between 0 and 100", edge.R)
+	}
+}
+
+func TestAreaLight_Sample(t *testing.T) {
+	v := &Vector3{0, 10, 0}
+	lights := []AreaLight{
+		&RectLight{Center: zero, U: &Vector3{0, 0, .5}, V: &Vector3{.5, 0, 0}, R: 100},
+		&DiskLight{Center: zero, Normal: &Vector3{0, 1, 0}, Radius: .5, R: 100},
+		&SphereLight{Center: zero, Radius: .5, R: 100},
+	}
+	for _, l := range lights {
+		want := l.Intensity(v).R
+		var sum float64
+		n := 20000
+		for k := 0; k < n; k++ {
+			sum += l.Sample(v).Intensity(v).R
+		}
+		if got := sum / float64(n); math.Abs(got-want) > .05*want {
+			t.Errorf("%T: mean sampled intensity %v, want about %v", l, got, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package graphics
+
+import (
+	"math"
+	"sort"
+)
+
+// EdgeKind is a set of the kinds of edges DrawLines draws.
+type EdgeKind int
+
+const (
+	// EdgesAll is every edge of every triangle, a wireframe.
+	EdgesAll EdgeKind = 1 << iota
+	// EdgesSilhouette is the edges between a face turned toward the eye and
+	// one turned away, the outline of the model.
+	EdgesSilhouette
+	// EdgesCrease is the edges where faces meet at more than the crease
+	// angle.
+	EdgesCrease
+	// EdgesBoundary is the edges of open meshes with a face on one side
+	// only.
+	EdgesBoundary
+)
+
+// LineOptions are the options of DrawLines. The zero LineOptions draw every
+// edge one pixel wide in black, hiding those behind the triangles.
+type LineOptions struct {
+	// Edges is the kinds of edges to draw, every edge when zero.
+	Edges EdgeKind
+	// CreaseAngle is the angle in radians that faces meet at beyond which
+	// their edge is a crease, 30 degrees when zero.
+	CreaseAngle float64
+	Color       *Color
+	// Width is the width of the lines in pixels, 1 when zero.
+	Width float64
+	// ShowHidden draws the lines behind the triangles as well.
+	ShowHidden bool
+	// Occluders are triangles that hide lines besides those the lines are
+	// drawn from, such as the rest of the scene.
+	Occluders []*Triangle
+}
+
+// DrawLines draws the edges of t chosen by opts over what f holds, lines
+// over shaded triangles for a technical illustration, or over a plain
+// background for lines alone. Points joined by edges are found by position,
+// so t need not share vertices.
+func (f *Framebuffer) DrawLines(t []*Triangle, opts *LineOptions) {
+	if opts == nil {
+		opts = &LineOptions{}
+	}
+	col, width := opts.Color, opts.Width
+	if col == nil {
+		col = &Color{A: 255}
+	}
+	if width == 0 {
+		width = 1
+	}
+	m := NewMesh(t)
+	var depth []float64
+	if !opts.ShowHidden {
+		depth = f.depth(append(append([]*Triangle{}, t...), opts.Occluders...))
+	}
+
+	// Each pixel takes the most coverage any line gives it, so crossing and
+	// overlapping lines do not darken each other.
+	coverage := make([]float64, f.Width*f.Height)
+	for _, e := range m.lineEdges(opts) {
+		f.coverLine(coverage, depth, m.Positions[e[0]], m.Positions[e[1]], width)
+	}
+	for k, a := range coverage {
+		if a > 0 {
+			c := f.Pix[k]
+			f.Pix[k] = ColorAdd(ColorScale(c, 1-a), ColorScale(col, a))
+			f.Pix[k].A = c.A
+		}
+	}
+}
+
+// lineEdges returns the edges of m of the kinds opts draws, in order.
+func (m *Mesh) lineEdges(opts *LineOptions) []Edge {
+	kinds := opts.Edges
+	if kinds == 0 {
+		kinds = EdgesAll
+	}
+	angle := opts.CreaseAngle
+	if angle == 0 {
+		angle = math.Pi / 6
+	}
+	var creases map[Edge]bool
+	if kinds&EdgesCrease != 0 {
+		creases = m.SharpEdges(angle)
+	}
+	var normals []*Vector3
+	if kinds&EdgesSilhouette != 0 {
+		normals, _ = m.faceNormals()
+	}
+	// front reports whether face i is turned toward the eye at the origin.
+	front := func(i int) bool {
+		a, _, _ := m.face(i)
+		return normals[i] != nil && normals[i].Dot(a) < 0
+	}
+
+	var ret []Edge
+	for e, faces := range m.EdgeFaces() {
+		switch {
+		case kinds&EdgesAll != 0,
+			kinds&EdgesBoundary != 0 && len(faces) == 1,
+			kinds&EdgesCrease != 0 && creases[e]:
+		case kinds&EdgesSilhouette != 0 && len(faces) == 2 && front(faces[0]) != front(faces[1]):
+		default:
+			continue
+		}
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i][0] < ret[j][0] || ret[i][0] == ret[j][0] && ret[i][1] < ret[j][1]
+	})
+	return ret
+}
+
+// depth returns the depth of the nearest of t at every pixel of f, infinite
+// where there is none.
+func (f *Framebuffer) depth(t []*Triangle) []float64 {
+	ret := make([]float64, f.Width*f.Height)
+	for k := range ret {
+		ret[k] = math.Inf(1)
+	}
+	forEachFragment(f.Width, f.Height, t, func(i, j int, _ *Triangle, _ Material, v, _, _ *Vector3, _ *Vector2) {
+		ret[j*f.Width+i] = v.Z
+	})
+	return ret
+}
+
+// lineNear is how close to the eye lines are cut off.
+const lineNear = 1e-3
+
+// coverLine adds the line from a to b, width pixels wide, to coverage,
+// leaving out the parts further than depth, when not nil, says is visible.
+func (f *Framebuffer) coverLine(coverage, depth []float64, a, b *Vector3, width float64) {
+	// Cut off the part behind the eye.
+	if a.Z < lineNear && b.Z < lineNear {
+		return
+	}
+	if a.Z < lineNear {
+		a = b.Add(a.Sub(b).Scale((b.Z - lineNear) / (b.Z - a.Z)))
+	} else if b.Z < lineNear {
+		b = a.Add(b.Sub(a).Scale((a.Z - lineNear) / (a.Z - b.Z)))
+	}
+	// pixel is where p lands in pixel coordinates, those the rasterizer
+	// samples being whole.
+	pixel := func(p *Vector3) *Vector2 {
+		s := p.Dehom()
+		return &Vector2{lin(s.X, -1, 1, 0, float64(f.Width)), lin(s.Y, -1, 1, 0, float64(f.Height))}
+	}
+	pa, pb := pixel(a), pixel(b)
+	r := width / 2
+	// Clip the line on screen to the framebuffer and the width of the line
+	// around it, as s0 to s1 of the way from pa to pb.
+	s0, s1 := 0.0, 1.0
+	d := pb.Sub(pa)
+	for _, c := range [][3]float64{
+		{-d.X, pa.X + r + 1},
+		{d.X, float64(f.Width) + r + 1 - pa.X},
+		{-d.Y, pa.Y + r + 1},
+		{d.Y, float64(f.Height) + r + 1 - pa.Y},
+	} {
+		// Inside is where s*c[0] <= c[1].
+		switch {
+		case c[0] == 0:
+			if c[1] < 0 {
+				return
+			}
+		case c[0] < 0:
+			s0 = math.Max(s0, c[1]/c[0])
+		default:
+			s1 = math.Min(s1, c[1]/c[0])
+		}
+	}
+	if s0 > s1 {
+		return
+	}
+	steps := int(math.Ceil((s1-s0)*math.Hypot(d.X, d.Y)*2)) + 1
+	for n := 0; n <= steps; n++ {
+		s := s0 + (s1-s0)*float64(n)/float64(steps)
+		p := pa.Add(d.Scale(s))
+		if depth != nil {
+			// The depth along the line, whose inverse is linear on screen.
+			z := 1 / ((1-s)/a.Z + s/b.Z)
+			if !f.visible(depth, p, z) {
+				continue
+			}
+		}
+		for i := int(math.Floor(p.X - r - 1)); i <= int(math.Ceil(p.X+r+1)); i++ {
+			for j := int(math.Floor(p.Y - r - 1)); j <= int(math.Ceil(p.Y+r+1)); j++ {
+				if i < 0 || j < 0 || i >= f.Width || j >= f.Height {
+					continue
+				}
+				// Coverage falls off over the pixel at the edge of the line.
+				dist := math.Hypot(float64(i)-p.X, float64(j)-p.Y)
+				if c := math.Min(r+.5-dist, 1); c > coverage[j*f.Width+i] {
+					coverage[j*f.Width+i] = c
+				}
+			}
+		}
+	}
+}
+
+// visible reports whether the point of a line at p in pixel coordinates, z
+// from the eye, is in front of the surfaces in depth. It is tested against
+// the farthest of the pixels around p, as the line runs along the edges of
+// the very triangles in depth.
+func (f *Framebuffer) visible(depth []float64, p *Vector2, z float64) bool {
+	ci, cj := int(math.Round(p.X)), int(math.Round(p.Y))
+	far := 0.0
+	for i := ci - 1; i <= ci+1; i++ {
+		for j := cj - 1; j <= cj+1; j++ {
+			if i < 0 || j < 0 || i >= f.Width || j >= f.Height {
+				return true
+			}
+			far = math.Max(far, depth[j*f.Width+i])
+		}
+	}
+	return z <= far*(1+1e-3)
+}
@@ -0,0 +1,76 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFramebuffer_DrawLines(t *testing.T) {
+	place := Translate(0, 0, 5).Mult(RotY(.5)).Mult(RotX(.4))
+	cube := ApplyTransform(Cube(&SolidMaterial{}), place)
+	m := NewMesh(cube)
+	for _, tc := range []struct {
+		kinds EdgeKind
+		want  int
+	}{
+		{0, 18},
+		{EdgesCrease, 12},
+		{EdgesSilhouette, 6},
+		{EdgesBoundary, 0},
+		{EdgesSilhouette | EdgesBoundary, 6},
+	} {
+		if n := len(m.lineEdges(&LineOptions{Edges: tc.kinds})); n != tc.want {
+			t.Errorf("cube has %d edges of kinds %b, want %d", n, tc.kinds, tc.want)
+		}
+	}
+	if n := len(NewMesh(Plane(4, &SolidMaterial{})).lineEdges(&LineOptions{Edges: EdgesBoundary})); n != 16 {
+		t.Errorf("plane has %d boundary edges, want 16", n)
+	}
+
+	// The corner of the cube furthest from the eye is hidden, and the
+	// nearest is not.
+	near, far := &Vector3{Z: math.Inf(1)}, &Vector3{}
+	for _, p := range m.Positions {
+		if p.Norm() < near.Norm() {
+			near = p
+		}
+		if p.Norm() > far.Norm() {
+			far = p
+		}
+	}
+	const size = 64
+	at := func(f *Framebuffer, p *Vector3) *Color {
+		s := p.Dehom()
+		return f.At(int(math.Round(lin(s.X, -1, 1, 0, size))), int(math.Round(lin(s.Y, -1, 1, 0, size))))
+	}
+	dark := func(f *Framebuffer) int {
+		n := 0
+		for _, c := range f.Pix {
+			if c.R < 128 {
+				n++
+			}
+		}
+		return n
+	}
+	white := &SolidEnvironment{White}
+	for _, hidden := range []bool{false, true} {
+		f := NewFramebuffer(size, size)
+		f.DrawBackground(white)
+		f.DrawLines(cube, &LineOptions{ShowHidden: hidden})
+		if c := at(f, near); c.R > 128 {
+			t.Errorf("nearest corner is %v, want dark", c)
+		}
+		if c := at(f, far); (c.R == 255) != !hidden {
+			t.Errorf("furthest corner is %v with hidden lines shown %v", c, hidden)
+		}
+	}
+
+	thin, wide := NewFramebuffer(size, size), NewFramebuffer(size, size)
+	thin.DrawBackground(white)
+	wide.DrawBackground(white)
+	thin.DrawLines(cube, &LineOptions{Edges: EdgesSilhouette})
+	wide.DrawLines(cube, &LineOptions{Edges: EdgesSilhouette, Width: 4, Color: &Color{0, 0, 255, 255}})
+	if a, b := dark(thin), dark(wide); a == 0 || b < 3*a {
+		t.Errorf("%d pixels of the outline one wide and %d four wide", a, b)
+	}
+}
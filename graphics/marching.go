@@ -0,0 +1,231 @@
+package graphics
+
+import "math"
+
+// The corners of a marching cubes cell are numbered by their offsets, bit 0
+// for X, 1 for Y and 2 for Z, and its edges by mcEdges.
+var mcEdges = func() [][2]int {
+	var ret [][2]int
+	for axis := 0; axis < 3; axis++ {
+		for c := 0; c < 8; c++ {
+			if c&(1<<axis) == 0 {
+				ret = append(ret, [2]int{c, c | 1<<axis})
+			}
+		}
+	}
+	return ret
+}()
+
+// mcTable lists, for every pattern of corners inside the surface, the
+// triangles of the surface through the cell as triples of edges. Rather than
+// the usual hand written table, it is built by tracing the surface across
+// each face of the cell and fanning out the loops. Faces with two opposite
+// corners inside are always cut so as to separate them, which, depending
+// only on the face, agrees between neighboring cells and keeps the mesh
+// closed.
+var mcTable = func() [256][][3]int {
+	edgeOf := map[[2]int]int{}
+	for i, e := range mcEdges {
+		edgeOf[e] = i
+		edgeOf[[2]int{e[1], e[0]}] = i
+	}
+	var faces [][4]int
+	for axis := 0; axis < 3; axis++ {
+		b, c := 1<<((axis+1)%3), 1<<((axis+2)%3)
+		for side := 0; side < 2; side++ {
+			o := side << axis
+			faces = append(faces, [4]int{o, o | b, o | b | c, o | c})
+		}
+	}
+
+	onFace := func(a, b int) bool {
+		for _, f := range faces {
+			in := 0
+			for _, c := range f {
+				for _, e := range [][2]int{mcEdges[a], mcEdges[b]} {
+					if c == e[0] || c == e[1] {
+						in++
+					}
+				}
+			}
+			if in == 4 {
+				return true
+			}
+		}
+		return false
+	}
+
+	var table [256][][3]int
+	for pattern := range table {
+		inside := func(corner int) bool { return pattern&(1<<corner) != 0 }
+		// next links the crossed edges along the surface, two per edge.
+		next := map[int][]int{}
+		link := func(a, b int) {
+			next[a] = append(next[a], b)
+			next[b] = append(next[b], a)
+		}
+		for _, f := range faces {
+			var crossed []int
+			for k := range f {
+				if inside(f[k]) != inside(f[(k+1)%4]) {
+					crossed = append(crossed, edgeOf[[2]int{f[k], f[(k+1)%4]}])
+				}
+			}
+			switch len(crossed) {
+			case 2:
+				link(crossed[0], crossed[1])
+			case 4:
+				// Cut off each inside corner with the two edges next
+				// to it.
+				for k := range f {
+					if inside(f[k]) {
+						link(edgeOf[[2]int{f[(k+3)%4], f[k]}], edgeOf[[2]int{f[k], f[(k+1)%4]}])
+					}
+				}
+			}
+		}
+		done := map[int]bool{}
+		for e := range mcEdges {
+			if len(next[e]) == 0 || done[e] {
+				continue
+			}
+			loop := []int{e}
+			done[e] = true
+			for prev, cur := e, next[e][0]; cur != e; {
+				loop = append(loop, cur)
+				done[cur] = true
+				n := next[cur][0]
+				if n == prev {
+					n = next[cur][1]
+				}
+				prev, cur = cur, n
+			}
+			// Fan out from the corner with the fewest diagonals lying in a
+			// face of the cell, which the cell on the other side of the
+			// face could fan across as well.
+			best, fewest := 0, len(loop)
+			for a := range loop {
+				n := 0
+				for k := 2; k+1 < len(loop); k++ {
+					if onFace(loop[a], loop[(a+k)%len(loop)]) {
+						n++
+					}
+				}
+				if n < fewest {
+					best, fewest = a, n
+				}
+			}
+			loop = append(loop[best:], loop[:best]...)
+			for k := 1; k+1 < len(loop); k++ {
+				table[pattern] = append(table[pattern], [3]int{loop[0], loop[k], loop[k+1]})
+			}
+		}
+	}
+	return table
+}()
+
+// MarchingCubes polygonizes the surface where field is iso within bounds,
+// with field less than iso inside. The bounds are split into cubic cells,
+// resolution along their longest side. Triangles share the points they have
+// in common, and their normals are the gradient of field, so that an SDF
+// gives normals pointing out.
+func MarchingCubes(field func(p *Vector3) float64, bounds *Bounds, resolution int, iso float64, mat Material) []*Triangle {
+	size := bounds.Max.Sub(bounds.Min)
+	cell := max3(size.X, size.Y, size.Z) / float64(resolution)
+	nx := int(math.Ceil(size.X/cell - 1e-9))
+	ny := int(math.Ceil(size.Y/cell - 1e-9))
+	nz := int(math.Ceil(size.Z/cell - 1e-9))
+	index := func(i, j, k int) int {
+		return (k*(ny+1)+j)*(nx+1) + i
+	}
+	point := func(i, j, k int) *Vector3 {
+		return bounds.Min.Add(&Vector3{float64(i) * cell, float64(j) * cell, float64(k) * cell})
+	}
+	values := make([]float64, (nx+1)*(ny+1)*(nz+1))
+	for k := 0; k <= nz; k++ {
+		for j := 0; j <= ny; j++ {
+			for i := 0; i <= nx; i++ {
+				v := field(point(i, j, k)) - iso
+				if v == 0 {
+					// Keep vertices off the grid points, where the
+					// triangles of neighboring edges would collapse.
+					v = 1e-9 * cell
+				}
+				values[index(i, j, k)] = v
+			}
+		}
+	}
+
+	h := cell * .01
+	gradient := func(p *Vector3) *Vector3 {
+		return (&Vector3{
+			field(&Vector3{p.X + h, p.Y, p.Z}) - field(&Vector3{p.X - h, p.Y, p.Z}),
+			field(&Vector3{p.X, p.Y + h, p.Z}) - field(&Vector3{p.X, p.Y - h, p.Z}),
+			field(&Vector3{p.X, p.Y, p.Z + h}) - field(&Vector3{p.X, p.Y, p.Z - h}),
+		}).Normalize()
+	}
+	// The vertices on each edge of the grid, keyed by the index of its
+	// lower end and its axis.
+	type vertex struct{ p, n *Vector3 }
+	vertices := map[int]*vertex{}
+
+	var ret []*Triangle
+	for k := 0; k < nz; k++ {
+		for j := 0; j < ny; j++ {
+			for i := 0; i < nx; i++ {
+				pattern := 0
+				for c := 0; c < 8; c++ {
+					if values[index(i+c&1, j+c>>1&1, k+c>>2&1)] < 0 {
+						pattern |= 1 << c
+					}
+				}
+				tris := mcTable[pattern]
+				if len(tris) == 0 {
+					continue
+				}
+				edgeVertex := func(e int) *vertex {
+					a, b := mcEdges[e][0], mcEdges[e][1]
+					ia, ja, ka := i+a&1, j+a>>1&1, k+a>>2&1
+					ib, jb, kb := i+b&1, j+b>>1&1, k+b>>2&1
+					key := index(ia, ja, ka)*3 + e/4
+					if v, ok := vertices[key]; ok {
+						return v
+					}
+					va, vb := values[index(ia, ja, ka)], values[index(ib, jb, kb)]
+					pa, pb := point(ia, ja, ka), point(ib, jb, kb)
+					p := pa.Add(pb.Sub(pa).Scale(va / (va - vb)))
+					v := &vertex{p, gradient(p)}
+					vertices[key] = v
+					return v
+				}
+				for _, t := range tris {
+					v0, v1, v2 := edgeVertex(t[0]), edgeVertex(t[1]), edgeVertex(t[2])
+					if *v0.p == *v1.p || *v1.p == *v2.p || *v0.p == *v2.p {
+						continue
+					}
+					// Wind the triangle to face along the gradient.
+					if Cross(v1.p.Sub(v0.p), v2.p.Sub(v0.p)).Dot(v0.n.Add(v1.n).Add(v2.n)) < 0 {
+						v1, v2 = v2, v1
+					}
+					tri := NewTriangle(v0.p, v1.p, v2.p, mat)
+					tri.N0, tri.N1, tri.N2 = v0.n, v1.n, v2.n
+					ret = append(ret, tri)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// MarchingCubesSDF polygonizes the surface of s, giving each triangle the
+// material of s at its center.
+func MarchingCubesSDF(s SDF, bounds *Bounds, resolution int) []*Triangle {
+	ret := MarchingCubes(func(p *Vector3) float64 {
+		d, _ := s.Distance(p)
+		return d
+	}, bounds, resolution, 0, nil)
+	for _, t := range ret {
+		_, t.Material = s.Distance(t.Centroid())
+	}
+	return ret
+}
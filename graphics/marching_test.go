@@ -0,0 +1,86 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+// openEdges counts the edges of t not shared by exactly two triangles, which
+// is zero for a closed mesh.
+func openEdges(t []*Triangle) int {
+	type edge struct{ a, b *Vector3 }
+	count := map[edge]int{}
+	for _, tri := range t {
+		for _, e := range [][2]*Vector3{{tri.P0, tri.P1}, {tri.P1, tri.P2}, {tri.P2, tri.P0}} {
+			if *e[0] == *e[1] {
+				continue
+			}
+			if e[0].X < e[1].X || e[0].X == e[1].X && (e[0].Y < e[1].Y || e[0].Y == e[1].Y && e[0].Z < e[1].Z) {
+				e[0], e[1] = e[1], e[0]
+			}
+			count[edge{e[0], e[1]}]++
+		}
+	}
+	open := 0
+	for _, n := range count {
+		if n != 2 {
+			open++
+		}
+	}
+	return open
+}
+
+func TestMarchingCubes_Sphere(t *testing.T) {
+	m := &SolidMaterial{}
+	center := &Vector3{.1, -.2, .05}
+	sphere := &SDFSphere{center, 1, m}
+	bounds := &Bounds{&Vector3{-1.5, -1.5, -1.5}, &Vector3{1.5, 1.5, 1.5}}
+	tris := MarchingCubesSDF(sphere, bounds, 30)
+	if len(tris) == 0 {
+		t.Fatal("no triangles")
+	}
+	if n := openEdges(tris); n != 0 {
+		t.Errorf("sphere mesh has %d open edges", n)
+	}
+	if a := NewMesh(tris).Area(); math.Abs(a-4*math.Pi) > .05*4*math.Pi {
+		t.Errorf("sphere mesh has area %v, want about %v", a, 4*math.Pi)
+	}
+	for _, tri := range tris {
+		for _, v := range [][2]*Vector3{{tri.P0, tri.N0}, {tri.P1, tri.N1}, {tri.P2, tri.N2}} {
+			r := v[0].Sub(center)
+			if math.Abs(r.Norm()-1) > .01 {
+				t.Fatalf("vertex %v is %v from the center, want 1", v[0], r.Norm())
+			}
+			if v[1].Dot(r.Normalize()) < .99 {
+				t.Fatalf("normal %v at %v does not point out", v[1], v[0])
+			}
+		}
+		if tri.Material != m {
+			t.Fatal("triangle without the material of the sphere")
+		}
+		if tri.Norm.Dot(tri.Centroid().Sub(center)) < 0 {
+			t.Fatalf("triangle at %v is wound inward", tri.Centroid())
+		}
+	}
+}
+
+func TestMarchingCubes_Closed(t *testing.T) {
+	// Noise carved by a ball gives every kind of cell, including those with
+	// ambiguous faces, and stays inside the bounds.
+	field := func(p *Vector3) float64 {
+		return math.Max(PerlinNoise(p.Scale(2.3)), p.Norm()-1.2)
+	}
+	bounds := &Bounds{&Vector3{-1.5, -1.5, -1.5}, &Vector3{1.5, 1.5, 1.5}}
+	tris := MarchingCubes(field, bounds, 24, 0, nil)
+	if len(tris) == 0 {
+		t.Fatal("no triangles")
+	}
+	if n := openEdges(tris); n != 0 {
+		t.Errorf("mesh has %d open edges", n)
+	}
+	for pattern, tris := range mcTable {
+		if (pattern == 0 || pattern == 255) != (len(tris) == 0) {
+			t.Errorf("pattern %08b has %d triangles", pattern, len(tris))
+		}
+	}
+}
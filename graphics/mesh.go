@@ -0,0 +1,307 @@
+package graphics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mesh is an indexed triangle mesh. Its faces index into arrays of
+// positions, normals and texture coordinates, which neighboring faces share,
+// so that a mesh knows which faces meet where and stores every vertex once.
+type Mesh struct {
+	Positions []*Vector3
+	Normals   []*Vector3
+	UVs       []*Vector2
+	// Indices holds the three indices into Positions of every face, wound
+	// as the Triangle of the face is.
+	Indices []int
+	// NormalIndices and UVIndices run along Indices, giving the normal and
+	// texture coordinates of each corner, or -1 where the corner has none.
+	// Faces with a corner without a normal are flat, and faces with a corner
+	// without texture coordinates are untextured.
+	NormalIndices []int
+	UVIndices     []int
+	Materials     []Material
+	// FaceMaterials is the index into Materials of each face.
+	FaceMaterials []int
+}
+
+// NewMesh indexes t, sharing positions, normals and texture coordinates that
+// are equal, and materials that are the same.
+func NewMesh(t []*Triangle) *Mesh {
+	m := &Mesh{}
+	positions := map[Vector3]int{}
+	normals := map[Vector3]int{}
+	texCoords := map[Vector2]int{}
+	materials := map[Material]int{}
+	for _, tri := range t {
+		ps := [3]*Vector3{tri.P0, tri.P1, tri.P2}
+		ns := [3]*Vector3{tri.N0, tri.N1, tri.N2}
+		uvs := [3]*Vector2{tri.UV0, tri.UV1, tri.UV2}
+		for k, p := range ps {
+			i, ok := positions[*p]
+			if !ok {
+				i = len(m.Positions)
+				positions[*p] = i
+				m.Positions = append(m.Positions, p)
+			}
+			m.Indices = append(m.Indices, i)
+
+			ni := -1
+			if n := ns[k]; n != nil {
+				if ni, ok = normals[*n]; !ok {
+					ni = len(m.Normals)
+					normals[*n] = ni
+					m.Normals = append(m.Normals, n)
+				}
+			}
+			m.NormalIndices = append(m.NormalIndices, ni)
+			ui := -1
+			if uv := uvs[k]; uv != nil {
+				if ui, ok = texCoords[*uv]; !ok {
+					ui = len(m.UVs)
+					texCoords[*uv] = ui
+					m.UVs = append(m.UVs, uv)
+				}
+			}
+			m.UVIndices = append(m.UVIndices, ui)
+		}
+		mi, ok := materials[tri.Material]
+		if !ok {
+			mi = len(m.Materials)
+			materials[tri.Material] = mi
+			m.Materials = append(m.Materials, tri.Material)
+		}
+		m.FaceMaterials = append(m.FaceMaterials, mi)
+	}
+	return m
+}
+
+// NumFaces returns the number of faces of m.
+func (m *Mesh) NumFaces() int {
+	return len(m.Indices) / 3
+}
+
+// Face returns the indices into Positions of the corners of face i.
+func (m *Mesh) Face(i int) [3]int {
+	return [3]int{m.Indices[3*i], m.Indices[3*i+1], m.Indices[3*i+2]}
+}
+
+// AddFace appends a face with corners a, b and c, no normals or texture
+// coordinates, and material mat, which must be in Materials.
+func (m *Mesh) AddFace(a, b, c, mat int) {
+	m.Indices = append(m.Indices, a, b, c)
+	m.NormalIndices = append(m.NormalIndices, -1, -1, -1)
+	m.UVIndices = append(m.UVIndices, -1, -1, -1)
+	m.FaceMaterials = append(m.FaceMaterials, mat)
+}
+
+// Triangles returns the faces of m as triangles, which share the vertices of
+// m, with tangents for those that are textured.
+func (m *Mesh) Triangles() []*Triangle {
+	ret := make([]*Triangle, m.NumFaces())
+	for i := range ret {
+		f := m.Face(i)
+		t := NewTriangle(m.Positions[f[0]], m.Positions[f[1]], m.Positions[f[2]], m.Materials[m.FaceMaterials[i]])
+		n := m.NormalIndices[3*i : 3*i+3]
+		if n[0] >= 0 && n[1] >= 0 && n[2] >= 0 {
+			t.N0, t.N1, t.N2 = m.Normals[n[0]], m.Normals[n[1]], m.Normals[n[2]]
+		}
+		uv := m.UVIndices[3*i : 3*i+3]
+		if uv[0] >= 0 && uv[1] >= 0 && uv[2] >= 0 {
+			t.UV0, t.UV1, t.UV2 = m.UVs[uv[0]], m.UVs[uv[1]], m.UVs[uv[2]]
+		}
+		ret[i] = t
+	}
+	ComputeTangents(ret)
+	return ret
+}
+
+// Shape returns the faces of m in a BVH, for the ray tracer.
+func (m *Mesh) Shape() Shape {
+	return NewBVH(TriangleShapes(m.Triangles()))
+}
+
+// Bounds returns the box around the positions of m, nil when it has none.
+func (m *Mesh) Bounds() *Bounds {
+	if len(m.Positions) == 0 {
+		return nil
+	}
+	return pointBounds(m.Positions...)
+}
+
+// Transform returns m moved by mat, sharing its indices and materials.
+func (m *Mesh) Transform(mat *Mat4) *Mesh {
+	ret := *m
+	ret.Positions = make([]*Vector3, len(m.Positions))
+	for i, p := range m.Positions {
+		ret.Positions[i] = transformPoint(mat, p)
+	}
+	ret.Normals = make([]*Vector3, len(m.Normals))
+	for i, n := range m.Normals {
+		ret.Normals[i] = transformDir(mat, n).Normalize()
+	}
+	return &ret
+}
+
+// VertexFaces returns the faces around each position of m.
+func (m *Mesh) VertexFaces() [][]int {
+	ret := make([][]int, len(m.Positions))
+	for i, v := range m.Indices {
+		if f := i / 3; len(ret[v]) == 0 || ret[v][len(ret[v])-1] != f {
+			ret[v] = append(ret[v], f)
+		}
+	}
+	return ret
+}
+
+// Edge is an edge of a Mesh, from the lower index into Positions to the
+// higher.
+type Edge [2]int
+
+// NewEdge returns the edge between positions a and b.
+func NewEdge(a, b int) Edge {
+	if a > b {
+		a, b = b, a
+	}
+	return Edge{a, b}
+}
+
+// EdgeFaces returns the faces along each edge of m, two for every edge of a
+// closed manifold mesh.
+func (m *Mesh) EdgeFaces() map[Edge][]int {
+	ret := map[Edge][]int{}
+	for i := 0; i < m.NumFaces(); i++ {
+		f := m.Face(i)
+		for k := range f {
+			e := NewEdge(f[k], f[(k+1)%3])
+			ret[e] = append(ret[e], i)
+		}
+	}
+	return ret
+}
+
+// PolyMesh is a mesh of polygons with any number of sides, as OBJ files hold
+// them, for Catmull-Clark subdivision. Its arrays are those of Mesh.
+type PolyMesh struct {
+	Positions []*Vector3
+	Normals   []*Vector3
+	UVs       []*Vector2
+	Faces     []*PolyFace
+	Materials []Material
+}
+
+// PolyFace is a face of a PolyMesh. Its indices are those of the corners of
+// a face of Mesh, in order around the face.
+type PolyFace struct {
+	Indices       []int
+	NormalIndices []int
+	UVIndices     []int
+	Material      int
+}
+
+// Triangulate fans each face of p out from its first corner.
+func (p *PolyMesh) Triangulate() *Mesh {
+	m := &Mesh{Positions: p.Positions, Normals: p.Normals, UVs: p.UVs, Materials: p.Materials}
+	for _, f := range p.Faces {
+		for k := 1; k+1 < len(f.Indices); k++ {
+			for _, c := range []int{0, k, k + 1} {
+				m.Indices = append(m.Indices, f.Indices[c])
+				m.NormalIndices = append(m.NormalIndices, f.NormalIndices[c])
+				m.UVIndices = append(m.UVIndices, f.UVIndices[c])
+			}
+			m.FaceMaterials = append(m.FaceMaterials, f.Material)
+		}
+	}
+	return m
+}
+
+// OpenObjMesh reads an OBJ file into a Mesh of a single material of color
+// rgba, splitting faces with more than three corners into triangles.
+func OpenObjMesh(filename string, rgba *Color) (*Mesh, error) {
+	p, err := OpenObjPolyMesh(filename, rgba)
+	if err != nil {
+		return nil, err
+	}
+	return p.Triangulate(), nil
+}
+
+// OpenObjPolyMesh reads an OBJ file into a PolyMesh of a single material of
+// color rgba.
+func OpenObjPolyMesh(filename string, rgba *Color) (*PolyMesh, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &PolyMesh{Materials: []Material{&SolidMaterial{
+		Color:         rgba,
+		SpecColor_:    &Color{10, 10, 10, 255},
+		SpecCoeff_:    8,
+		AmbientCoeff_: .01,
+	}}}
+	reader := bufio.NewScanner(f)
+	for line := 1; reader.Scan(); line++ {
+		fields := strings.Fields(reader.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		float := func(i int) float64 {
+			if i >= len(fields) {
+				return 0
+			}
+			x, _ := strconv.ParseFloat(fields[i], 64)
+			return x
+		}
+		switch fields[0] {
+		case "v":
+			p.Positions = append(p.Positions, &Vector3{float(1), float(2), float(3)})
+		case "vn":
+			p.Normals = append(p.Normals, &Vector3{float(1), float(2), float(3)})
+		case "vt":
+			// OBJ puts v = 0 at the bottom of the image, textures at the top.
+			p.UVs = append(p.UVs, &Vector2{float(1), 1 - float(2)})
+		case "f":
+			// Corners are v, v/vt, v//vn or v/vt/vn, counting from 1, or back
+			// from -1 for the last read so far.
+			face := &PolyFace{}
+			textured := true
+			for _, corner := range fields[1:] {
+				val := strings.Split(corner, "/")
+				var indices [3]int
+				for i, count := range []int{len(p.Positions), len(p.UVs), len(p.Normals)} {
+					indices[i] = -1
+					if i >= len(val) || i > 0 && val[i] == "" {
+						continue
+					}
+					x, err := strconv.Atoi(val[i])
+					if x < 0 {
+						x += count + 1
+					}
+					if err != nil || x < 1 || x > count {
+						return nil, fmt.Errorf("%s:%d: bad corner %q", filename, line, corner)
+					}
+					indices[i] = x - 1
+				}
+				face.Indices = append(face.Indices, indices[0])
+				face.NormalIndices = append(face.NormalIndices, indices[2])
+				face.UVIndices = append(face.UVIndices, indices[1])
+				textured = textured && indices[1] >= 0
+			}
+			if len(face.Indices) < 3 {
+				continue
+			}
+			if !textured {
+				for k := range face.UVIndices {
+					face.UVIndices[k] = -1
+				}
+			}
+			p.Faces = append(p.Faces, face)
+		}
+	}
+	return p, reader.Err()
+}
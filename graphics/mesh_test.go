@@ -0,0 +1,53 @@
+package graphics
+
+import (
+	"testing"
+)
+
+func TestMesh(t *testing.T) {
+	sphere := Icosphere(1, &SolidMaterial{})
+	m := NewMesh(sphere)
+	if got := m.NumFaces(); got != len(sphere) {
+		t.Fatalf("mesh has %d faces, want %d", got, len(sphere))
+	}
+	// The 12 corners of the icosahedron and a point on each of its 30 edges.
+	if len(m.Positions) != 42 {
+		t.Errorf("mesh has %d positions, want 42", len(m.Positions))
+	}
+	if len(m.Materials) != 1 {
+		t.Errorf("mesh has %d materials, want 1", len(m.Materials))
+	}
+	for e, faces := range m.EdgeFaces() {
+		if len(faces) != 2 {
+			t.Fatalf("edge %v has faces %v, want two", e, faces)
+		}
+	}
+	for v, faces := range m.VertexFaces() {
+		if len(faces) < 5 {
+			t.Fatalf("vertex %d has faces %v, want at least five", v, faces)
+		}
+	}
+
+	moved := m.Transform(Translate(1, 2, 3))
+	for i, tri := range moved.Triangles() {
+		want := sphere[i]
+		for k, p := range [][2]*Vector3{{tri.P0, want.P0}, {tri.P1, want.P1}, {tri.P2, want.P2}} {
+			if *p[0] != *p[1].Add(&Vector3{1, 2, 3}) {
+				t.Fatalf("face %d corner %d is at %v, want %v moved", i, k, p[0], p[1])
+			}
+		}
+		if tri.N0.Sub(want.N0).Norm() > 1e-12 || *tri.UV1 != *want.UV1 || tri.Material != want.Material {
+			t.Fatalf("face %d lost its normals, texture coordinates or material", i)
+		}
+		if tri.Tan0 == nil {
+			t.Fatalf("face %d has no tangents", i)
+		}
+	}
+	shared := map[*Vector3]bool{}
+	for _, tri := range m.Triangles() {
+		shared[tri.P0], shared[tri.P1], shared[tri.P2] = true, true, true
+	}
+	if len(shared) != len(m.Positions) {
+		t.Errorf("triangles have %d vertices, want the %d of the mesh", len(shared), len(m.Positions))
+	}
+}
@@ -0,0 +1,177 @@
+package graphics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// MeshLight is an AreaLight made of the emissive triangles of a mesh. Samples
+// pick a triangle with probability proportional to its area times the
+// brightness of its emission, so large bright surfaces get most of the rays.
+type MeshLight struct {
+	Emitters []*Emitting
+	Samples  int
+
+	cdf    []float64
+	total  float64
+	center *Vector3
+}
+
+// Emitting is one triangle of a MeshLight with the emission of its material.
+type Emitting struct {
+	P0       *Vector3
+	P1       *Vector3
+	P2       *Vector3
+	Emission *Color
+}
+
+// NewMeshLight collects the triangles of env whose material is an Emitter with
+// a non-black emission. It returns nil if there are none, or they have no
+// area.
+func NewMeshLight(env []*Triangle, samples int) *MeshLight {
+	var emitters []*Emitting
+	for _, t := range env {
+		e, ok := t.Material.(Emitter)
+		if !ok {
+			continue
+		}
+		uv := &Vector2{1.0 / 3, 1.0 / 3}
+		c := e.Emission(uv)
+		if c == nil || luminance(c) <= 0 {
+			continue
+		}
+		emitters = append(emitters, &Emitting{t.P0, t.P1, t.P2, c})
+	}
+	return newMeshLight(emitters, samples)
+}
+
+// newMeshLight returns the light of emitters, or nil when they emit nothing.
+func newMeshLight(emitters []*Emitting, samples int) *MeshLight {
+	m := &MeshLight{
+		Emitters: emitters,
+		Samples:  samples,
+		cdf:      make([]float64, len(emitters)),
+		center:   &Vector3{},
+	}
+	for i, e := range emitters {
+		w := e.area() * luminance(e.Emission)
+		m.total += w
+		m.cdf[i] = m.total
+		m.center = m.center.Add(e.centroid().Scale(w))
+	}
+	if m.total <= 0 {
+		return nil
+	}
+	m.center = m.center.Scale(1 / m.total)
+	return m
+}
+
+func (e *Emitting) area() float64 {
+	return Cross(e.P1.Sub(e.P0), e.P2.Sub(e.P0)).Norm() / 2
+}
+
+func (e *Emitting) normal() *Vector3 {
+	return Cross(e.P1.Sub(e.P0), e.P2.Sub(e.P0)).Normalize()
+}
+
+func (e *Emitting) centroid() *Vector3 {
+	return e.P0.Add(e.P1).Add(e.P2).Scale(1.0 / 3.0)
+}
+
+func luminance(c *Color) float64 {
+	return .2126*c.R + .7152*c.G + .0722*c.B
+}
+
+// Center is the emission weighted centroid of the light.
+func (m *MeshLight) Center() *Vector3 {
+	return m.center
+}
+
+// Radius bounds the distance from Center to any emitting vertex.
+func (m *MeshLight) Radius() float64 {
+	center := m.Center()
+	var r float64
+	for _, e := range m.Emitters {
+		for _, p := range []*Vector3{e.P0, e.P1, e.P2} {
+			r = max(r, p.Sub(center).Norm())
+		}
+	}
+	return r
+}
+
+func (m *MeshLight) Norm(v *Vector3) *Vector3 {
+	return v.Sub(m.Center()).Normalize()
+}
+
+// Intensity sums every emitting triangle as a small two sided emitter at its
+// centroid.
+func (m *MeshLight) Intensity(v *Vector3) *Color {
+	ret := &Color{A: 255}
+	for _, e := range m.Emitters {
+		c := emittedTowards(e.centroid(), e.normal(), v, e.Emission, e.area())
+		dist := v.Sub(e.centroid()).Norm()
+		ret.R += c.R / (dist * dist)
+		ret.G += c.G / (dist * dist)
+		ret.B += c.B / (dist * dist)
+	}
+	return ret
+}
+
+func (m *MeshLight) Transform(mat *Mat4) Light {
+	emitters := make([]*Emitting, len(m.Emitters))
+	for i, e := range m.Emitters {
+		emitters[i] = &Emitting{
+			P0:       mat.Dot(e.P0.Hom()).Dehom(),
+			P1:       mat.Dot(e.P1.Hom()).Dehom(),
+			P2:       mat.Dot(e.P2.Hom()).Dehom(),
+			Emission: e.Emission,
+		}
+	}
+	// A nil *MeshLight would make a Light that is not nil.
+	if l := newMeshLight(emitters, m.Samples); l != nil {
+		return l
+	}
+	return nil
+}
+
+func (m *MeshLight) SampleCount() int {
+	return maxi(m.Samples, 1)
+}
+
+func (m *MeshLight) Sample(v *Vector3) Light {
+	i := sort.SearchFloat64s(m.cdf, rand.Float64()*m.total)
+	if i == len(m.cdf) {
+		i--
+	}
+	e := m.Emitters[i]
+	pdf := e.area() * luminance(e.Emission) / m.total
+
+	s, t := rand.Float64(), rand.Float64()
+	if s+t > 1 {
+		s, t = 1-s, 1-t
+	}
+	p := e.P0.Add(e.P1.Sub(e.P0).Scale(s)).Add(e.P2.Sub(e.P0).Scale(t))
+	// nudge the sample off the surface so the emitter does not shadow itself
+	p = p.Add(v.Sub(p).Scale(1e-4))
+	c := emittedTowards(p, e.normal(), v, e.Emission, e.area()/pdf)
+	return &PointLight{
+		Location: p,
+		R:        c.R,
+		G:        c.G,
+		B:        c.B,
+	}
+}
+
+// emittedTowards is the point light strength of a two sided emitting patch of
+// the given area at p, as seen from v.
+func emittedTowards(p, n, v *Vector3, emission *Color, area float64) *Color {
+	d := v.Sub(p)
+	s := area * math.Abs(n.Dot(d.Normalize()))
+	return &Color{
+		R: emission.R * s,
+		G: emission.G * s,
+		B: emission.B * s,
+		A: 255,
+	}
+}
@@ -0,0 +1,51 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeshLight(t *testing.T) {
+	glow := &SolidMaterial{Color: White, SpecColor_: White, Emission_: &Color{200, 100, 0, 255}}
+	dull := &SolidMaterial{Color: White, SpecColor_: White}
+	env := []*Triangle{
+		NewTriangle(&Vector3{-1, 0, -1}, &Vector3{1, 0, -1}, &Vector3{1, 0, 1}, glow),
+		NewTriangle(&Vector3{-1, 0, -1}, &Vector3{1, 0, 1}, &Vector3{-1, 0, 1}, glow),
+		NewTriangle(&Vector3{-1, 5, -1}, &Vector3{1, 5, -1}, &Vector3{1, 5, 1}, dull),
+	}
+	m := NewMeshLight(env, 1)
+	if m == nil || len(m.Emitters) != 2 {
+		t.Fatalf("mesh light should hold the two emissive triangles, got %v", m)
+	}
+	if NewMeshLight(env[2:], 1) != nil {
+		t.Errorf("mesh without emission should not produce a light")
+	}
+	if c := m.Center(); c.Norm() > 1e-9 {
+		t.Errorf("mesh light has center %v, want the origin", c)
+	}
+	line := NewTriangle(&Vector3{0, 0, 0}, &Vector3{1, 0, 0}, &Vector3{2, 0, 0}, glow)
+	if NewMeshLight([]*Triangle{line}, 1) != nil {
+		t.Errorf("emitters without area should not produce a light")
+	}
+
+	v := &Vector3{0, 20, 0}
+	want := m.Intensity(v)
+	var r, g float64
+	n := 20000
+	for k := 0; k < n; k++ {
+		c := m.Sample(v).Intensity(v)
+		r += c.R
+		g += c.G
+	}
+	if got := r / float64(n); math.Abs(got-want.R) > .05*want.R {
+		t.Errorf("mean sampled red %v, want about %v", got, want.R)
+	}
+	if got := g / float64(n); math.Abs(got-want.G) > .05*want.G {
+		t.Errorf("mean sampled green %v, want about %v", got, want.G)
+	}
+
+	c := Render(glow, &Vector3{0, -1, 0}, &Vector3{0, 0, 1}, nil, zero, &Vector2{})
+	if c.R != 200 || c.G != 100 {
+		t.Errorf("unlit emissive surface renders as %v, want its emission", c)
+	}
+}
@@ -0,0 +1,159 @@
+package graphics
+
+import (
+	"math"
+	"math/rand"
+)
+
+// perm is Perlin's doubled permutation table, shuffled with a fixed seed so
+// that noise is the same from run to run.
+var perm = func() [512]int {
+	var p [512]int
+	for i, v := range rand.New(rand.NewSource(0)).Perm(256) {
+		p[i] = v
+		p[i+256] = v
+	}
+	return p
+}()
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func perlinGrad(hash int, x, y, z float64) float64 {
+	h := hash & 15
+	u, v := y, z
+	if h < 8 {
+		u = x
+	}
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// PerlinNoise is Perlin's improved gradient noise, roughly in -1..1 and zero
+// at integer points.
+func PerlinNoise(p *Vector3) float64 {
+	fx, fy, fz := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	X, Y, Z := int(fx)&255, int(fy)&255, int(fz)&255
+	x, y, z := p.X-fx, p.Y-fy, p.Z-fz
+	u, v, w := fade(x), fade(y), fade(z)
+
+	A := perm[X] + Y
+	AA, AB := perm[A]+Z, perm[A+1]+Z
+	B := perm[X+1] + Y
+	BA, BB := perm[B]+Z, perm[B+1]+Z
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, perlinGrad(perm[AA], x, y, z), perlinGrad(perm[BA], x-1, y, z)),
+			lerp(u, perlinGrad(perm[AB], x, y-1, z), perlinGrad(perm[BB], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, perlinGrad(perm[AA+1], x, y, z-1), perlinGrad(perm[BA+1], x-1, y, z-1)),
+			lerp(u, perlinGrad(perm[AB+1], x, y-1, z-1), perlinGrad(perm[BB+1], x-1, y-1, z-1))))
+}
+
+var simplexGrad = [12][3]float64{
+	{1, 1, 0}, {-1, 1, 0}, {1, -1, 0}, {-1, -1, 0},
+	{1, 0, 1}, {-1, 0, 1}, {1, 0, -1}, {-1, 0, -1},
+	{0, 1, 1}, {0, -1, 1}, {0, 1, -1}, {0, -1, -1},
+}
+
+// SimplexNoise is Perlin's simplex noise, after Gustavson's implementation,
+// roughly in -1..1.
+func SimplexNoise(p *Vector3) float64 {
+	const f3, g3 = 1.0 / 3, 1.0 / 6
+	s := (p.X + p.Y + p.Z) * f3
+	i, j, k := math.Floor(p.X+s), math.Floor(p.Y+s), math.Floor(p.Z+s)
+	t := (i + j + k) * g3
+	x0, y0, z0 := p.X-(i-t), p.Y-(j-t), p.Z-(k-t)
+
+	// The second and third corners of the simplex containing the point.
+	var i1, j1, k1, i2, j2, k2 float64
+	switch {
+	case x0 >= y0 && y0 >= z0:
+		i1, i2, j2 = 1, 1, 1
+	case x0 >= y0 && x0 >= z0:
+		i1, i2, k2 = 1, 1, 1
+	case x0 >= y0:
+		k1, i2, k2 = 1, 1, 1
+	case y0 < z0:
+		k1, j2, k2 = 1, 1, 1
+	case x0 < z0:
+		j1, j2, k2 = 1, 1, 1
+	default:
+		j1, i2, j2 = 1, 1, 1
+	}
+	corners := [4][3]float64{
+		{x0, y0, z0},
+		{x0 - i1 + g3, y0 - j1 + g3, z0 - k1 + g3},
+		{x0 - i2 + 2*g3, y0 - j2 + 2*g3, z0 - k2 + 2*g3},
+		{x0 - 1 + 3*g3, y0 - 1 + 3*g3, z0 - 1 + 3*g3},
+	}
+	offsets := [4][3]int{{0, 0, 0}, {int(i1), int(j1), int(k1)}, {int(i2), int(j2), int(k2)}, {1, 1, 1}}
+	ii, jj, kk := int(i)&255, int(j)&255, int(k)&255
+
+	n := 0.0
+	for c, d := range corners {
+		t := .6 - d[0]*d[0] - d[1]*d[1] - d[2]*d[2]
+		if t < 0 {
+			continue
+		}
+		o := offsets[c]
+		g := simplexGrad[perm[ii+o[0]+perm[jj+o[1]+perm[kk+o[2]]]]%12]
+		t *= t
+		n += t * t * (g[0]*d[0] + g[1]*d[1] + g[2]*d[2])
+	}
+	return 32 * n
+}
+
+// cellHash mixes the integer coordinates of a cell into a pseudo random
+// number.
+func cellHash(x, y, z, seed int) uint32 {
+	h := uint32(x)*73856093 ^ uint32(y)*19349663 ^ uint32(z)*83492791 ^ uint32(seed)*2654435761
+	h ^= h >> 16
+	h *= 0x7feb352d
+	h ^= h >> 15
+	h *= 0x846ca68b
+	h ^= h >> 16
+	return h
+}
+
+// WorleyNoise returns the distances from p to the nearest and second
+// nearest of a set of feature points scattered one to each unit cell.
+func WorleyNoise(p *Vector3) (float64, float64) {
+	cx, cy, cz := int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Floor(p.Z))
+	f1, f2 := math.Inf(1), math.Inf(1)
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for dz := -1; dz <= 1; dz++ {
+				x, y, z := cx+dx, cy+dy, cz+dz
+				feature := &Vector3{
+					float64(x) + float64(cellHash(x, y, z, 0))/(1<<32),
+					float64(y) + float64(cellHash(x, y, z, 1))/(1<<32),
+					float64(z) + float64(cellHash(x, y, z, 2))/(1<<32),
+				}
+				d := feature.Sub(p).Norm()
+				if d < f1 {
+					f1, f2 = d, f1
+				} else if d < f2 {
+					f2 = d
+				}
+			}
+		}
+	}
+	return f1, f2
+}
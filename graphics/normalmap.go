@@ -0,0 +1,100 @@
+package graphics
+
+import "math"
+
+// NormalMapper is implemented by materials that perturb the shading normal,
+// such as with a NormalMap. st are the texture coordinates of the point and
+// normal, tangent and bitangent its unit tangent space.
+type NormalMapper interface {
+	PerturbNormal(st *Vector2, normal, tangent, bitangent *Vector3) *Vector3
+}
+
+// NormalMap adds surface detail to a material with a tangent space normal
+// map, a height map for bump mapping, or both.
+type NormalMap struct {
+	// Normal holds tangent space normals with X along increasing U in red
+	// and Y along increasing V, up the image, in green, the OpenGL
+	// convention. Every component maps -1..1 to 0..255.
+	Normal *Texture
+	// Strength scales the X and Y of Normal, where zero means 1.
+	Strength float64
+	// FlipGreen reads DirectX style maps, whose Y points down the image.
+	FlipGreen bool
+	// Height is a grayscale height map, white being highest.
+	Height *Texture
+	// BumpScale is the height of white in Height, in texture coordinates.
+	BumpScale float64
+}
+
+// Perturb returns the normal of the map at st in the frame of normal, tangent
+// and bitangent.
+func (n *NormalMap) Perturb(st *Vector2, normal, tangent, bitangent *Vector3) *Vector3 {
+	x, y, z := 0.0, 0.0, 1.0
+	if n.Normal != nil {
+		c := n.Normal.At(st)
+		x, y, z = c.R/255*2-1, c.G/255*2-1, c.B/255*2-1
+		if n.FlipGreen {
+			y = -y
+		}
+		if n.Strength != 0 {
+			x *= n.Strength
+			y *= n.Strength
+		}
+	}
+	if n.Height != nil {
+		ds := 1 / float64(n.Height.Width())
+		dt := 1 / float64(n.Height.Height())
+		height := func(s, t float64) float64 {
+			c := n.Height.At(&Vector2{s, t})
+			return (c.R + c.G + c.B) / (3 * 255)
+		}
+		dhds := (height(st.X+ds, st.Y) - height(st.X-ds, st.Y)) / (2 * ds)
+		// V grows up the image, against st.Y.
+		dhdv := -(height(st.X, st.Y+dt) - height(st.X, st.Y-dt)) / (2 * dt)
+		x -= n.BumpScale * dhds * z
+		y -= n.BumpScale * dhdv * z
+	}
+	return tangent.Scale(x).Add(bitangent.Scale(y)).Add(normal.Scale(z)).Normalize()
+}
+
+// bitangent is the direction of increasing V across the face, not
+// normalized. V grows up the image while st.Y grows down it.
+func (t *Triangle) bitangent() *Vector3 {
+	e1, e2 := t.P1.Sub(t.P0), t.P2.Sub(t.P0)
+	d1, d2 := t.UV1.Sub(t.UV0), t.UV2.Sub(t.UV0)
+	det := d1.X*d2.Y - d2.X*d1.Y
+	if det == 0 {
+		return nil
+	}
+	return e2.Scale(d1.X).Sub(e1.Scale(d2.X)).Scale(-1 / det)
+}
+
+// handedness is 1 when the texture space of t is right handed about its
+// vertex normals, so that the bitangent is normal x tangent, and -1 where
+// the texture is mirrored.
+func (t *Triangle) handedness() float64 {
+	tan, bitan := t.Tangent(), t.bitangent()
+	if tan == nil {
+		return 1
+	}
+	n := t.N0.Add(t.N1).Add(t.N2)
+	if Cross(n, tan).Dot(bitan) < 0 {
+		return -1
+	}
+	return 1
+}
+
+// shadingNormal applies the normal map of tri's material, if it has one, to
+// the interpolated normal at the barycentric uv.
+func shadingNormal(tri *Triangle, uv *Vector2, normal *Vector3) *Vector3 {
+	nm, ok := tri.Material.(NormalMapper)
+	if !ok || tri.UV0 == nil {
+		return normal
+	}
+	tan := tri.TangentAt(uv, normal)
+	if tan == nil || math.IsNaN(tan.X) {
+		return normal
+	}
+	bitan := Cross(normal, tan).Scale(tri.handedness())
+	return nm.PerturbNormal(tri.TexCoord(uv), normal, tan, bitan)
+}
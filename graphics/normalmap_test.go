@@ -0,0 +1,80 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func uniformTexture(c color.Color) *Texture {
+	im := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			im.Set(i, j, c)
+		}
+	}
+	return NewTexture(im)
+}
+
+func TestNormalMap_Perturb(t *testing.T) {
+	n, tan, bitan := &Vector3{0, 0, -1}, &Vector3{1, 0, 0}, &Vector3{0, -1, 0}
+	st := &Vector2{.5, .5}
+
+	flat := &NormalMap{Normal: uniformTexture(color.RGBA{128, 128, 255, 255})}
+	if got := flat.Perturb(st, n, tan, bitan); got.Sub(n).Norm() > .01 {
+		t.Errorf("flat normal map gives %v, want %v", got, n)
+	}
+	tilted := &NormalMap{Normal: uniformTexture(color.RGBA{255, 128, 128, 255})}
+	if got := tilted.Perturb(st, n, tan, bitan); got.Sub(tan).Norm() > .01 {
+		t.Errorf("+X normal map gives %v, want the tangent %v", got, tan)
+	}
+
+	// Height rising with U tilts the normal back, against the tangent.
+	ramp := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for j := 0; j < 16; j++ {
+		for i := 0; i < 16; i++ {
+			v := uint8(i * 16)
+			ramp.Set(i, j, color.RGBA{v, v, v, 255})
+		}
+	}
+	bump := &NormalMap{Height: NewTexture(ramp), BumpScale: .1}
+	if got := bump.Perturb(st, n, tan, bitan); got.Dot(tan) >= 0 || math.Abs(got.Dot(bitan)) > 1e-9 {
+		t.Errorf("bump map gives %v, want it tilted against the tangent only", got)
+	}
+}
+
+func TestTriangle_handedness(t *testing.T) {
+	tri := uvTriangle()
+	n := &Vector3{0, 0, -1}
+	tri.N0, tri.N1, tri.N2 = n, n, n
+	mirrored := uvTriangle()
+	mirrored.N0, mirrored.N1, mirrored.N2 = n, n, n
+	mirrored.UV1 = &Vector2{-1, 0}
+	if tri.handedness() == mirrored.handedness() {
+		t.Error("mirroring the texture does not flip the handedness")
+	}
+	for _, tri := range []*Triangle{tri, mirrored} {
+		b := Cross(n, tri.Tangent().Normalize()).Scale(tri.handedness())
+		if b.Dot(tri.bitangent()) <= 0 {
+			t.Errorf("rebuilt bitangent %v points away from %v", b, tri.bitangent())
+		}
+	}
+}
+
+func TestShadingNormal(t *testing.T) {
+	tri := uvTriangle()
+	n := &Vector3{0, 0, -1}
+	tri.N0, tri.N1, tri.N2 = n, n, n
+	tri.Material = &SolidMaterial{Normals: &NormalMap{Normal: uniformTexture(color.RGBA{255, 128, 128, 255})}}
+	ComputeTangents([]*Triangle{tri})
+	got := shadingNormal(tri, &Vector2{.3, .3}, n)
+	if got.Sub(&Vector3{1, 0, 0}).Norm() > .01 {
+		t.Errorf("shading normal is %v, want the tangent", got)
+	}
+
+	tri.UV0 = nil
+	if got := shadingNormal(tri, &Vector2{.3, .3}, n); got != n {
+		t.Errorf("triangle without UVs gets normal %v", got)
+	}
+}
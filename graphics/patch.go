@@ -0,0 +1,320 @@
+package graphics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// BezierPatch is a tensor product Bezier patch, bicubic with four by four
+// control points as in the Newell teapot, though any degree works. Points[i]
+// is the row of control points at the i-th step along U, and Points[i][j]
+// its j-th step along V.
+type BezierPatch struct {
+	Points   [][]*Vector3
+	Material Material
+}
+
+// bernstein returns the Bernstein polynomials of degree n at t.
+func bernstein(n int, t float64) []float64 {
+	ret := make([]float64, n+1)
+	ret[0] = 1
+	for k := 1; k <= n; k++ {
+		// Raise the degree by one, from the end so as not to overwrite.
+		for i := k; i >= 0; i-- {
+			b := 0.0
+			if i < k {
+				b = ret[i] * (1 - t)
+			}
+			if i > 0 {
+				b += ret[i-1] * t
+			}
+			ret[i] = b
+		}
+	}
+	return ret
+}
+
+// Eval returns the point of p at u, v and its derivatives along U and V.
+func (p *BezierPatch) Eval(u, v float64) (pos, du, dv *Vector3) {
+	m, n := len(p.Points)-1, len(p.Points[0])-1
+	bu, bv := bernstein(m, u), bernstein(n, v)
+	pos, du, dv = &Vector3{}, &Vector3{}, &Vector3{}
+	var bu1, bv1 []float64
+	if m > 0 {
+		bu1 = bernstein(m-1, u)
+	}
+	if n > 0 {
+		bv1 = bernstein(n-1, v)
+	}
+	for i, row := range p.Points {
+		for j, q := range row {
+			pos = pos.Add(q.Scale(bu[i] * bv[j]))
+			if i < m {
+				du = du.Add(p.Points[i+1][j].Sub(q).Scale(float64(m) * bu1[i] * bv[j]))
+			}
+			if j < n {
+				dv = dv.Add(row[j+1].Sub(q).Scale(float64(n) * bu[i] * bv1[j]))
+			}
+		}
+	}
+	return pos, du, dv
+}
+
+// Normal returns the unit normal of p at u, v, along dU cross dV. Where the
+// patch pinches to a point, as at the top of the teapot lid, it is taken a
+// little way in.
+func (p *BezierPatch) Normal(u, v float64) *Vector3 {
+	for step := 0; step < 8; step++ {
+		_, du, dv := p.Eval(u, v)
+		if n := Cross(du, dv); n.Norm() > 1e-12*(du.Norm()+dv.Norm()+1e-300) {
+			return n.Normalize()
+		}
+		u += (.5 - u) * 1e-3
+		v += (.5 - v) * 1e-3
+	}
+	return &Vector3{}
+}
+
+// bezierSegments is how many straight pieces the Bezier curve with control
+// points q needs to stay within tolerance of it: its second differences
+// bound how far it strays from its chords.
+func bezierSegments(q []*Vector3, tolerance float64) int {
+	d := len(q) - 1
+	worst := 0.0
+	for i := 1; i < d; i++ {
+		worst = math.Max(worst, q[i+1].Sub(q[i].Scale(2)).Add(q[i-1]).Norm())
+	}
+	return int(math.Max(1, math.Ceil(math.Sqrt(float64(d*(d-1))*worst/(8*tolerance)))))
+}
+
+// Tessellate splits p into triangles no further than about tolerance from
+// it, with its normals and with U and V as texture coordinates. Each side
+// of the patch is split by its own curve alone, so patches that share a
+// side split it alike and meet without cracks, and the inside of the patch
+// is split as finely as it needs and stitched to the sides.
+func (p *BezierPatch) Tessellate(tolerance float64) []*Triangle {
+	m, n := len(p.Points), len(p.Points[0])
+	column := func(j int) []*Vector3 {
+		ret := make([]*Vector3, m)
+		for i := range ret {
+			ret[i] = p.Points[i][j]
+		}
+		return ret
+	}
+	// The sides, as V = 0, U = 1, V = 1 and U = 0.
+	sides := [4]int{
+		bezierSegments(column(0), tolerance),
+		bezierSegments(p.Points[m-1], tolerance),
+		bezierSegments(column(n-1), tolerance),
+		bezierSegments(p.Points[0], tolerance),
+	}
+	nu, nv := 2, 2
+	for j := 0; j < n; j++ {
+		nu = maxi(nu, bezierSegments(column(j), tolerance))
+	}
+	for i := 0; i < m; i++ {
+		nv = maxi(nv, bezierSegments(p.Points[i], tolerance))
+	}
+
+	vertices := map[Vector2]*primVertex{}
+	vertex := func(u, v float64) *primVertex {
+		key := Vector2{u, v}
+		if pv, ok := vertices[key]; ok {
+			return pv
+		}
+		pos, _, _ := p.Eval(u, v)
+		pv := &primVertex{pos, p.Normal(u, v), &Vector2{u, v}}
+		vertices[key] = pv
+		return pv
+	}
+	inner := func(i, j int) *primVertex {
+		return vertex(float64(i)/float64(nu), float64(j)/float64(nv))
+	}
+
+	var ret []*Triangle
+	// emit adds the triangle, wound along dU cross dV.
+	emit := func(a, b, c *primVertex) {
+		if Cross(b.UV.Sub(a.UV).Hom(), c.UV.Sub(a.UV).Hom()).Z < 0 {
+			b, c = c, b
+		}
+		if t := primTriangle(a, b, c, p.Material); t != nil {
+			ret = append(ret, t)
+		}
+	}
+	for i := 1; i+1 < nu; i++ {
+		for j := 1; j+1 < nv; j++ {
+			a, b, c, d := inner(i, j), inner(i+1, j), inner(i+1, j+1), inner(i, j+1)
+			emit(a, b, c)
+			emit(a, c, d)
+		}
+	}
+	// Each side is stitched to the edge of the inner grid facing it, both
+	// taken as runs of points along the parameter t of the side.
+	for side, segments := range sides {
+		var outer, in []*primVertex
+		var outerT, inT []float64
+		for k := 0; k <= segments; k++ {
+			t := float64(k) / float64(segments)
+			var pv *primVertex
+			switch side {
+			case 0:
+				pv = vertex(t, 0)
+			case 1:
+				pv = vertex(1, t)
+			case 2:
+				pv = vertex(t, 1)
+			default:
+				pv = vertex(0, t)
+			}
+			outer, outerT = append(outer, pv), append(outerT, t)
+		}
+		steps := nu
+		if side%2 == 1 {
+			steps = nv
+		}
+		for k := 1; k < steps; k++ {
+			var pv *primVertex
+			switch side {
+			case 0:
+				pv = inner(k, 1)
+			case 1:
+				pv = inner(nu-1, k)
+			case 2:
+				pv = inner(k, nv-1)
+			default:
+				pv = inner(1, k)
+			}
+			in, inT = append(in, pv), append(inT, float64(k)/float64(steps))
+		}
+		// Walk both runs, always advancing the one whose next point is
+		// further behind.
+		a, b := 0, 0
+		for a+1 < len(outer) || b+1 < len(in) {
+			if b+1 >= len(in) || a+1 < len(outer) && outerT[a+1] <= inT[b+1] {
+				emit(outer[a], outer[a+1], in[b])
+				a++
+			} else {
+				emit(outer[a], in[b+1], in[b])
+				b++
+			}
+		}
+	}
+	ComputeTangents(ret)
+	return ret
+}
+
+// TessellatePatches tessellates every patch of patches. See Tessellate.
+func TessellatePatches(patches []*BezierPatch, tolerance float64) []*Triangle {
+	var ret []*Triangle
+	for _, p := range patches {
+		ret = append(ret, p.Tessellate(tolerance)...)
+	}
+	return ret
+}
+
+// BSplinePatches returns the bicubic Bezier patches of the uniform bicubic
+// B-spline surface with control points grid, one for every four by four
+// window of it.
+func BSplinePatches(grid [][]*Vector3, mat Material) []*BezierPatch {
+	// toBezier turns four B-spline control points into the Bezier control
+	// points of the same cubic.
+	toBezier := func(b [4]*Vector3) [4]*Vector3 {
+		return [4]*Vector3{
+			b[0].Add(b[1].Scale(4)).Add(b[2]).Scale(1.0 / 6),
+			b[1].Scale(2).Add(b[2]).Scale(1.0 / 3),
+			b[1].Add(b[2].Scale(2)).Scale(1.0 / 3),
+			b[1].Add(b[2].Scale(4)).Add(b[3]).Scale(1.0 / 6),
+		}
+	}
+	var ret []*BezierPatch
+	for i := 0; i+3 < len(grid); i++ {
+		for j := 0; j+3 < len(grid[i]); j++ {
+			// Convert the rows, then the columns of the result.
+			var rows [4][4]*Vector3
+			for r := range rows {
+				rows[r] = toBezier([4]*Vector3{grid[i+r][j], grid[i+r][j+1], grid[i+r][j+2], grid[i+r][j+3]})
+			}
+			points := make([][]*Vector3, 4)
+			for r := range points {
+				points[r] = make([]*Vector3, 4)
+			}
+			for c := 0; c < 4; c++ {
+				col := toBezier([4]*Vector3{rows[0][c], rows[1][c], rows[2][c], rows[3][c]})
+				for r := range col {
+					points[r][c] = col[r]
+				}
+			}
+			ret = append(ret, &BezierPatch{points, mat})
+		}
+	}
+	return ret
+}
+
+// maxBPTDegree is the highest degree OpenBPT reads, far above what any
+// model needs.
+const maxBPTDegree = 32
+
+// OpenBPT reads the Bezier patches of a file in the format of Newell's
+// teapot: the number of patches, then for each the degrees along U and V
+// and its control points, one per line, V changing fastest.
+func OpenBPT(filename string, mat Material) ([]*BezierPatch, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewScanner(f)
+	reader.Split(bufio.ScanWords)
+	next := func() (float64, error) {
+		if !reader.Scan() {
+			if err := reader.Err(); err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("%s: unexpected end of file", filename)
+		}
+		return strconv.ParseFloat(reader.Text(), 64)
+	}
+	count, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || count != math.Trunc(count) {
+		return nil, fmt.Errorf("%s: bad patch count %v", filename, count)
+	}
+	// The count is not trusted to size the patches up front, and the
+	// degrees are capped, so a corrupt header runs out of file rather than
+	// memory.
+	var ret []*BezierPatch
+	for k := 0; k < int(count); k++ {
+		du, err := next()
+		if err != nil {
+			return nil, err
+		}
+		dv, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if du < 1 || dv < 1 || du > maxBPTDegree || dv > maxBPTDegree || du != math.Trunc(du) || dv != math.Trunc(dv) {
+			return nil, fmt.Errorf("%s: patch %d has degree %v by %v", filename, k, du, dv)
+		}
+		points := make([][]*Vector3, int(du)+1)
+		for i := range points {
+			points[i] = make([]*Vector3, int(dv)+1)
+			for j := range points[i] {
+				var xyz [3]float64
+				for c := range xyz {
+					if xyz[c], err = next(); err != nil {
+						return nil, err
+					}
+				}
+				points[i][j] = &Vector3{xyz[0], xyz[1], xyz[2]}
+			}
+		}
+		ret = append(ret, &BezierPatch{points, mat})
+	}
+	return ret, nil
+}
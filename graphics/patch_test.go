@@ -0,0 +1,127 @@
+package graphics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBezierPatch_Tessellate(t *testing.T) {
+	// A flat patch over the unit square, with its control points bunched
+	// up so that it is curved in its parameters though not in space.
+	flat := &BezierPatch{Material: &SolidMaterial{}}
+	for i := 0; i < 4; i++ {
+		var row []*Vector3
+		for j := 0; j < 4; j++ {
+			row = append(row, &Vector3{float64(i) / 3, float64(j*j) / 9, 0})
+		}
+		flat.Points = append(flat.Points, row)
+	}
+	area := 0.0
+	for _, tri := range flat.Tessellate(.001) {
+		area += tri.Norm.Z * Cross(tri.P1.Sub(tri.P0), tri.P2.Sub(tri.P0)).Norm() / 2
+		for _, c := range []struct {
+			p, n *Vector3
+			uv   *Vector2
+		}{{tri.P0, tri.N0, tri.UV0}, {tri.P1, tri.N1, tri.UV1}, {tri.P2, tri.N2, tri.UV2}} {
+			if c.p.Z != 0 || c.n.Z != 1 || tri.Norm.Z < .999 {
+				t.Fatalf("triangle %v has point %v normal %v, want it flat and facing +Z", tri, c.p, c.n)
+			}
+			if want, _, _ := flat.Eval(c.uv.X, c.uv.Y); c.p.Sub(want).Norm() > 1e-12 {
+				t.Fatalf("point %v has UV %v, the UV of %v", c.p, c.uv, want)
+			}
+		}
+	}
+	if math.Abs(area-1) > 1e-9 {
+		t.Errorf("flat patch covers %v, want 1", area)
+	}
+
+	// Two B-spline patches of a bumpy surface, which must meet without
+	// cracks and stay close to it.
+	var grid [][]*Vector3
+	for i := 0; i < 5; i++ {
+		var row []*Vector3
+		for j := 0; j < 4; j++ {
+			row = append(row, &Vector3{float64(i), float64(j), float64((i*7+j*3)%4) - 1.5})
+		}
+		grid = append(grid, row)
+	}
+	patches := BSplinePatches(grid, &SolidMaterial{})
+	if len(patches) != 2 {
+		t.Fatalf("got %d patches from a 5 by 4 grid, want 2", len(patches))
+	}
+	const tolerance = .01
+	tris := TessellatePatches(patches, tolerance)
+	mesh := NewMesh(tris)
+	mesh.Weld(1e-9)
+	// The open edges run along the outline of the surface, and only there:
+	// a crack between the patches would add to their length.
+	open := 0.0
+	for e, faces := range mesh.EdgeFaces() {
+		switch len(faces) {
+		case 1:
+			open += mesh.Positions[e[0]].Sub(mesh.Positions[e[1]]).Norm()
+		case 2:
+		default:
+			t.Fatalf("edge %v has faces %v", e, faces)
+		}
+	}
+	outline := 0.0
+	for _, side := range []struct {
+		p          *BezierPatch
+		u, v, x, y float64
+	}{{patches[0], 0, 0, 0, 1}, {patches[0], 0, 0, 1, 0}, {patches[0], 0, 1, 1, 0}, {patches[1], 0, 0, 1, 0}, {patches[1], 0, 1, 1, 0}, {patches[1], 1, 0, 0, 1}} {
+		last, _, _ := side.p.Eval(side.u, side.v)
+		for k := 1; k <= 1000; k++ {
+			s := float64(k) / 1000
+			next, _, _ := side.p.Eval(side.u+s*side.x, side.v+s*side.y)
+			outline += next.Sub(last).Norm()
+			last = next
+		}
+	}
+	if open > outline || open < outline*.99 {
+		t.Errorf("open edges are %v long, want the outline, %v", open, outline)
+	}
+	for _, p := range patches {
+		for _, tri := range p.Tessellate(tolerance) {
+			c := tri.Centroid()
+			uv := tri.UV0.Add(tri.UV1).Add(tri.UV2).Scale(1.0 / 3)
+			if want, _, _ := p.Eval(uv.X, uv.Y); c.Sub(want).Norm() > 2*tolerance {
+				t.Fatalf("centroid %v is %v from the surface", c, c.Sub(want).Norm())
+			}
+		}
+	}
+}
+
+func TestOpenBPT(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "square.bpt")
+	data := "1\n1 2\n0 0 0\n0 1 0\n0 2 0\n1 0 0\n1 1 1\n1 2 0\n"
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patches, err := OpenBPT(name, &SolidMaterial{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || len(patches[0].Points) != 2 || len(patches[0].Points[0]) != 3 {
+		t.Fatalf("got %v, want one patch of two rows of three", patches)
+	}
+	if p := patches[0].Points[1][1]; *p != (Vector3{1, 1, 1}) {
+		t.Errorf("middle of the second row is %v", p)
+	}
+	if err := os.WriteFile(name, []byte("2\n1 1\n0 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBPT(name, &SolidMaterial{}); err == nil {
+		t.Error("read a truncated file without error")
+	}
+	for _, header := range []string{"-1\n", "1.5\n1 1\n", "x\n", "1e18\n1 1\n", "1\n1.5 1\n", "1\n1e300 1\n", "1\n3000000000 3000000000\n"} {
+		if err := os.WriteFile(name, []byte(header+"0 0 0\n0 1 0\n1 0 0\n1 1 0\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenBPT(name, &SolidMaterial{}); err == nil {
+			t.Errorf("read a file with the header %q without error", header)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package graphics
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HDR files store linear values where 1 is white, while Framebuffer uses 255.
+
+// WritePFM writes f as a little endian color Portable Float Map.
+func WritePFM(w io.Writer, f *Framebuffer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", f.Width, f.Height); err != nil {
+		return err
+	}
+	buf := make([]byte, 12)
+	for j := f.Height - 1; j >= 0; j-- {
+		for i := 0; i < f.Width; i++ {
+			c := f.At(i, j)
+			binary.LittleEndian.PutUint32(buf[0:], math.Float32bits(float32(c.R/255)))
+			binary.LittleEndian.PutUint32(buf[4:], math.Float32bits(float32(c.G/255)))
+			binary.LittleEndian.PutUint32(buf[8:], math.Float32bits(float32(c.B/255)))
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadPFM reads a color (PF) or grayscale (Pf) Portable Float Map of either
+// byte order.
+func ReadPFM(r io.Reader) (*Framebuffer, error) {
+	br := bufio.NewReader(r)
+	var magic string
+	var width, height int
+	var scale float64
+	if _, err := fmt.Fscan(br, &magic, &width, &height, &scale); err != nil {
+		return nil, err
+	}
+	if _, err := br.ReadByte(); err != nil {
+		return nil, err
+	}
+	channels := 3
+	switch magic {
+	case "PF":
+	case "Pf":
+		channels = 1
+	default:
+		return nil, fmt.Errorf("pfm: bad magic %q", magic)
+	}
+	if !readableSize(width, height) {
+		return nil, fmt.Errorf("pfm: bad size %dx%d", width, height)
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+	f := NewFramebuffer(width, height)
+	buf := make([]byte, 4*channels)
+	for j := height - 1; j >= 0; j-- {
+		for i := 0; i < width; i++ {
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return nil, err
+			}
+			v := make([]float64, channels)
+			for k := range v {
+				v[k] = 255 * float64(math.Float32frombits(order.Uint32(buf[4*k:])))
+			}
+			if channels == 1 {
+				f.Set(i, j, &Color{v[0], v[0], v[0], 255})
+			} else {
+				f.Set(i, j, &Color{v[0], v[1], v[2], 255})
+			}
+		}
+	}
+	return f, nil
+}
+
+// OpenHDR reads a .pfm, .hdr or .exr file, picking the format from the
+// extension.
+func OpenHDR(filename string) (*Framebuffer, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pfm":
+		return ReadPFM(file)
+	case ".hdr", ".rgbe", ".pic":
+		return ReadRGBE(file)
+	case ".exr":
+		return ReadEXR(file)
+	}
+	return nil, fmt.Errorf("unknown HDR format %q", filename)
+}
+
+// SaveHDR writes f as a .pfm, .hdr or .exr file, picking the format from the
+// extension. EXR files are ZIP compressed.
+func SaveHDR(filename string, f *Framebuffer) error {
+	var write func(io.Writer, *Framebuffer) error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pfm":
+		write = WritePFM
+	case ".hdr", ".rgbe", ".pic":
+		write = WriteRGBE
+	case ".exr":
+		write = func(w io.Writer, f *Framebuffer) error {
+			return WriteEXR(w, f, EXRZip)
+		}
+	default:
+		return fmt.Errorf("unknown HDR format %q", filename)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(file, f); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// IsHDR reports whether filename has the extension of a format OpenHDR and
+// SaveHDR handle.
+func IsHDR(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pfm", ".hdr", ".rgbe", ".pic", ".exr":
+		return true
+	}
+	return false
+}
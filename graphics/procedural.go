@@ -0,0 +1,354 @@
+package graphics
+
+import (
+	"math"
+	"sort"
+)
+
+// Surface is the point a procedural texture is evaluated at: P in the
+// coordinates of the object, from the rest positions of its triangle, or in
+// scene coordinates where it has none, and UV its texture coordinates, nil
+// on triangles without UVs.
+type Surface struct {
+	P  *Vector3
+	UV *Vector2
+}
+
+// point returns P, or UV as (u, v, 0) when uv is set, multiplied by scale,
+// where zero means 1.
+func (s *Surface) point(uv bool, scale float64) *Vector3 {
+	p := s.P
+	if uv {
+		p = &Vector3{}
+		if s.UV != nil {
+			p = &Vector3{s.UV.X, s.UV.Y, 0}
+		}
+	}
+	if scale != 0 {
+		p = p.Scale(scale)
+	}
+	return p
+}
+
+// SurfaceMaterial is implemented by materials whose color depends on where
+// on the surface they are, rather than on the barycentric uv alone.
+type SurfaceMaterial interface {
+	CSurface(s *Surface) *Color
+}
+
+// Scalar is a procedural value, usually in 0..1, such as noise or a mask.
+type Scalar interface {
+	Value(s *Surface) float64
+}
+
+// Pattern is a procedural color.
+type Pattern interface {
+	At(s *Surface) *Color
+}
+
+// The scalars below read P, or the UV when their UV field is set, multiplied
+// by Scale, where zero means 1. Larger scales give smaller features.
+
+// Checker is 1 on every other unit cube, 0 on the rest.
+type Checker struct {
+	Scale float64
+	UV    bool
+}
+
+func (c *Checker) Value(s *Surface) float64 {
+	p := s.point(c.UV, c.Scale)
+	n := int(math.Floor(p.X)) + int(math.Floor(p.Y)) + int(math.Floor(p.Z))
+	return float64(n & 1)
+}
+
+// Grid is 1 on lines Width wide, as a fraction of a cell, along the unit
+// grid, and 0 inside the cells.
+type Grid struct {
+	Scale float64
+	Width float64
+	UV    bool
+}
+
+func (g *Grid) Value(s *Surface) float64 {
+	p := s.point(g.UV, g.Scale)
+	line := func(x float64) bool {
+		f := x - math.Floor(x)
+		return f < g.Width/2 || f > 1-g.Width/2
+	}
+	if line(p.X) || line(p.Y) || (!g.UV && line(p.Z)) {
+		return 1
+	}
+	return 0
+}
+
+// Stripes alternates between 0 and 1 every unit along Direction, +X when nil.
+type Stripes struct {
+	Scale     float64
+	Direction *Vector3
+	UV        bool
+}
+
+func (st *Stripes) Value(s *Surface) float64 {
+	dir := st.Direction
+	if dir == nil {
+		dir = &Vector3{1, 0, 0}
+	}
+	return float64(int(math.Floor(s.point(st.UV, st.Scale).Dot(dir))) & 1)
+}
+
+// Noise is Perlin noise, or simplex noise when Simplex is set, mapped into
+// 0..1.
+type Noise struct {
+	Scale   float64
+	UV      bool
+	Simplex bool
+}
+
+func (n *Noise) Value(s *Surface) float64 {
+	p := s.point(n.UV, n.Scale)
+	if n.Simplex {
+		return .5 + .5*SimplexNoise(p)
+	}
+	return .5 + .5*PerlinNoise(p)
+}
+
+// FBM is fractal Brownian motion: Octaves layers of noise, each Lacunarity
+// times finer and Gain times weaker than the last, 2 and .5 when zero. With
+// Turbulence the absolute values of the layers are summed, giving creases.
+// The result is roughly in 0..1.
+type FBM struct {
+	Scale      float64
+	UV         bool
+	Octaves    int
+	Lacunarity float64
+	Gain       float64
+	Simplex    bool
+	Turbulence bool
+}
+
+func (f *FBM) Value(s *Surface) float64 {
+	return f.fbm(s.point(f.UV, f.Scale))
+}
+
+func (f *FBM) fbm(p *Vector3) float64 {
+	lacunarity, gain := f.Lacunarity, f.Gain
+	if lacunarity == 0 {
+		lacunarity = 2
+	}
+	if gain == 0 {
+		gain = .5
+	}
+	noise := PerlinNoise
+	if f.Simplex {
+		noise = SimplexNoise
+	}
+	sum, amplitude, total := 0.0, 1.0, 0.0
+	for i := 0; i < maxi(f.Octaves, 1); i++ {
+		n := noise(p)
+		if f.Turbulence {
+			n = math.Abs(n)
+		}
+		sum += amplitude * n
+		total += amplitude
+		amplitude *= gain
+		p = p.Scale(lacunarity)
+	}
+	sum /= total
+	if f.Turbulence {
+		return math.Min(sum*2, 1)
+	}
+	return .5 + .5*sum
+}
+
+// Marble is veins across Direction, +X when nil, one per unit, bent by
+// Turbulence times turbulent noise of Octaves layers.
+type Marble struct {
+	Scale      float64
+	UV         bool
+	Direction  *Vector3
+	Turbulence float64
+	Octaves    int
+}
+
+func (m *Marble) Value(s *Surface) float64 {
+	p := s.point(m.UV, m.Scale)
+	dir := m.Direction
+	if dir == nil {
+		dir = &Vector3{1, 0, 0}
+	}
+	turbulence := (&FBM{Octaves: m.Octaves, Turbulence: true}).fbm(p)
+	return .5 + .5*math.Sin(math.Pi*(p.Dot(dir)+m.Turbulence*turbulence))
+}
+
+// Wood is growth rings around the Y axis, Rings per unit of radius, made
+// irregular by Turbulence times noise. It ramps from 0 to 1 across each ring.
+type Wood struct {
+	Scale      float64
+	UV         bool
+	Rings      float64
+	Turbulence float64
+}
+
+func (w *Wood) Value(s *Surface) float64 {
+	p := s.point(w.UV, w.Scale)
+	r := math.Hypot(p.X, p.Z)*w.Rings + w.Turbulence*PerlinNoise(p)
+	return r - math.Floor(r)
+}
+
+// Worley is cellular noise: the distance to the nearest of a set of random
+// points, one per unit cell, or with Edges the difference between the
+// distances to the two nearest, which is 0 along the cell borders. It is
+// clamped to 0..1.
+type Worley struct {
+	Scale float64
+	UV    bool
+	Edges bool
+}
+
+func (w *Worley) Value(s *Surface) float64 {
+	f1, f2 := WorleyNoise(s.point(w.UV, w.Scale))
+	if w.Edges {
+		return math.Min(f2-f1, 1)
+	}
+	return math.Min(f1, 1)
+}
+
+// Uniform is a Pattern of a single color.
+type Uniform struct {
+	Color *Color
+}
+
+func (u *Uniform) At(_ *Surface) *Color {
+	return u.Color
+}
+
+// ImagePattern reads a Texture at the UV of the surface, so that images can
+// be mixed with procedural patterns.
+type ImagePattern struct {
+	Texture *Texture
+	UV      *UVTransform
+}
+
+func (i *ImagePattern) At(s *Surface) *Color {
+	st := s.UV
+	if st == nil {
+		st = &Vector2{}
+	}
+	if i.UV != nil {
+		st = i.UV.Apply(st)
+	}
+	return i.Texture.At(st)
+}
+
+// Mix is A where Mask is 0 and B where it is 1, blending in between.
+type Mix struct {
+	A    Pattern
+	B    Pattern
+	Mask Scalar
+}
+
+func (m *Mix) At(s *Surface) *Color {
+	t := math.Min(math.Max(m.Mask.Value(s), 0), 1)
+	if t == 0 {
+		return m.A.At(s)
+	}
+	if t == 1 {
+		return m.B.At(s)
+	}
+	return ColorAdd(ColorScale(m.A.At(s), 1-t), ColorScale(m.B.At(s), t))
+}
+
+// RampStop is the color of a Ramp at a value.
+type RampStop struct {
+	At    float64
+	Color *Color
+}
+
+// Ramp maps Input to colors, interpolating between Stops, which are sorted
+// by NewRamp. Values beyond the ends take the end colors.
+type Ramp struct {
+	Input Scalar
+	Stops []*RampStop
+}
+
+func NewRamp(input Scalar, stops ...*RampStop) *Ramp {
+	sort.Slice(stops, func(i, j int) bool { return stops[i].At < stops[j].At })
+	return &Ramp{input, stops}
+}
+
+func (r *Ramp) At(s *Surface) *Color {
+	x := r.Input.Value(s)
+	if x <= r.Stops[0].At {
+		return r.Stops[0].Color
+	}
+	for k := 1; k < len(r.Stops); k++ {
+		a, b := r.Stops[k-1], r.Stops[k]
+		if x <= b.At {
+			t := (x - a.At) / (b.At - a.At)
+			return ColorAdd(ColorScale(a.Color, 1-t), ColorScale(b.Color, t))
+		}
+	}
+	return r.Stops[len(r.Stops)-1].Color
+}
+
+// CheckerPattern is a checkerboard of a and b with squares 1/scale wide.
+func CheckerPattern(a, b *Color, scale float64) Pattern {
+	return &Mix{&Uniform{a}, &Uniform{b}, &Checker{Scale: scale}}
+}
+
+// MarblePattern is veins of vein color through base.
+func MarblePattern(base, vein *Color, scale float64) Pattern {
+	return NewRamp(&Marble{Scale: scale, Turbulence: 4, Octaves: 5},
+		&RampStop{0, vein},
+		&RampStop{.3, base},
+		&RampStop{1, base},
+	)
+}
+
+// WoodPattern is rings of dark alternating with light.
+func WoodPattern(light, dark *Color, scale float64) Pattern {
+	return NewRamp(&Wood{Scale: scale, Rings: 8, Turbulence: .5},
+		&RampStop{0, light},
+		&RampStop{.7, light},
+		&RampStop{1, dark},
+	)
+}
+
+// ProceduralMaterial colors a surface with a Pattern. On its own, without
+// the surface point, it evaluates the pattern at the barycentric uv.
+type ProceduralMaterial struct {
+	Pattern       Pattern
+	SpecColor_    *Color
+	SpecCoeff_    float64
+	AmbientCoeff_ float64
+	Emission_     *Color
+	Normals       *NormalMap
+}
+
+func (p *ProceduralMaterial) C(uv *Vector2) *Color {
+	return p.Pattern.At(&Surface{P: &Vector3{uv.X, uv.Y, 0}, UV: uv})
+}
+
+func (p *ProceduralMaterial) CSurface(s *Surface) *Color {
+	return p.Pattern.At(s)
+}
+
+func (p *ProceduralMaterial) PerturbNormal(st *Vector2, normal, tangent, bitangent *Vector3) *Vector3 {
+	if p.Normals == nil {
+		return normal
+	}
+	return p.Normals.Perturb(st, normal, tangent, bitangent)
+}
+
+func (p *ProceduralMaterial) SpecColor(_ *Vector2) *Color {
+	return p.SpecColor_
+}
+func (p *ProceduralMaterial) SpecCoeff(_ *Vector2) float64 {
+	return p.SpecCoeff_
+}
+func (p *ProceduralMaterial) AmbientCoeff(_ *Vector2) float64 {
+	return p.AmbientCoeff_
+}
+func (p *ProceduralMaterial) Emission(_ *Vector2) *Color {
+	return p.Emission_
+}
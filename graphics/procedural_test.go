@@ -0,0 +1,121 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	c := &Checker{Scale: 2}
+	for _, tc := range []struct {
+		p    *Vector3
+		want float64
+	}{
+		{&Vector3{.1, .1, .1}, 0},
+		{&Vector3{.6, .1, .1}, 1},
+		{&Vector3{.6, .6, .1}, 0},
+		{&Vector3{-.1, .1, .1}, 1},
+	} {
+		if got := c.Value(&Surface{P: tc.p}); got != tc.want {
+			t.Errorf("Checker at %v = %v, want %v", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestNoise(t *testing.T) {
+	for i := -3; i <= 3; i++ {
+		p := &Vector3{float64(i), float64(2 * i), float64(-i)}
+		if n := PerlinNoise(p); n != 0 {
+			t.Errorf("PerlinNoise(%v) = %v, want 0 at integer points", p, n)
+		}
+	}
+	for k := 0; k < 1000; k++ {
+		p := &Vector3{float64(k) * .137, float64(k) * .071, float64(k) * .253}
+		if n := PerlinNoise(p); n < -1.1 || n > 1.1 {
+			t.Errorf("PerlinNoise(%v) = %v, out of range", p, n)
+		}
+		if n := SimplexNoise(p); n < -1.1 || n > 1.1 {
+			t.Errorf("SimplexNoise(%v) = %v, out of range", p, n)
+		}
+		if f1, f2 := WorleyNoise(p); f1 < 0 || f1 > f2 {
+			t.Errorf("WorleyNoise(%v) = %v, %v, want 0 <= f1 <= f2", p, f1, f2)
+		}
+		s := &Surface{P: p}
+		for _, v := range []Scalar{&FBM{Octaves: 4}, &FBM{Octaves: 4, Turbulence: true}, &Marble{Turbulence: 2, Octaves: 3}, &Wood{Rings: 4}, &Worley{}} {
+			if x := v.Value(s); x < 0 || x > 1 {
+				t.Errorf("%T at %v = %v, want it in 0..1", v, p, x)
+			}
+		}
+	}
+	p := &Vector3{1.3, 2.7, .4}
+	if PerlinNoise(p) != PerlinNoise(&Vector3{1.3, 2.7, .4}) {
+		t.Error("PerlinNoise is not deterministic")
+	}
+}
+
+type constScalar float64
+
+func (c constScalar) Value(_ *Surface) float64 { return float64(c) }
+
+func TestRamp(t *testing.T) {
+	black, white := &Color{A: 255}, &Color{255, 255, 255, 255}
+	s := &Surface{P: &Vector3{}}
+	for _, tc := range []struct {
+		x    float64
+		want float64
+	}{{-1, 0}, {.2, 0}, {.6, 127.5}, {1, 255}, {2, 255}} {
+		r := NewRamp(constScalar(tc.x), &RampStop{1, white}, &RampStop{.2, black})
+		if got := r.At(s); math.Abs(got.R-tc.want) > 1e-9 {
+			t.Errorf("Ramp at %v = %v, want %v", tc.x, got.R, tc.want)
+		}
+	}
+	m := &Mix{&Uniform{black}, &Uniform{white}, constScalar(.25)}
+	if got := m.At(s); math.Abs(got.G-63.75) > 1e-9 {
+		t.Errorf("Mix at .25 = %v, want 63.75", got.G)
+	}
+}
+
+func TestProceduralMaterial_bind(t *testing.T) {
+	tri := uvTriangle()
+	uv := &Vector2{.25, .25}
+	want := tri.P0.Scale(.25).Add(tri.P1.Scale(.25)).Add(tri.P2.Scale(.5))
+	origin := &Vector3{.5, 0, 0}
+
+	for _, o := range []*Vector3{zero, origin} {
+		var got *Surface
+		probe := &ProceduralMaterial{Pattern: patternFunc(func(s *Surface) *Color {
+			got = s
+			return &Color{}
+		})}
+		bind(probe, tri, o, nil, nil).C(uv)
+		if got.P.Sub(want.Add(o)).Norm() > 1e-9 {
+			t.Errorf("surface point with origin %v = %v, want %v", o, got.P, want.Add(o))
+		}
+		if w := tri.TexCoord(uv); math.Abs(got.UV.X-w.X)+math.Abs(got.UV.Y-w.Y) > 1e-9 {
+			t.Errorf("surface uv = %v, want %v", got.UV, tri.TexCoord(uv))
+		}
+	}
+}
+
+func TestProceduralMaterial_restPositions(t *testing.T) {
+	tri := uvTriangle()
+	uv := &Vector2{.25, .25}
+	want := tri.P0.Scale(.25).Add(tri.P1.Scale(.25)).Add(tri.P2.Scale(.5))
+	var got *Surface
+	probe := &ProceduralMaterial{Pattern: patternFunc(func(s *Surface) *Color {
+		got = s
+		return &Color{}
+	})}
+	tri.Material = probe
+	// However the triangle is moved, the pattern sees it where it was made.
+	moved := ApplyTransform([]*Triangle{tri}, Translate(3, 1, 2).Mult(RotX(.4)))
+	moved = ApplyTransform(moved, RotY(1).Mult(Scale(2)))
+	bind(probe, moved[0], zero, nil, nil).C(uv)
+	if got.P.Sub(want).Norm() > 1e-9 {
+		t.Errorf("surface point of the moved triangle = %v, want %v", got.P, want)
+	}
+}
+
+type patternFunc func(s *Surface) *Color
+
+func (f patternFunc) At(s *Surface) *Color { return f(s) }
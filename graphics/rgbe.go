@@ -0,0 +1,191 @@
+package graphics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// WriteRGBE writes f as a run length encoded Radiance .hdr file.
+func WriteRGBE(w io.Writer, f *Framebuffer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", f.Height, f.Width); err != nil {
+		return err
+	}
+	line := make([]byte, 4*f.Width)
+	for j := 0; j < f.Height; j++ {
+		for i := 0; i < f.Width; i++ {
+			copy(line[4*i:], toRGBE(f.At(i, j)))
+		}
+		if f.Width < 8 || f.Width > 0x7fff {
+			if _, err := bw.Write(line); err != nil {
+				return err
+			}
+			continue
+		}
+		bw.Write([]byte{2, 2, byte(f.Width >> 8), byte(f.Width)})
+		component := make([]byte, f.Width)
+		for k := 0; k < 4; k++ {
+			for i := range component {
+				component[i] = line[4*i+k]
+			}
+			writeRLE(bw, component)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeRLE writes one component of a scanline as runs of at most 127 equal
+// bytes, or literal stretches of at most 128 bytes.
+func writeRLE(w *bufio.Writer, data []byte) {
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && run < 127 && data[i+run] == data[i] {
+			run++
+		}
+		if run > 2 {
+			w.Write([]byte{byte(128 + run), data[i]})
+			i += run
+			continue
+		}
+		n := 1
+		for i+n < len(data) && n < 128 {
+			if i+n+2 < len(data) && data[i+n] == data[i+n+1] && data[i+n] == data[i+n+2] {
+				break
+			}
+			n++
+		}
+		w.WriteByte(byte(n))
+		w.Write(data[i : i+n])
+		i += n
+	}
+}
+
+func toRGBE(c *Color) []byte {
+	r, g, b := c.R/255, c.G/255, c.B/255
+	v := math.Max(r, math.Max(g, b))
+	if v < 1e-32 {
+		return []byte{0, 0, 0, 0}
+	}
+	m, e := math.Frexp(v)
+	scale := m * 256 / v
+	return []byte{
+		byte(math.Max(r, 0) * scale),
+		byte(math.Max(g, 0) * scale),
+		byte(math.Max(b, 0) * scale),
+		byte(e + 128),
+	}
+}
+
+func fromRGBE(p []byte) *Color {
+	if p[3] == 0 {
+		return &Color{A: 255}
+	}
+	f := 255 * math.Ldexp(1, int(p[3])-128-8)
+	return &Color{
+		R: (float64(p[0]) + .5) * f,
+		G: (float64(p[1]) + .5) * f,
+		B: (float64(p[2]) + .5) * f,
+		A: 255,
+	}
+}
+
+// ReadRGBE reads a Radiance .hdr file with flat or run length encoded
+// scanlines in the standard -Y +X orientation.
+func ReadRGBE(r io.Reader) (*Framebuffer, error) {
+	br := bufio.NewReader(r)
+	first, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(first, "#?") {
+		return nil, fmt.Errorf("rgbe: missing #? header")
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("rgbe: unsupported %s", line)
+		}
+	}
+	var width, height int
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, fmt.Errorf("rgbe: unsupported resolution line %q", strings.TrimSpace(resolution))
+	}
+	if !readableSize(width, height) {
+		return nil, fmt.Errorf("rgbe: bad size %dx%d", width, height)
+	}
+	f := NewFramebuffer(width, height)
+	line := make([]byte, 4*width)
+	for j := 0; j < height; j++ {
+		if err := readScanline(br, line, width); err != nil {
+			return nil, err
+		}
+		for i := 0; i < width; i++ {
+			f.Set(i, j, fromRGBE(line[4*i:]))
+		}
+	}
+	return f, nil
+}
+
+func readScanline(br *bufio.Reader, line []byte, width int) error {
+	head, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || head[0] != 2 || head[1] != 2 || head[2]&0x80 != 0 {
+		_, err := io.ReadFull(br, line)
+		return err
+	}
+	if int(head[2])<<8|int(head[3]) != width {
+		return fmt.Errorf("rgbe: scanline width mismatch")
+	}
+	br.Discard(4)
+	for k := 0; k < 4; k++ {
+		for i := 0; i < width; {
+			n, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if n > 128 {
+				run := int(n) - 128
+				v, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				if i+run > width {
+					return fmt.Errorf("rgbe: run overflows scanline")
+				}
+				for ; run > 0; run-- {
+					line[4*i+k] = v
+					i++
+				}
+				continue
+			}
+			if n == 0 || i+int(n) > width {
+				return fmt.Errorf("rgbe: bad literal length %d", n)
+			}
+			for ; n > 0; n-- {
+				v, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				line[4*i+k] = v
+				i++
+			}
+		}
+	}
+	return nil
+}
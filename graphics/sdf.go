@@ -0,0 +1,278 @@
+package graphics
+
+import "math"
+
+// SDF is a signed distance field: a shape given by the distance from any
+// point to its surface, negative inside. Distance also returns the material
+// of the surface nearest p. Fields may underestimate the distance, as the
+// smooth and repeated ones do, but never overestimate it.
+type SDF interface {
+	Distance(p *Vector3) (float64, Material)
+}
+
+// SDFSphere is the sphere of Radius around Center.
+type SDFSphere struct {
+	Center   *Vector3
+	Radius   float64
+	Material Material
+}
+
+func (s *SDFSphere) Distance(p *Vector3) (float64, Material) {
+	return p.Sub(s.Center).Norm() - s.Radius, s.Material
+}
+
+// SDFBox is the axis aligned box around Center reaching out by HalfSize,
+// with its edges rounded off by Rounding.
+type SDFBox struct {
+	Center   *Vector3
+	HalfSize *Vector3
+	Rounding float64
+	Material Material
+}
+
+func (s *SDFBox) Distance(p *Vector3) (float64, Material) {
+	d := p.Sub(s.Center)
+	q := &Vector3{
+		math.Abs(d.X) - s.HalfSize.X + s.Rounding,
+		math.Abs(d.Y) - s.HalfSize.Y + s.Rounding,
+		math.Abs(d.Z) - s.HalfSize.Z + s.Rounding,
+	}
+	outside := (&Vector3{math.Max(q.X, 0), math.Max(q.Y, 0), math.Max(q.Z, 0)}).Norm()
+	inside := math.Min(max3(q.X, q.Y, q.Z), 0)
+	return outside + inside - s.Rounding, s.Material
+}
+
+// SDFTorus is the ring of radius Major around the Y axis through Center of
+// a tube of radius Minor.
+type SDFTorus struct {
+	Center   *Vector3
+	Major    float64
+	Minor    float64
+	Material Material
+}
+
+func (s *SDFTorus) Distance(p *Vector3) (float64, Material) {
+	d := p.Sub(s.Center)
+	return math.Hypot(math.Hypot(d.X, d.Z)-s.Major, d.Y) - s.Minor, s.Material
+}
+
+// SDFCapsule is the segment from A to B thickened by Radius.
+type SDFCapsule struct {
+	A        *Vector3
+	B        *Vector3
+	Radius   float64
+	Material Material
+}
+
+func (s *SDFCapsule) Distance(p *Vector3) (float64, Material) {
+	pa, ba := p.Sub(s.A), s.B.Sub(s.A)
+	h := math.Max(0, math.Min(1, pa.Dot(ba)/ba.Dot(ba)))
+	return pa.Sub(ba.Scale(h)).Norm() - s.Radius, s.Material
+}
+
+// SDFPlane is the half space behind the plane through Point facing Normal.
+type SDFPlane struct {
+	Point    *Vector3
+	Normal   *Vector3
+	Material Material
+}
+
+func (s *SDFPlane) Distance(p *Vector3) (float64, Material) {
+	return p.Sub(s.Point).Dot(s.Normal.Normalize()), s.Material
+}
+
+// SDFUnion is everything inside A or B.
+type SDFUnion struct {
+	A SDF
+	B SDF
+}
+
+func (s *SDFUnion) Distance(p *Vector3) (float64, Material) {
+	a, ma := s.A.Distance(p)
+	b, mb := s.B.Distance(p)
+	if b < a {
+		return b, mb
+	}
+	return a, ma
+}
+
+// SDFIntersection is everything inside both A and B.
+type SDFIntersection struct {
+	A SDF
+	B SDF
+}
+
+func (s *SDFIntersection) Distance(p *Vector3) (float64, Material) {
+	a, ma := s.A.Distance(p)
+	b, mb := s.B.Distance(p)
+	if b > a {
+		return b, mb
+	}
+	return a, ma
+}
+
+// SDFSubtraction is A with B cut out of it. The cut faces take the material
+// of B.
+type SDFSubtraction struct {
+	A SDF
+	B SDF
+}
+
+func (s *SDFSubtraction) Distance(p *Vector3) (float64, Material) {
+	a, ma := s.A.Distance(p)
+	b, mb := s.B.Distance(p)
+	if -b > a {
+		return -b, mb
+	}
+	return a, ma
+}
+
+// SDFSmoothUnion is the union of A and B blended together where they are
+// within K of each other, taking the material of the nearer.
+type SDFSmoothUnion struct {
+	A SDF
+	B SDF
+	K float64
+}
+
+func (s *SDFSmoothUnion) Distance(p *Vector3) (float64, Material) {
+	a, ma := s.A.Distance(p)
+	b, mb := s.B.Distance(p)
+	m := ma
+	if b < a {
+		m = mb
+	}
+	if s.K <= 0 {
+		return math.Min(a, b), m
+	}
+	h := math.Max(0, math.Min(1, .5+.5*(b-a)/s.K))
+	return lerp(h, b, a) - s.K*h*(1-h), m
+}
+
+// SDFRepeat repeats SDF every Period along each axis, around the origin.
+// A zero component of Period leaves that axis alone. SDF should fit within
+// one period for the distance to stay exact.
+type SDFRepeat struct {
+	SDF    SDF
+	Period *Vector3
+}
+
+func (s *SDFRepeat) Distance(p *Vector3) (float64, Material) {
+	rep := func(x, period float64) float64 {
+		if period == 0 {
+			return x
+		}
+		return x - period*math.Floor(x/period+.5)
+	}
+	return s.SDF.Distance(&Vector3{rep(p.X, s.Period.X), rep(p.Y, s.Period.Y), rep(p.Z, s.Period.Z)})
+}
+
+// SDFTransform is SDF moved by a matrix. Make it with TransformSDF.
+type SDFTransform struct {
+	SDF     SDF
+	inverse *Mat4
+	scale   float64
+}
+
+// TransformSDF returns s moved by m, which may rotate, translate and scale
+// uniformly, but not skew or stretch.
+func TransformSDF(s SDF, m *Mat4) SDF {
+	scale := transformLength(m, 1)
+	inverse := NewMat4()
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			inverse.Set(i, j, m.At(j, i)/(scale*scale))
+		}
+	}
+	t := inverse.Dot((&Vector3{m.At(0, 3), m.At(1, 3), m.At(2, 3)}).Ext()).Unex()
+	for i, v := range []float64{t.X, t.Y, t.Z} {
+		inverse.Set(i, 3, -v)
+	}
+	return &SDFTransform{s, inverse, scale}
+}
+
+func (s *SDFTransform) Distance(p *Vector3) (float64, Material) {
+	d, m := s.SDF.Distance(transformPoint(s.inverse, p))
+	return d * s.scale, m
+}
+
+// SDFShape sphere traces an SDF, so that the ray tracer can render it as a
+// Shape, with shadows and reflections, alongside triangles and the analytic
+// shapes. Zero fields take defaults.
+type SDFShape struct {
+	SDF SDF
+	// MaxSteps is the most steps a ray takes, 256 by default.
+	MaxSteps int
+	// Epsilon is how close a ray comes to the surface to hit it, 1e-4 by
+	// default.
+	Epsilon float64
+	// MaxDistance is how far a ray travels before it misses, 100 by default.
+	MaxDistance float64
+}
+
+func (s *SDFShape) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	steps, eps, far := s.MaxSteps, s.Epsilon, s.MaxDistance
+	if steps == 0 {
+		steps = 256
+	}
+	if eps == 0 {
+		eps = 1e-4
+	}
+	if far == 0 {
+		far = 100
+	}
+	l := dir.Norm()
+	t := tMin
+	// A ray leaving a surface, as reflections and shadow rays do, starts
+	// within eps of it, so it creeps forward until it is clear.
+	leaving := true
+	for i := 0; i < steps && t < tMax && t*l < far; i++ {
+		p := origin.Add(dir.Scale(t))
+		d, m := s.SDF.Distance(p)
+		if leaving {
+			if d < -eps {
+				return s.hit(p, t, m, eps)
+			}
+			if d < eps {
+				t += 2 * eps / l
+				continue
+			}
+			leaving = false
+		}
+		if d < eps {
+			return s.hit(p, t, m, eps)
+		}
+		t += d / l
+	}
+	return nil
+}
+
+// hit builds the Hit at p. The normal is the gradient of the field, and the
+// texture coordinates project p onto the plane facing the normal most.
+func (s *SDFShape) hit(p *Vector3, t float64, m Material, eps float64) *Hit {
+	dist := func(x, y, z float64) float64 {
+		d, _ := s.SDF.Distance(&Vector3{p.X + x, p.Y + y, p.Z + z})
+		return d
+	}
+	n := (&Vector3{
+		dist(eps, 0, 0) - dist(-eps, 0, 0),
+		dist(0, eps, 0) - dist(0, -eps, 0),
+		dist(0, 0, eps) - dist(0, 0, -eps),
+	}).Normalize()
+	uv := &Vector2{p.X, p.Z}
+	switch ax, ay, az := math.Abs(n.X), math.Abs(n.Y), math.Abs(n.Z); {
+	case ax > ay && ax > az:
+		uv = &Vector2{p.Z, p.Y}
+	case az > ay:
+		uv = &Vector2{p.X, p.Y}
+	}
+	return &Hit{T: t, P: p, Normal: n, UV: uv, Material: m}
+}
+
+func (s *SDFShape) Bounds() *Bounds {
+	return nil
+}
+
+func (s *SDFShape) Transform(m *Mat4) Shape {
+	return &SDFShape{TransformSDF(s.SDF, m), s.MaxSteps, s.Epsilon, s.MaxDistance}
+}
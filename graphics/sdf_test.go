@@ -0,0 +1,83 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSDF_Distance(t *testing.T) {
+	a, b := &SolidMaterial{}, &SolidMaterial{}
+	sphere := &SDFSphere{&Vector3{}, 1, a}
+	box := &SDFBox{&Vector3{}, &Vector3{1, 2, 3}, 0, b}
+	for _, tc := range []struct {
+		name string
+		sdf  SDF
+		p    *Vector3
+		want float64
+		mat  Material
+	}{
+		{"sphere", sphere, &Vector3{0, 3, 0}, 2, a},
+		{"sphere inside", sphere, &Vector3{.5, 0, 0}, -.5, a},
+		{"box face", box, &Vector3{0, 0, 5}, 2, b},
+		{"box corner", box, &Vector3{2, 3, 3}, math.Sqrt2, b},
+		{"box inside", box, &Vector3{.5, 0, 0}, -.5, b},
+		{"rounded box", &SDFBox{&Vector3{}, &Vector3{1, 1, 1}, .5, b}, &Vector3{2, 2, 0}, math.Sqrt2*1.5 - .5, b},
+		{"torus", &SDFTorus{&Vector3{}, 2, .5, a}, &Vector3{2, 1, 0}, .5, a},
+		{"capsule", &SDFCapsule{&Vector3{0, 0, 0}, &Vector3{0, 2, 0}, .5, a}, &Vector3{0, 3, 0}, .5, a},
+		{"capsule side", &SDFCapsule{&Vector3{0, 0, 0}, &Vector3{0, 2, 0}, .5, a}, &Vector3{2, 1, 0}, 1.5, a},
+		{"plane", &SDFPlane{&Vector3{0, 1, 0}, &Vector3{0, -2, 0}, a}, &Vector3{5, -1, 5}, 2, a},
+		{"union", &SDFUnion{sphere, box}, &Vector3{0, 0, 5}, 2, b},
+		{"intersection", &SDFIntersection{sphere, box}, &Vector3{0, 0, 5}, 4, a},
+		{"subtraction", &SDFSubtraction{box, sphere}, &Vector3{0, 0, 0}, 1, a},
+		{"repeat", &SDFRepeat{sphere, &Vector3{10, 0, 0}}, &Vector3{21, 0, 0}, 0, a},
+		{"transform", TransformSDF(sphere, Translate(5, 0, 0).Mult(RotY(1)).Mult(Scale(2))), &Vector3{5, 0, 3}, 1, a},
+	} {
+		d, m := tc.sdf.Distance(tc.p)
+		if math.Abs(d-tc.want) > 1e-9 || m != tc.mat {
+			t.Errorf("%s at %v is %v, want %v", tc.name, tc.p, d, tc.want)
+		}
+	}
+
+	smooth := &SDFSmoothUnion{sphere, &SDFSphere{&Vector3{1.5, 0, 0}, 1, b}, .5}
+	p := &Vector3{.75, 1, 0}
+	d, _ := smooth.Distance(p)
+	hard, _ := (&SDFUnion{smooth.A, smooth.B}).Distance(p)
+	if d >= hard {
+		t.Errorf("smooth union at the seam is %v, want it below the union %v", d, hard)
+	}
+	if d, _ := smooth.Distance(&Vector3{-3, 0, 0}); math.Abs(d-2) > 1e-9 {
+		t.Errorf("smooth union far from the seam is %v, want 2", d)
+	}
+}
+
+func TestSDFShape(t *testing.T) {
+	m := &SolidMaterial{}
+	exact := &SphereShape{&Vector3{0, 0, 5}, 1, m}
+	marched := &SDFShape{SDF: &SDFSphere{exact.Center, exact.Radius, m}}
+	for _, dir := range []*Vector3{{0, 0, 1}, {.1, .1, 1}, {-.15, 0, 2}} {
+		want, got := exact.Intersect(zero, dir, 0, math.Inf(1)), marched.Intersect(zero, dir, 0, math.Inf(1))
+		if got == nil {
+			t.Fatalf("ray %v missed the field", dir)
+		}
+		if got.P.Sub(want.P).Norm() > 1e-3 || got.Normal.Sub(want.Normal).Norm() > 1e-3 || got.Material != m {
+			t.Errorf("ray %v hit %v facing %v, want %v facing %v", dir, got.P, got.Normal, want.P, want.Normal)
+		}
+	}
+	if h := marched.Intersect(zero, &Vector3{1, 0, 1}, 0, math.Inf(1)); h != nil {
+		t.Errorf("ray past the sphere hit at %v", h.P)
+	}
+	if h := marched.Intersect(zero, &Vector3{0, 0, 1}, 0, 3); h != nil {
+		t.Errorf("ray stopping short of the sphere hit at %v", h.P)
+	}
+
+	// Rays leaving the surface do not hit the point they leave from when
+	// they head out, and are blocked at once when they head in, as shadow
+	// rays should be.
+	front := marched.Intersect(zero, &Vector3{0, 0, 1}, 0, math.Inf(1)).P
+	if h := marched.Intersect(front, &Vector3{0, 0, -1}, shapeEpsilon, math.Inf(1)); h != nil {
+		t.Errorf("ray leaving the sphere hit it again at %v", h.P)
+	}
+	if h := marched.Intersect(front, &Vector3{0, 0, 1}, shapeEpsilon, math.Inf(1)); h == nil || h.T > .01 {
+		t.Errorf("ray into the sphere hit %+v, want it blocked where it starts", h)
+	}
+}
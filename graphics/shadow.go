@@ -0,0 +1,393 @@
+package graphics
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// ShadowOptions controls how shadow maps are built and sampled.
+type ShadowOptions struct {
+	Resolution int     // texels along each side of a map (or cube face)
+	Bias       float64 // constant depth bias in world units
+	SlopeBias  float64 // bias in texels per unit tangent of the angle between normal and light
+	PCFRadius  int     // half width of the percentage-closer filter kernel, 0 for hard shadows
+}
+
+var DefaultShadowOptions = &ShadowOptions{
+	Resolution: 1024,
+	Bias:       .002,
+	SlopeBias:  1,
+	PCFRadius:  1,
+}
+
+// ShadowMap reports how much of a light reaches a point, from 0 (fully
+// shadowed) to 1 (fully lit).
+type ShadowMap interface {
+	Visibility(v, normal *Vector3) float64
+}
+
+// NewShadowMap builds the shadow map matching the type of l. Lights without
+// shadow map support return nil, which the renderers treat as always lit.
+func NewShadowMap(l Light, env []*Triangle, opts *ShadowOptions) ShadowMap {
+	switch light := l.(type) {
+	case *DirectionLight:
+		return NewDirectionShadowMap(light, env, opts)
+	case *PointLight:
+		return NewPointShadowMap(light, env, opts)
+	case *SpotLight:
+		return NewCubeShadowMap(light.Location, 0, env, opts)
+	case *RectLight:
+		return NewCubeShadowMap(light.Center, max(light.U.Norm(), light.V.Norm()), env, opts)
+	case *DiskLight:
+		return NewCubeShadowMap(light.Center, light.Radius, env, opts)
+	case *SphereLight:
+		return NewCubeShadowMap(light.Center, light.Radius, env, opts)
+	case *MeshLight:
+		return NewCubeShadowMap(light.Center(), light.Radius(), env, opts)
+	}
+	return nil
+}
+
+func NewShadowMaps(l []Light, env []*Triangle, opts *ShadowOptions) []ShadowMap {
+	res := make([]ShadowMap, len(l))
+	wg := sync.WaitGroup{}
+	for i, light := range l {
+		wg.Add(1)
+		go func(i int, light Light) {
+			res[i] = NewShadowMap(light, env, opts)
+			wg.Done()
+		}(i, light)
+	}
+	wg.Wait()
+	return res
+}
+
+type depthBuffer struct {
+	Width  int
+	Height int
+	Depth  []float64
+}
+
+func newDepthBuffer(width, height int) *depthBuffer {
+	d := &depthBuffer{
+		Width:  width,
+		Height: height,
+		Depth:  make([]float64, width*height),
+	}
+	for i := range d.Depth {
+		d.Depth[i] = math.Inf(1)
+	}
+	return d
+}
+
+// rasterize writes the nearest depth of a triangle whose X and Y are given in
+// texel coordinates. With perspective set, Z is a view depth and 1/Z is
+// interpolated so that depth stays correct across the projected triangle.
+func (d *depthBuffer) rasterize(p0, p1, p2 *Vector3, perspective bool) {
+	area := edge(p0, p1, p2.X, p2.Y)
+	if area == 0 {
+		return
+	}
+	z0, z1, z2 := p0.Z, p1.Z, p2.Z
+	if perspective {
+		z0, z1, z2 = 1/z0, 1/z1, 1/z2
+	}
+	minx := maxi(int(math.Floor(min3(p0.X, p1.X, p2.X))), 0)
+	miny := maxi(int(math.Floor(min3(p0.Y, p1.Y, p2.Y))), 0)
+	maxx := mini(int(math.Ceil(max3(p0.X, p1.X, p2.X))), d.Width-1)
+	maxy := mini(int(math.Ceil(max3(p0.Y, p1.Y, p2.Y))), d.Height-1)
+	for i := minx; i <= maxx; i++ {
+		for j := miny; j <= maxy; j++ {
+			x := float64(i) + .5
+			y := float64(j) + .5
+			w0 := edge(p1, p2, x, y) / area
+			w1 := edge(p2, p0, x, y) / area
+			w2 := 1 - w0 - w1
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+			z := w0*z0 + w1*z1 + w2*z2
+			if perspective {
+				z = 1 / z
+			}
+			if z < d.Depth[j*d.Width+i] {
+				d.Depth[j*d.Width+i] = z
+			}
+		}
+	}
+}
+
+// lit runs a percentage-closer filter around texel coordinate (x, y) and
+// returns the fraction of samples that are not occluded at depth z. Samples
+// outside of the map count as lit.
+func (d *depthBuffer) lit(x, y, z float64, radius int) float64 {
+	ci := int(math.Floor(x))
+	cj := int(math.Floor(y))
+	var lit, total float64
+	for i := ci - radius; i <= ci+radius; i++ {
+		for j := cj - radius; j <= cj+radius; j++ {
+			total++
+			if i < 0 || j < 0 || i >= d.Width || j >= d.Height || z <= d.Depth[j*d.Width+i] {
+				lit++
+			}
+		}
+	}
+	return lit / total
+}
+
+// blocker averages the depth of the texels around (x, y) that occlude depth z.
+func (d *depthBuffer) blocker(x, y, z float64, radius int) (float64, bool) {
+	ci := int(math.Floor(x))
+	cj := int(math.Floor(y))
+	var sum, ct float64
+	for i := maxi(ci-radius, 0); i <= mini(ci+radius, d.Width-1); i++ {
+		for j := maxi(cj-radius, 0); j <= mini(cj+radius, d.Height-1); j++ {
+			if depth := d.Depth[j*d.Width+i]; depth < z {
+				sum += depth
+				ct++
+			}
+		}
+	}
+	if ct == 0 {
+		return 0, false
+	}
+	return sum / ct, true
+}
+
+func edge(a, b *Vector3, x, y float64) float64 {
+	return (b.X-a.X)*(y-a.Y) - (b.Y-a.Y)*(x-a.X)
+}
+
+// orthoBasis returns two unit vectors perpendicular to the unit vector n and
+// to each other.
+func orthoBasis(n *Vector3) (*Vector3, *Vector3) {
+	helper := &Vector3{1, 0, 0}
+	if math.Abs(n.X) > .9 {
+		helper = &Vector3{0, 1, 0}
+	}
+	t := Cross(n, helper).Normalize()
+	return t, Cross(n, t)
+}
+
+func shadowBias(opts *ShadowOptions, normal, lnorm *Vector3, texel float64) float64 {
+	cos := math.Abs(normal.Dot(lnorm))
+	tan := 10.0
+	if cos > .1 {
+		tan = math.Sqrt(1-cos*cos) / cos
+	}
+	return opts.Bias + opts.SlopeBias*tan*texel
+}
+
+// DirectionShadowMap is an orthographic depth map covering the whole scene as
+// seen along the direction of a DirectionLight.
+type DirectionShadowMap struct {
+	Light   *DirectionLight
+	Options *ShadowOptions
+
+	right *Vector3
+	up    *Vector3
+	dir   *Vector3
+	minX  float64
+	minY  float64
+	maxX  float64
+	maxY  float64
+	buf   *depthBuffer
+}
+
+func NewDirectionShadowMap(l *DirectionLight, env []*Triangle, opts *ShadowOptions) *DirectionShadowMap {
+	s := &DirectionShadowMap{
+		Light:   l,
+		Options: opts,
+		dir:     l.Direction.Normalize(),
+		minX:    math.Inf(1),
+		minY:    math.Inf(1),
+		maxX:    math.Inf(-1),
+		maxY:    math.Inf(-1),
+		buf:     newDepthBuffer(opts.Resolution, opts.Resolution),
+	}
+	s.right, s.up = orthoBasis(s.dir)
+	for _, t := range env {
+		for _, p := range []*Vector3{t.P0, t.P1, t.P2} {
+			x, y := p.Dot(s.right), p.Dot(s.up)
+			s.minX, s.maxX = min(s.minX, x), max(s.maxX, x)
+			s.minY, s.maxY = min(s.minY, y), max(s.maxY, y)
+		}
+	}
+	margin := .01 * max(s.maxX-s.minX, s.maxY-s.minY)
+	s.minX, s.minY = s.minX-margin, s.minY-margin
+	s.maxX, s.maxY = s.maxX+margin, s.maxY+margin
+	for _, t := range env {
+		s.buf.rasterize(s.project(t.P0), s.project(t.P1), s.project(t.P2), false)
+	}
+	return s
+}
+
+func (s *DirectionShadowMap) project(p *Vector3) *Vector3 {
+	return &Vector3{
+		X: lin(p.Dot(s.right), s.minX, s.maxX, 0, float64(s.buf.Width)),
+		Y: lin(p.Dot(s.up), s.minY, s.maxY, 0, float64(s.buf.Height)),
+		Z: p.Dot(s.dir),
+	}
+}
+
+func (s *DirectionShadowMap) Visibility(v, normal *Vector3) float64 {
+	p := s.project(v)
+	texel := (s.maxX - s.minX) / float64(s.buf.Width)
+	return s.buf.lit(p.X, p.Y, p.Z-shadowBias(s.Options, normal, s.dir, texel), s.Options.PCFRadius)
+}
+
+// PointShadowMap is a cube of six perspective depth maps around a light
+// position, one per axis direction. A non-zero Size treats the light as an
+// emitter of that radius and widens the filter with the estimated penumbra.
+type PointShadowMap struct {
+	Location *Vector3
+	Size     float64
+	Options  *ShadowOptions
+
+	faces [6]*depthBuffer
+}
+
+var cubeFaces = [6]*Vector3{
+	{1, 0, 0}, {-1, 0, 0},
+	{0, 1, 0}, {0, -1, 0},
+	{0, 0, 1}, {0, 0, -1},
+}
+
+const shadowNear = 1e-3
+
+// maxPenumbra caps the filter radius, in texels, used for soft shadows of
+// area lights.
+const maxPenumbra = 12
+
+func NewPointShadowMap(l *PointLight, env []*Triangle, opts *ShadowOptions) *PointShadowMap {
+	return NewCubeShadowMap(l.Location, 0, env, opts)
+}
+
+func NewCubeShadowMap(location *Vector3, size float64, env []*Triangle, opts *ShadowOptions) *PointShadowMap {
+	s := &PointShadowMap{
+		Location: location,
+		Size:     size,
+		Options:  opts,
+	}
+	wg := sync.WaitGroup{}
+	for f := range cubeFaces {
+		s.faces[f] = newDepthBuffer(opts.Resolution, opts.Resolution)
+		wg.Add(1)
+		go func(f int) {
+			for _, t := range env {
+				local := clipNear([]*Vector3{
+					s.local(f, t.P0),
+					s.local(f, t.P1),
+					s.local(f, t.P2),
+				}, shadowNear)
+				for k := 2; k < len(local); k++ {
+					s.faces[f].rasterize(s.project(local[0]), s.project(local[k-1]), s.project(local[k]), true)
+				}
+			}
+			wg.Done()
+		}(f)
+	}
+	wg.Wait()
+	return s
+}
+
+// local expresses p in the frame of cube face f, with Z pointing out of the
+// face.
+func (s *PointShadowMap) local(f int, p *Vector3) *Vector3 {
+	forward := cubeFaces[f]
+	right, up := orthoBasis(forward)
+	d := p.Sub(s.Location)
+	return &Vector3{d.Dot(right), d.Dot(up), d.Dot(forward)}
+}
+
+func (s *PointShadowMap) project(p *Vector3) *Vector3 {
+	res := float64(s.Options.Resolution)
+	return &Vector3{
+		X: lin(p.X/p.Z, -1, 1, 0, res),
+		Y: lin(p.Y/p.Z, -1, 1, 0, res),
+		Z: p.Z,
+	}
+}
+
+func (s *PointShadowMap) Visibility(v, normal *Vector3) float64 {
+	d := v.Sub(s.Location)
+	f := cubeFace(d)
+	p := s.project(s.local(f, v))
+	texel := 2 * p.Z / float64(s.Options.Resolution)
+	z := p.Z - shadowBias(s.Options, normal, d.Normalize(), texel)
+	radius := s.Options.PCFRadius
+	if s.Size > 0 {
+		search := mini(int(s.Size/texel)+1, maxPenumbra)
+		if blocker, ok := s.faces[f].blocker(p.X, p.Y, z, search); ok {
+			penumbra := s.Size * (z - blocker) / blocker
+			radius = mini(radius+int(penumbra/texel), maxPenumbra)
+		}
+	}
+	return s.faces[f].lit(p.X, p.Y, z, radius)
+}
+
+// cubeFace picks the face of the cube map that direction d passes through.
+func cubeFace(d *Vector3) int {
+	ax, ay, az := math.Abs(d.X), math.Abs(d.Y), math.Abs(d.Z)
+	switch {
+	case ax >= ay && ax >= az:
+		if d.X > 0 {
+			return 0
+		}
+		return 1
+	case ay >= az:
+		if d.Y > 0 {
+			return 2
+		}
+		return 3
+	}
+	if d.Z > 0 {
+		return 4
+	}
+	return 5
+}
+
+// clipNear clips a convex polygon to the half space Z >= near.
+func clipNear(poly []*Vector3, near float64) []*Vector3 {
+	var res []*Vector3
+	for i, cur := range poly {
+		prev := poly[(i+len(poly)-1)%len(poly)]
+		curIn := cur.Z >= near
+		prevIn := prev.Z >= near
+		if curIn != prevIn {
+			t := (near - prev.Z) / (cur.Z - prev.Z)
+			res = append(res, prev.Add(cur.Sub(prev).Scale(t)))
+		}
+		if curIn {
+			res = append(res, cur)
+		}
+	}
+	return res
+}
+
+// RenderShadowMap shades like Render, attenuating each light by its shadow
+// map. shadows is parallel to lights and may hold nil entries.
+func RenderShadowMap(m Material, normal, camera *Vector3, lights []Light, shadows []ShadowMap, v *Vector3, uv *Vector2) *Color {
+	ret := unlit(m, uv)
+	for i, l := range lights {
+		vis := 1.0
+		if shadows[i] != nil {
+			vis = shadows[i].Visibility(v, normal)
+		}
+		if vis == 0 {
+			continue
+		}
+		ret = ColorAdd(ret, ColorScale(shadeLight(m, normal, camera, l, v, uv), vis))
+	}
+	return ret
+}
+
+// DrawTrianglesParallelShadowMap rasterizes like DrawTrianglesParallel, with
+// shadows looked up from shadow maps built once per light.
+func DrawTrianglesParallelShadowMap(im *image.RGBA, t []*Triangle, l []Light, opts *ShadowOptions) {
+	shadows := NewShadowMaps(l, t, opts)
+	forEachFragment(im.Rect.Dx(), im.Rect.Dy(), t, func(i, j int, tri *Triangle, m Material, v, normal, camera *Vector3, uv *Vector2) {
+		im.Set(i, j, RenderShadowMap(m, normal, camera, l, shadows, v, uv).ToRGBA())
+	})
+}
@@ -0,0 +1,49 @@
+package graphics
+
+import (
+	"testing"
+)
+
+func shadowScene() []*Triangle {
+	quad := func(y, r float64) []*Triangle {
+		p0 := &Vector3{-r, y, 2 - r}
+		p1 := &Vector3{r, y, 2 - r}
+		p2 := &Vector3{r, y, 2 + r}
+		p3 := &Vector3{-r, y, 2 + r}
+		return []*Triangle{NewTriangle(p0, p1, p2, nil), NewTriangle(p0, p2, p3, nil)}
+	}
+	return append(quad(1, 10), quad(0, .5)...)
+}
+
+func TestShadowMap_Visibility(t *testing.T) {
+	env := shadowScene()
+	up := &Vector3{0, -1, 0}
+	lights := []Light{
+		&DirectionLight{Direction: &Vector3{0, 1, 0}, Color: White},
+		&PointLight{Location: &Vector3{0, -1, 2}, R: 255},
+	}
+	opts := &ShadowOptions{Resolution: 256, Bias: .01, SlopeBias: 1, PCFRadius: 1}
+	for _, s := range NewShadowMaps(lights, env, opts) {
+		if vis := s.Visibility(&Vector3{0, 1, 2}, up); vis != 0 {
+			t.Errorf("%T: point under occluder has visibility %v, want 0", s, vis)
+		}
+		if vis := s.Visibility(&Vector3{3, 1, 2}, up); vis != 1 {
+			t.Errorf("%T: open floor has visibility %v, want 1", s, vis)
+		}
+		if vis := s.Visibility(&Vector3{0, 0, 2}, up); vis != 1 {
+			t.Errorf("%T: occluder self-shadows with visibility %v", s, vis)
+		}
+	}
+}
+
+func TestClipNear(t *testing.T) {
+	poly := clipNear([]*Vector3{{0, 0, -1}, {1, 0, 1}, {-1, 0, 1}}, 0)
+	if len(poly) != 4 {
+		t.Fatalf("clipped triangle has %d vertices, want 4", len(poly))
+	}
+	for _, p := range poly {
+		if p.Z < 0 {
+			t.Errorf("vertex %v is behind the near plane", p)
+		}
+	}
+}
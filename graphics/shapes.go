@@ -0,0 +1,641 @@
+package graphics
+
+import (
+	"math"
+	"sort"
+)
+
+// Hit is where a ray meets a Shape.
+type Hit struct {
+	// T is the distance along the ray in units of its direction.
+	T      float64
+	P      *Vector3
+	Normal *Vector3
+	// UV is passed to Material: the barycentric uv on a triangle, and the
+	// texture coordinates on the analytic shapes.
+	UV       *Vector2
+	Material Material
+	// Tangent and Bitangent are the unit directions of increasing U and V,
+	// for normal mapping. They are nil on triangles, which have their own.
+	Tangent   *Vector3
+	Bitangent *Vector3
+	// Triangle is the triangle hit, nil for the analytic shapes.
+	Triangle *Triangle
+}
+
+// shapeEpsilon is how far rays leaving a surface travel before they can hit
+// a Shape, so that they do not hit the surface they left.
+const shapeEpsilon = 1e-4
+
+// shadingNormal is the normal of h after normal mapping.
+func (h *Hit) shadingNormal() *Vector3 {
+	if h.Triangle != nil {
+		return shadingNormal(h.Triangle, h.UV, h.Normal)
+	}
+	if nm, ok := h.Material.(NormalMapper); ok && h.Tangent != nil {
+		return nm.PerturbNormal(h.UV, h.Normal, h.Tangent, h.Bitangent)
+	}
+	return h.Normal
+}
+
+// bind returns the material of h bound to the hit, as bind does for the
+// rasterizer. Triangles hit through a Shape are in the coordinates of the
+// scene, so their origin is zero.
+func (h *Hit) bind() Material {
+	if h.Triangle != nil {
+		return bind(h.Material, h.Triangle, zero, nil, nil)
+	}
+	if _, ok := h.Material.(SurfaceMaterial); ok {
+		return &surfaceFragment{h.Material, &Surface{P: h.P, UV: h.UV}}
+	}
+	return h.Material
+}
+
+// surfaceFragment is a SurfaceMaterial bound to a point of an analytic
+// shape.
+type surfaceFragment struct {
+	Material
+	s *Surface
+}
+
+func (f *surfaceFragment) C(_ *Vector2) *Color {
+	return f.Material.(SurfaceMaterial).CSurface(f.s)
+}
+
+func (f *surfaceFragment) Emission(uv *Vector2) *Color {
+	if e, ok := f.Material.(Emitter); ok {
+		return e.Emission(uv)
+	}
+	return nil
+}
+
+// Shape is anything the ray tracer can intersect. Triangles, the analytic
+// shapes below, Groups and BVHs are all Shapes and can be mixed freely.
+type Shape interface {
+	// Intersect returns the nearest hit of the ray from origin along dir
+	// with T between tMin and tMax, or nil.
+	Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit
+	// Bounds returns the box around the shape, nil when it is unbounded.
+	Bounds() *Bounds
+	// Transform returns the shape moved by m, which should only rotate,
+	// translate and scale uniformly, as the analytic shapes stay analytic.
+	Transform(m *Mat4) Shape
+}
+
+// Bounds is an axis aligned box.
+type Bounds struct {
+	Min *Vector3
+	Max *Vector3
+}
+
+func (b *Bounds) Union(c *Bounds) *Bounds {
+	return &Bounds{
+		&Vector3{math.Min(b.Min.X, c.Min.X), math.Min(b.Min.Y, c.Min.Y), math.Min(b.Min.Z, c.Min.Z)},
+		&Vector3{math.Max(b.Max.X, c.Max.X), math.Max(b.Max.Y, c.Max.Y), math.Max(b.Max.Z, c.Max.Z)},
+	}
+}
+
+func (b *Bounds) Center() *Vector3 {
+	return b.Min.Add(b.Max).Scale(.5)
+}
+
+// hit reports whether the ray from origin along dir passes through b between
+// tMin and tMax.
+func (b *Bounds) hit(origin, dir *Vector3, tMin, tMax float64) bool {
+	for _, a := range [][4]float64{
+		{origin.X, dir.X, b.Min.X, b.Max.X},
+		{origin.Y, dir.Y, b.Min.Y, b.Max.Y},
+		{origin.Z, dir.Z, b.Min.Z, b.Max.Z},
+	} {
+		inv := 1 / a[1]
+		t0, t1 := (a[2]-a[0])*inv, (a[3]-a[0])*inv
+		if inv < 0 {
+			t0, t1 = t1, t0
+		}
+		tMin, tMax = math.Max(tMin, t0), math.Min(tMax, t1)
+		if tMax < tMin {
+			return false
+		}
+	}
+	return true
+}
+
+func pointBounds(pts ...*Vector3) *Bounds {
+	b := &Bounds{pts[0], pts[0]}
+	for _, p := range pts[1:] {
+		b = b.Union(&Bounds{p, p})
+	}
+	return b
+}
+
+// Intersect is the Möller-Trumbore test. UV is the barycentric uv of the
+// hit, as the rasterizer passes it.
+func (t *Triangle) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	e1, e2 := t.P1.Sub(t.P0), t.P2.Sub(t.P0)
+	p := Cross(dir, e2)
+	det := e1.Dot(p)
+	if det == 0 {
+		return nil
+	}
+	s := origin.Sub(t.P0)
+	b1 := s.Dot(p) / det
+	if b1 < 0 || b1 > 1 {
+		return nil
+	}
+	q := Cross(s, e1)
+	b2 := dir.Dot(q) / det
+	if b2 < 0 || b1+b2 > 1 {
+		return nil
+	}
+	d := e2.Dot(q) / det
+	if d <= tMin || d >= tMax {
+		return nil
+	}
+	u, v := 1-b1-b2, b1
+	return &Hit{
+		T:        d,
+		P:        origin.Add(dir.Scale(d)),
+		Normal:   t.N0.Scale(u).Add(t.N1.Scale(v)).Add(t.N2.Scale(b2)).Normalize(),
+		UV:       &Vector2{u, v},
+		Material: t.Material,
+		Triangle: t,
+	}
+}
+
+func (t *Triangle) Bounds() *Bounds {
+	return pointBounds(t.P0, t.P1, t.P2)
+}
+
+func (t *Triangle) Transform(m *Mat4) Shape {
+	return ApplyTransform([]*Triangle{t}, m)[0]
+}
+
+// TriangleShapes returns t as Shapes, to build a BVH from.
+func TriangleShapes(t []*Triangle) []Shape {
+	ret := make([]Shape, len(t))
+	for i, tri := range t {
+		ret[i] = tri
+	}
+	return ret
+}
+
+// Group is a list of shapes tested one after the other.
+type Group []Shape
+
+func (g Group) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	var nearest *Hit
+	for _, s := range g {
+		if h := s.Intersect(origin, dir, tMin, tMax); h != nil {
+			nearest, tMax = h, h.T
+		}
+	}
+	return nearest
+}
+
+func (g Group) Bounds() *Bounds {
+	var b *Bounds
+	for _, s := range g {
+		sb := s.Bounds()
+		if sb == nil {
+			return nil
+		}
+		if b == nil {
+			b = sb
+		} else {
+			b = b.Union(sb)
+		}
+	}
+	return b
+}
+
+func (g Group) Transform(m *Mat4) Shape {
+	ret := make(Group, len(g))
+	for i, s := range g {
+		ret[i] = s.Transform(m)
+	}
+	return ret
+}
+
+// BVH is a bounding volume hierarchy: a binary tree of shapes whose rays
+// skip every subtree whose Box they miss.
+type BVH struct {
+	Box   *Bounds
+	Left  Shape
+	Right Shape
+}
+
+// NewBVH builds a BVH over shapes, splitting them in half along the longest
+// axis of their centers at every level. Unbounded shapes, such as planes,
+// are kept out of the tree in a Group with it.
+func NewBVH(shapes []Shape) Shape {
+	var bounded, unbounded Group
+	for _, s := range shapes {
+		if s.Bounds() == nil {
+			unbounded = append(unbounded, s)
+		} else {
+			bounded = append(bounded, s)
+		}
+	}
+	if len(bounded) == 0 {
+		return unbounded
+	}
+	tree := buildBVH(bounded)
+	if len(unbounded) == 0 {
+		return tree
+	}
+	return append(unbounded, tree)
+}
+
+func buildBVH(shapes []Shape) Shape {
+	if len(shapes) == 1 {
+		return shapes[0]
+	}
+	boxes := make([]*Bounds, len(shapes))
+	centers := pointBounds(shapes[0].Bounds().Center())
+	for i, s := range shapes {
+		boxes[i] = s.Bounds()
+		centers = centers.Union(pointBounds(boxes[i].Center()))
+	}
+	size := centers.Max.Sub(centers.Min)
+	axis := func(v *Vector3) float64 { return v.X }
+	if size.Y > size.X && size.Y > size.Z {
+		axis = func(v *Vector3) float64 { return v.Y }
+	} else if size.Z > size.X {
+		axis = func(v *Vector3) float64 { return v.Z }
+	}
+	sort.Sort(&byAxis{shapes, boxes, axis})
+	box := boxes[0]
+	for _, b := range boxes[1:] {
+		box = box.Union(b)
+	}
+	half := len(shapes) / 2
+	return &BVH{box, buildBVH(shapes[:half]), buildBVH(shapes[half:])}
+}
+
+type byAxis struct {
+	shapes []Shape
+	boxes  []*Bounds
+	axis   func(*Vector3) float64
+}
+
+func (s *byAxis) Len() int {
+	return len(s.shapes)
+}
+func (s *byAxis) Less(i, j int) bool {
+	return s.axis(s.boxes[i].Center()) < s.axis(s.boxes[j].Center())
+}
+func (s *byAxis) Swap(i, j int) {
+	s.shapes[i], s.shapes[j] = s.shapes[j], s.shapes[i]
+	s.boxes[i], s.boxes[j] = s.boxes[j], s.boxes[i]
+}
+
+func (b *BVH) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	if !b.Box.hit(origin, dir, tMin, tMax) {
+		return nil
+	}
+	h := b.Left.Intersect(origin, dir, tMin, tMax)
+	if h != nil {
+		tMax = h.T
+	}
+	if r := b.Right.Intersect(origin, dir, tMin, tMax); r != nil {
+		return r
+	}
+	return h
+}
+
+func (b *BVH) Bounds() *Bounds {
+	return b.Box
+}
+
+// Transform rebuilds the tree over the moved shapes.
+func (b *BVH) Transform(m *Mat4) Shape {
+	var leaves []Shape
+	var walk func(s Shape)
+	walk = func(s Shape) {
+		if n, ok := s.(*BVH); ok {
+			walk(n.Left)
+			walk(n.Right)
+			return
+		}
+		leaves = append(leaves, s.Transform(m))
+	}
+	walk(b)
+	return buildBVH(leaves)
+}
+
+// transformPoint and transformDir apply m to a point and a direction.
+func transformPoint(m *Mat4, p *Vector3) *Vector3 {
+	return m.Dot(p.Hom()).Dehom()
+}
+
+func transformDir(m *Mat4, d *Vector3) *Vector3 {
+	return m.Dot(d.Ext()).Unex()
+}
+
+// transformLength scales a length by the uniform scale of m.
+func transformLength(m *Mat4, l float64) float64 {
+	return l * transformDir(m, &Vector3{1, 0, 0}).Norm()
+}
+
+// SphereShape is a sphere with the texture coordinates of SphereMat.
+type SphereShape struct {
+	Center   *Vector3
+	Radius   float64
+	Material Material
+}
+
+func (s *SphereShape) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	oc := origin.Sub(s.Center)
+	a, b, c := dir.Dot(dir), oc.Dot(dir), oc.Dot(oc)-s.Radius*s.Radius
+	disc := b*b - a*c
+	if disc < 0 {
+		return nil
+	}
+	sq := math.Sqrt(disc)
+	t := (-b - sq) / a
+	if t <= tMin || t >= tMax {
+		t = (-b + sq) / a
+		if t <= tMin || t >= tMax {
+			return nil
+		}
+	}
+	p := origin.Add(dir.Scale(t))
+	n := p.Sub(s.Center).Scale(1 / s.Radius)
+	u := math.Atan2(n.Z, n.X) / (2 * math.Pi)
+	if u < 0 {
+		u++
+	}
+	h := &Hit{
+		T:        t,
+		P:        p,
+		Normal:   n,
+		UV:       &Vector2{u, math.Acos(math.Max(-1, math.Min(1, -n.Y))) / math.Pi},
+		Material: s.Material,
+	}
+	if r := math.Hypot(n.X, n.Z); r > 1e-9 {
+		h.Tangent = &Vector3{-n.Z / r, 0, n.X / r}
+		h.Bitangent = &Vector3{-n.Y * n.X / r, r, -n.Y * n.Z / r}
+	}
+	return h
+}
+
+func (s *SphereShape) Bounds() *Bounds {
+	r := &Vector3{s.Radius, s.Radius, s.Radius}
+	return &Bounds{s.Center.Sub(r), s.Center.Add(r)}
+}
+
+func (s *SphereShape) Transform(m *Mat4) Shape {
+	return &SphereShape{transformPoint(m, s.Center), transformLength(m, s.Radius), s.Material}
+}
+
+// planeHit intersects the ray with the plane through point facing normal,
+// returning T, or NaN when it misses.
+func planeHit(point, normal, origin, dir *Vector3, tMin, tMax float64) float64 {
+	dn := dir.Dot(normal)
+	if dn == 0 {
+		return math.NaN()
+	}
+	t := point.Sub(origin).Dot(normal) / dn
+	if t <= tMin || t >= tMax {
+		return math.NaN()
+	}
+	return t
+}
+
+// PlaneShape is the infinite plane through Point facing Normal. Its texture
+// coordinates are distances along the plane, so that textures repeat once
+// per unit.
+type PlaneShape struct {
+	Point    *Vector3
+	Normal   *Vector3
+	Material Material
+}
+
+func (s *PlaneShape) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	n := s.Normal.Normalize()
+	t := planeHit(s.Point, n, origin, dir, tMin, tMax)
+	if math.IsNaN(t) {
+		return nil
+	}
+	p := origin.Add(dir.Scale(t))
+	tan, bitan := orthoBasis(n)
+	d := p.Sub(s.Point)
+	return &Hit{
+		T:         t,
+		P:         p,
+		Normal:    n,
+		UV:        &Vector2{d.Dot(tan), d.Dot(bitan)},
+		Material:  s.Material,
+		Tangent:   tan,
+		Bitangent: bitan,
+	}
+}
+
+func (s *PlaneShape) Bounds() *Bounds {
+	return nil
+}
+
+func (s *PlaneShape) Transform(m *Mat4) Shape {
+	return &PlaneShape{transformPoint(m, s.Point), transformDir(m, s.Normal), s.Material}
+}
+
+// DiskShape is the disk of Radius around Center facing Normal. The texture
+// fits the square around it.
+type DiskShape struct {
+	Center   *Vector3
+	Normal   *Vector3
+	Radius   float64
+	Material Material
+}
+
+func (s *DiskShape) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	n := s.Normal.Normalize()
+	t := planeHit(s.Center, n, origin, dir, tMin, tMax)
+	if math.IsNaN(t) {
+		return nil
+	}
+	p := origin.Add(dir.Scale(t))
+	d := p.Sub(s.Center)
+	if d.Dot(d) > s.Radius*s.Radius {
+		return nil
+	}
+	tan, bitan := orthoBasis(n)
+	return &Hit{
+		T:         t,
+		P:         p,
+		Normal:    n,
+		UV:        &Vector2{.5 + d.Dot(tan)/(2*s.Radius), .5 + d.Dot(bitan)/(2*s.Radius)},
+		Material:  s.Material,
+		Tangent:   tan,
+		Bitangent: bitan,
+	}
+}
+
+func (s *DiskShape) Bounds() *Bounds {
+	// The extent along each axis is the radius times the sine of the angle
+	// between the axis and the normal.
+	n := s.Normal.Normalize()
+	e := &Vector3{
+		s.Radius * math.Sqrt(math.Max(0, 1-n.X*n.X)),
+		s.Radius * math.Sqrt(math.Max(0, 1-n.Y*n.Y)),
+		s.Radius * math.Sqrt(math.Max(0, 1-n.Z*n.Z)),
+	}
+	return &Bounds{s.Center.Sub(e), s.Center.Add(e)}
+}
+
+func (s *DiskShape) Transform(m *Mat4) Shape {
+	return &DiskShape{transformPoint(m, s.Center), transformDir(m, s.Normal), transformLength(m, s.Radius), s.Material}
+}
+
+// BoxShape is the box around Center reaching out by the half extents U, V
+// and W, which should be perpendicular. Each face shows the whole texture.
+type BoxShape struct {
+	Center   *Vector3
+	U        *Vector3
+	V        *Vector3
+	W        *Vector3
+	Material Material
+}
+
+func (s *BoxShape) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	axes := []*Vector3{s.U, s.V, s.W}
+	o := origin.Sub(s.Center)
+	near, far := tMin, tMax
+	nearAxis, farAxis := -1, -1
+	for k, a := range axes {
+		e := a.Norm()
+		n := a.Scale(1 / e)
+		oa, da := o.Dot(n), dir.Dot(n)
+		if da == 0 {
+			if math.Abs(oa) > e {
+				return nil
+			}
+			continue
+		}
+		t0, t1 := (-e-oa)/da, (e-oa)/da
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		if t0 > near {
+			near, nearAxis = t0, k
+		}
+		if t1 < far {
+			far, farAxis = t1, k
+		}
+		if far < near {
+			return nil
+		}
+	}
+	t, k := near, nearAxis
+	if k < 0 {
+		// The ray starts inside the box and leaves through far.
+		t, k = far, farAxis
+	}
+	if k < 0 || t <= tMin || t >= tMax {
+		return nil
+	}
+	p := origin.Add(dir.Scale(t))
+	local := p.Sub(s.Center)
+	a := axes[k]
+	n := a.Normalize()
+	if local.Dot(n) < 0 {
+		n = n.Scale(-1)
+	}
+	tan, bitan := axes[(k+1)%3].Normalize(), axes[(k+2)%3].Normalize()
+	return &Hit{
+		T:      t,
+		P:      p,
+		Normal: n,
+		UV: &Vector2{
+			.5 + local.Dot(tan)/(2*axes[(k+1)%3].Norm()),
+			.5 + local.Dot(bitan)/(2*axes[(k+2)%3].Norm()),
+		},
+		Material:  s.Material,
+		Tangent:   tan,
+		Bitangent: bitan,
+	}
+}
+
+func (s *BoxShape) Bounds() *Bounds {
+	e := &Vector3{
+		math.Abs(s.U.X) + math.Abs(s.V.X) + math.Abs(s.W.X),
+		math.Abs(s.U.Y) + math.Abs(s.V.Y) + math.Abs(s.W.Y),
+		math.Abs(s.U.Z) + math.Abs(s.V.Z) + math.Abs(s.W.Z),
+	}
+	return &Bounds{s.Center.Sub(e), s.Center.Add(e)}
+}
+
+func (s *BoxShape) Transform(m *Mat4) Shape {
+	return &BoxShape{transformPoint(m, s.Center), transformDir(m, s.U), transformDir(m, s.V), transformDir(m, s.W), s.Material}
+}
+
+// CylinderShape is the cylinder of Radius from Base to Base + Axis, closed
+// by flat caps. U runs around the side and V along Axis; the caps are mapped
+// like a DiskShape.
+type CylinderShape struct {
+	Base     *Vector3
+	Axis     *Vector3
+	Radius   float64
+	Material Material
+}
+
+func (s *CylinderShape) Intersect(origin, dir *Vector3, tMin, tMax float64) *Hit {
+	height := s.Axis.Norm()
+	a := s.Axis.Scale(1 / height)
+	w := origin.Sub(s.Base)
+	wa, da := w.Dot(a), dir.Dot(a)
+	var best *Hit
+	try := func(h *Hit) {
+		if h != nil && (best == nil || h.T < best.T) {
+			best = h
+			tMax = h.T
+		}
+	}
+
+	wp, dp := w.Sub(a.Scale(wa)), dir.Sub(a.Scale(da))
+	qa, qb, qc := dp.Dot(dp), wp.Dot(dp), wp.Dot(wp)-s.Radius*s.Radius
+	if disc := qb*qb - qa*qc; qa > 0 && disc >= 0 {
+		sq := math.Sqrt(disc)
+		for _, t := range []float64{(-qb - sq) / qa, (-qb + sq) / qa} {
+			y := wa + t*da
+			if t <= tMin || t >= tMax || y < 0 || y > height {
+				continue
+			}
+			radial := wp.Add(dp.Scale(t)).Scale(1 / s.Radius)
+			ref, _ := orthoBasis(a)
+			u := math.Atan2(Cross(ref, radial).Dot(a), ref.Dot(radial)) / (2 * math.Pi)
+			if u < 0 {
+				u++
+			}
+			try(&Hit{
+				T:         t,
+				P:         origin.Add(dir.Scale(t)),
+				Normal:    radial,
+				UV:        &Vector2{u, y / height},
+				Material:  s.Material,
+				Tangent:   Cross(a, radial),
+				Bitangent: a,
+			})
+			break
+		}
+	}
+	for _, c := range []*DiskShape{{s.Base, a.Scale(-1), s.Radius, s.Material}, {s.Base.Add(s.Axis), a, s.Radius, s.Material}} {
+		try(c.Intersect(origin, dir, tMin, tMax))
+	}
+	return best
+}
+
+func (s *CylinderShape) Bounds() *Bounds {
+	a := s.Axis.Normalize()
+	e := &Vector3{
+		s.Radius * math.Sqrt(math.Max(0, 1-a.X*a.X)),
+		s.Radius * math.Sqrt(math.Max(0, 1-a.Y*a.Y)),
+		s.Radius * math.Sqrt(math.Max(0, 1-a.Z*a.Z)),
+	}
+	top := s.Base.Add(s.Axis)
+	return pointBounds(s.Base.Sub(e), s.Base.Add(e), top.Sub(e), top.Add(e))
+}
+
+func (s *CylinderShape) Transform(m *Mat4) Shape {
+	return &CylinderShape{transformPoint(m, s.Base), transformDir(m, s.Axis), transformLength(m, s.Radius), s.Material}
+}
@@ -0,0 +1,118 @@
+package graphics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestShapes_Intersect(t *testing.T) {
+	m := &SolidMaterial{Color: White}
+	down := &Vector3{0, 1, 0}
+	origin := &Vector3{0, -5, 0}
+	for _, tc := range []struct {
+		name   string
+		shape  Shape
+		t      float64
+		normal *Vector3
+	}{
+		{"sphere", &SphereShape{&Vector3{0, 0, 0}, 2, m}, 3, &Vector3{0, -1, 0}},
+		{"plane", &PlaneShape{&Vector3{0, 1, 0}, &Vector3{0, -1, 0}, m}, 6, &Vector3{0, -1, 0}},
+		{"disk", &DiskShape{&Vector3{0, 1, 0}, &Vector3{0, -2, 0}, 1, m}, 6, &Vector3{0, -1, 0}},
+		{"box", &BoxShape{&Vector3{}, &Vector3{1, 0, 0}, &Vector3{0, 2, 0}, &Vector3{0, 0, 1}, m}, 3, &Vector3{0, -1, 0}},
+		{"cylinder", &CylinderShape{&Vector3{0, -1, 0}, &Vector3{0, 3, 0}, 1, m}, 4, &Vector3{0, -1, 0}},
+		{"triangle", NewTriangle(&Vector3{-1, 0, -1}, &Vector3{1, 0, -1}, &Vector3{0, 0, 1}, m), 5, &Vector3{0, 0, 0}},
+	} {
+		h := tc.shape.Intersect(origin, down, 0, math.Inf(1))
+		if h == nil {
+			t.Errorf("%s: no hit", tc.name)
+			continue
+		}
+		if math.Abs(h.T-tc.t) > 1e-9 || h.P.Sub(origin.Add(down.Scale(tc.t))).Norm() > 1e-9 {
+			t.Errorf("%s: hit at T %v, %v, want %v", tc.name, h.T, h.P, tc.t)
+		}
+		if tc.normal.Norm() > 0 && h.Normal.Sub(tc.normal).Norm() > 1e-9 {
+			t.Errorf("%s: normal %v, want %v", tc.name, h.Normal, tc.normal)
+		}
+		if h.Material != m {
+			t.Errorf("%s: hit lost the material", tc.name)
+		}
+		if h := tc.shape.Intersect(origin, down, 0, tc.t-.01); h != nil {
+			t.Errorf("%s: hit at %v beyond tMax", tc.name, h.T)
+		}
+		if b := tc.shape.Bounds(); b != nil && (b.Min.Y > tc.t-5+1e-9 || b.Max.Y < tc.t-5-1e-9) {
+			t.Errorf("%s: bounds %v, %v miss the hit", tc.name, b.Min, b.Max)
+		}
+	}
+	side := &Vector3{1, 0, 0}
+	if h := (&CylinderShape{&Vector3{0, -1, 0}, &Vector3{0, 3, 0}, 1, m}).Intersect(&Vector3{-5, 0, 0}, side, 0, math.Inf(1)); h == nil || math.Abs(h.T-4) > 1e-9 || h.Normal.Sub(&Vector3{-1, 0, 0}).Norm() > 1e-9 {
+		t.Errorf("cylinder side hit %+v, want T 4 facing -X", h)
+	}
+	if h := (&SphereShape{&Vector3{}, 1, m}).Intersect(&Vector3{}, side, 0, math.Inf(1)); h == nil || math.Abs(h.T-1) > 1e-9 {
+		t.Errorf("ray from inside the sphere hit %+v, want T 1", h)
+	}
+}
+
+func TestTriangle_Intersect(t *testing.T) {
+	tri := NewTriangle(&Vector3{-1, -1, 3}, &Vector3{1, -1, 3}, &Vector3{0, 1, 3}, nil)
+	dir := &Vector3{.05, .1, 1}
+	h := tri.Intersect(zero, dir, 0, math.Inf(1))
+	if h == nil {
+		t.Fatal("no hit")
+	}
+	u, v, _ := tri.Bary(tri.RayIntersect(dir))
+	if math.Abs(h.UV.X-u) > 1e-9 || math.Abs(h.UV.Y-v) > 1e-9 {
+		t.Errorf("uv is %v, want the barycentric %v, %v", h.UV, u, v)
+	}
+}
+
+func TestBVH(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var shapes []Shape
+	for i := 0; i < 200; i++ {
+		c := &Vector3{r.Float64()*10 - 5, r.Float64()*10 - 5, r.Float64()*10 + 5}
+		if i%2 == 0 {
+			shapes = append(shapes, &SphereShape{c, r.Float64() * .5, nil})
+		} else {
+			shapes = append(shapes, TriangleShapes(ApplyTransform(Icosphere(0, nil), Translate(c.X, c.Y, c.Z).Mult(Scale(.3))))...)
+		}
+	}
+	shapes = append(shapes, &PlaneShape{&Vector3{0, 0, 20}, &Vector3{0, 0, -1}, nil})
+	bvh, group := NewBVH(shapes), Group(append([]Shape{}, shapes...))
+	for i := 0; i < 2000; i++ {
+		dir := &Vector3{r.Float64() - .5, r.Float64() - .5, 1}
+		want, got := group.Intersect(zero, dir, 0, math.Inf(1)), bvh.Intersect(zero, dir, 0, math.Inf(1))
+		if (want == nil) != (got == nil) || want != nil && math.Abs(want.T-got.T) > 1e-9 {
+			t.Fatalf("ray %v: BVH hit %+v, want %+v", dir, got, want)
+		}
+	}
+	moved := bvh.Transform(Translate(0, 0, 1))
+	dir := &Vector3{0, 0, 1}
+	if a, b := bvh.Intersect(zero, dir, 0, math.Inf(1)), moved.Intersect(zero, dir, 0, math.Inf(1)); math.Abs(b.T-a.T-1) > 1e-9 {
+		t.Errorf("moved BVH hit at %v, want %v", b.T, a.T+1)
+	}
+}
+
+func TestRayCast_Shapes(t *testing.T) {
+	red := &SolidMaterial{Color: &Color{255, 0, 0, 255}, SpecColor_: &Color{}, SpecCoeff_: 1}
+	sphere := &SphereShape{&Vector3{0, 0, 5}, 1, red}
+	light := &DirectionLight{Direction: &Vector3{0, 0, 1}, Color: White}
+	c := rayCast(nil, sphere, []Light{light}, nil, zero, &Vector3{0, 0, 1}, nil, 0)
+	if c.R < 254 || c.G != 0 {
+		t.Errorf("sphere lit head on is %v, want red", c)
+	}
+
+	// A triangle floor facing the camera lies in the shadow of a sphere that
+	// the camera sees past.
+	floor := NewTriangle(&Vector3{-10, -10, 8}, &Vector3{10, -10, 8}, &Vector3{0, 10, 8}, red)
+	n := &Vector3{0, 0, -1}
+	floor.N0, floor.N1, floor.N2 = n, n, n
+	dir := &Vector3{3, 0, 8}
+	if c := rayCast([]*Triangle{floor}, nil, []Light{light}, nil, zero, dir, nil, 0); c.R < 254 {
+		t.Errorf("floor without the sphere is %v, want lit", c)
+	}
+	blocker := &SphereShape{&Vector3{3, 0, 5}, .8, red}
+	if c := rayCast([]*Triangle{floor}, blocker, []Light{light}, nil, zero, dir, nil, 0); c.R != 0 {
+		t.Errorf("floor behind the sphere is %v, want shadowed", c)
+	}
+}
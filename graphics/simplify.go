@@ -0,0 +1,513 @@
+package graphics
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Mesh simplification by quadric error metrics, after Garland and Heckbert:
+// edges are collapsed one after the other, cheapest first, where the cost of
+// a point is its summed squared distance to the planes of the faces that
+// were merged into it.
+
+// quadric is a symmetric 4x4 matrix, stored as its upper triangle row by
+// row, whose value at a point is a sum of squared distances to planes.
+type quadric [10]float64
+
+// planeQuadric is the quadric of the plane through p facing the unit normal
+// n, scaled by weight.
+func planeQuadric(n, p *Vector3, weight float64) quadric {
+	a, b, c, d := n.X, n.Y, n.Z, -n.Dot(p)
+	return quadric{a * a, a * b, a * c, a * d, b * b, b * c, b * d, c * c, c * d, d * d}.scale(weight)
+}
+
+func (q quadric) add(r quadric) quadric {
+	for i := range q {
+		q[i] += r[i]
+	}
+	return q
+}
+
+func (q quadric) scale(s float64) quadric {
+	for i := range q {
+		q[i] *= s
+	}
+	return q
+}
+
+// eval is the squared distance from p the quadric measures.
+func (q quadric) eval(p *Vector3) float64 {
+	x, y, z := p.X, p.Y, p.Z
+	return math.Max(0, q[0]*x*x+2*q[1]*x*y+2*q[2]*x*z+2*q[3]*x+
+		q[4]*y*y+2*q[5]*y*z+2*q[6]*y+
+		q[7]*z*z+2*q[8]*z+
+		q[9])
+}
+
+// minimum returns the point where q is least, or nil when there is no
+// single one, as along a line of coplanar faces.
+func (q quadric) minimum() *Vector3 {
+	a := [3][3]float64{{q[0], q[1], q[2]}, {q[1], q[4], q[5]}, {q[2], q[5], q[7]}}
+	b := [3]float64{-q[3], -q[6], -q[8]}
+	det := func(m [3][3]float64) float64 {
+		return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+			m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+			m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	}
+	d := det(a)
+	if math.Abs(d) < 1e-12 {
+		return nil
+	}
+	// Cramer's rule.
+	var x [3]float64
+	for i := range x {
+		m := a
+		for j := range m {
+			m[j][i] = b[j]
+		}
+		x[i] = det(m) / d
+	}
+	return &Vector3{x[0], x[1], x[2]}
+}
+
+// seamWeight is how much more moving off a seam costs than moving off the
+// surface.
+const seamWeight = 10
+
+// minFlipCos is the least cosine between the normals of a face before and
+// after a collapse, below which the collapse would fold the surface over.
+const minFlipCos = .2
+
+// collapse is an edge of the simplified mesh, to be collapsed into At at
+// cost Cost. Versions are those of A and B when the collapse was priced, so
+// that collapses priced before their ends changed are skipped.
+type collapse struct {
+	A, B               int
+	At                 *Vector3
+	Cost               float64
+	VersionA, VersionB int
+}
+
+type collapseHeap []*collapse
+
+func (h collapseHeap) Len() int            { return len(h) }
+func (h collapseHeap) Less(i, j int) bool  { return h[i].Cost < h[j].Cost }
+func (h collapseHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *collapseHeap) Push(x interface{}) { *h = append(*h, x.(*collapse)) }
+func (h *collapseHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// simplifier holds a mesh being simplified.
+type simplifier struct {
+	m        *Mesh
+	alive    []bool
+	faces    int
+	removed  []bool
+	quadrics []quadric
+	versions []int
+	// vertexFaces holds the faces around each position, dead ones included.
+	vertexFaces [][]int
+	// seams holds, for each position, the other ends of the seams from it:
+	// edges along the boundary of the mesh, between materials or across
+	// which the texture coordinates jump.
+	seams   []map[int]bool
+	pending collapseHeap
+}
+
+func newSimplifier(m *Mesh) *simplifier {
+	c := &Mesh{
+		Positions:     append([]*Vector3(nil), m.Positions...),
+		Normals:       m.Normals,
+		UVs:           m.UVs,
+		Indices:       append([]int(nil), m.Indices...),
+		NormalIndices: append([]int(nil), m.NormalIndices...),
+		UVIndices:     append([]int(nil), m.UVIndices...),
+		Materials:     m.Materials,
+		FaceMaterials: m.FaceMaterials,
+	}
+	s := &simplifier{
+		m:           c,
+		alive:       make([]bool, c.NumFaces()),
+		faces:       c.NumFaces(),
+		removed:     make([]bool, len(c.Positions)),
+		quadrics:    make([]quadric, len(c.Positions)),
+		versions:    make([]int, len(c.Positions)),
+		vertexFaces: c.VertexFaces(),
+		seams:       make([]map[int]bool, len(c.Positions)),
+	}
+	for i := range s.seams {
+		s.seams[i] = map[int]bool{}
+	}
+	for i := range s.alive {
+		s.alive[i] = true
+		f := c.Face(i)
+		n := s.faceNormal(i, -1, nil)
+		if n == nil {
+			continue
+		}
+		q := planeQuadric(n, c.Positions[f[0]], 1)
+		for _, v := range f {
+			s.quadrics[v] = s.quadrics[v].add(q)
+		}
+	}
+	// Edges are taken in order, so that collapses of equal cost are made in
+	// the same order every time.
+	edgeFaces := c.EdgeFaces()
+	var edges []Edge
+	for i := 0; i < c.NumFaces(); i++ {
+		f := c.Face(i)
+		for k := range f {
+			if e := NewEdge(f[k], f[(k+1)%3]); edgeFaces[e][0] == i {
+				edges = append(edges, e)
+			}
+		}
+	}
+	for _, e := range edges {
+		faces := edgeFaces[e]
+		if !s.isSeam(e, faces) {
+			continue
+		}
+		s.seams[e[0]][e[1]], s.seams[e[1]][e[0]] = true, true
+		// Hold the seam in place with planes through it, upright on the
+		// faces along it.
+		a, b := c.Positions[e[0]], c.Positions[e[1]]
+		for _, f := range faces {
+			if n := s.faceNormal(f, -1, nil); n != nil {
+				if side := Cross(b.Sub(a), n); side.Norm() > 0 {
+					q := planeQuadric(side.Normalize(), a, seamWeight)
+					s.quadrics[e[0]] = s.quadrics[e[0]].add(q)
+					s.quadrics[e[1]] = s.quadrics[e[1]].add(q)
+				}
+			}
+		}
+	}
+	for _, e := range edges {
+		s.price(e[0], e[1])
+	}
+	return s
+}
+
+// corner returns the index of position v in the corners of face f, or -1.
+func (s *simplifier) corner(f, v int) int {
+	for k := 0; k < 3; k++ {
+		if s.m.Indices[3*f+k] == v {
+			return 3*f + k
+		}
+	}
+	return -1
+}
+
+// isSeam reports whether the edge e between faces should be kept.
+func (s *simplifier) isSeam(e Edge, faces []int) bool {
+	if len(faces) != 2 {
+		return true
+	}
+	f, g := faces[0], faces[1]
+	if s.m.FaceMaterials[f] != s.m.FaceMaterials[g] {
+		return true
+	}
+	for _, v := range e {
+		if s.m.UVIndices[s.corner(f, v)] != s.m.UVIndices[s.corner(g, v)] {
+			return true
+		}
+	}
+	return false
+}
+
+// faceNormal returns the unit normal of face f with position v moved to p,
+// or nil if it is degenerate.
+func (s *simplifier) faceNormal(f, v int, p *Vector3) *Vector3 {
+	var pts [3]*Vector3
+	for k, w := range s.m.Face(f) {
+		pts[k] = s.m.Positions[w]
+		if w == v {
+			pts[k] = p
+		}
+	}
+	n := Cross(pts[1].Sub(pts[0]), pts[2].Sub(pts[0]))
+	if n.Norm() < 1e-300 {
+		return nil
+	}
+	return n.Normalize()
+}
+
+// place returns where the edge from a to b is best collapsed and what that
+// costs, or nil if it must not be. Points on seams only slide along them, and
+// corners of seams do not move.
+func (s *simplifier) place(a, b int) (*Vector3, float64) {
+	q := s.quadrics[a].add(s.quadrics[b])
+	pa, pb := s.m.Positions[a], s.m.Positions[b]
+	mid := pa.Add(pb).Scale(.5)
+	seamA, seamB := len(s.seams[a]) > 0, len(s.seams[b]) > 0
+	fixedA, fixedB := seamA && len(s.seams[a]) != 2, seamB && len(s.seams[b]) != 2
+	var candidates []*Vector3
+	switch {
+	case !seamA && !seamB:
+		candidates = []*Vector3{pa, pb, mid}
+		if p := q.minimum(); p != nil && p.Sub(mid).Norm() <= 2*pb.Sub(pa).Norm() {
+			candidates = append(candidates, p)
+		}
+	case seamA && seamB && s.seams[a][b]:
+		switch {
+		case fixedA && fixedB:
+			return nil, 0
+		case fixedA:
+			candidates = []*Vector3{pa}
+		case fixedB:
+			candidates = []*Vector3{pb}
+		default:
+			candidates = []*Vector3{pa, pb, mid}
+		}
+	case seamA && !seamB:
+		candidates = []*Vector3{pa}
+	case seamB && !seamA:
+		candidates = []*Vector3{pb}
+	default:
+		// Both on seams, but not the same one: collapsing would pinch the
+		// mesh between them.
+		return nil, 0
+	}
+	best, cost := candidates[0], q.eval(candidates[0])
+	for _, p := range candidates[1:] {
+		if c := q.eval(p); c < cost {
+			best, cost = p, c
+		}
+	}
+	return best, cost
+}
+
+func (s *simplifier) price(a, b int) {
+	if p, cost := s.place(a, b); p != nil {
+		heap.Push(&s.pending, &collapse{a, b, p, cost, s.versions[a], s.versions[b]})
+	}
+}
+
+// neighbors returns the positions sharing a live face with v, in the order
+// of the faces.
+func (s *simplifier) neighbors(v int) []int {
+	var ret []int
+	seen := map[int]bool{}
+	for _, f := range s.vertexFaces[v] {
+		if !s.alive[f] {
+			continue
+		}
+		for _, w := range s.m.Face(f) {
+			if w != v && !seen[w] {
+				seen[w] = true
+				ret = append(ret, w)
+			}
+		}
+	}
+	return ret
+}
+
+// valid reports whether collapsing a and b to p keeps the mesh a manifold
+// without folding any face over.
+func (s *simplifier) valid(a, b int, p *Vector3) bool {
+	// The link condition: a and b share no neighbors but the far corners of
+	// the faces along the edge between them.
+	shared := 0
+	nb := map[int]bool{}
+	for _, w := range s.neighbors(b) {
+		nb[w] = true
+	}
+	for _, w := range s.neighbors(a) {
+		if nb[w] {
+			shared++
+		}
+	}
+	along := 0
+	for _, f := range s.vertexFaces[a] {
+		if s.alive[f] && s.corner(f, b) >= 0 {
+			along++
+		}
+	}
+	if along == 0 || shared != along {
+		return false
+	}
+	for _, v := range []int{a, b} {
+		for _, f := range s.vertexFaces[v] {
+			if !s.alive[f] || s.corner(f, a) >= 0 && s.corner(f, b) >= 0 {
+				continue
+			}
+			before, after := s.faceNormal(f, -1, nil), s.faceNormal(f, v, p)
+			if after == nil || before != nil && before.Dot(after) < minFlipCos {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// apply collapses b into a at p.
+func (s *simplifier) apply(a, b int, p *Vector3) {
+	var along []int
+	for _, f := range s.vertexFaces[b] {
+		if s.alive[f] && s.corner(f, a) >= 0 {
+			along = append(along, f)
+		}
+	}
+	for _, f := range along {
+		s.alive[f] = false
+		s.faces--
+	}
+	for _, f := range s.vertexFaces[b] {
+		if !s.alive[f] {
+			continue
+		}
+		k := s.corner(f, b)
+		// The corner takes the normal and texture coordinates a has on
+		// its side of the edge, as told by a face along the edge that
+		// agreed with it at b.
+		uv, n := s.m.UVIndices[k], s.m.NormalIndices[k]
+		for _, g := range along {
+			kb, ka := s.corner(g, b), s.corner(g, a)
+			if s.m.UVIndices[kb] == uv {
+				s.m.UVIndices[k] = s.m.UVIndices[ka]
+			}
+			if s.m.NormalIndices[kb] == n {
+				s.m.NormalIndices[k] = s.m.NormalIndices[ka]
+			}
+		}
+		s.m.Indices[k] = a
+		s.vertexFaces[a] = append(s.vertexFaces[a], f)
+	}
+	for w := range s.seams[b] {
+		delete(s.seams[w], b)
+		if w != a {
+			s.seams[w][a], s.seams[a][w] = true, true
+		}
+	}
+	s.seams[b] = nil
+	s.m.Positions[a] = p
+	s.quadrics[a] = s.quadrics[a].add(s.quadrics[b])
+	s.removed[b] = true
+	s.versions[a]++
+	s.versions[b]++
+	// Price the edges around a again, and those around its neighbors,
+	// which may have been folding faces that a has moved out of the way.
+	for _, w := range s.neighbors(a) {
+		for _, x := range s.neighbors(w) {
+			if w < x || x == a {
+				s.price(w, x)
+			}
+		}
+	}
+}
+
+// run collapses edges until at most targetFaces are left, or the next would
+// move the surface more than maxError, and returns the largest error of the
+// collapses it made.
+func (s *simplifier) run(targetFaces int, maxError float64) float64 {
+	worst := 0.0
+	for s.faces > targetFaces && s.pending.Len() > 0 {
+		c := heap.Pop(&s.pending).(*collapse)
+		if s.removed[c.A] || s.removed[c.B] || c.VersionA != s.versions[c.A] || c.VersionB != s.versions[c.B] {
+			continue
+		}
+		err := math.Sqrt(c.Cost)
+		if maxError > 0 && err > maxError {
+			break
+		}
+		if !s.valid(c.A, c.B, c.At) {
+			continue
+		}
+		s.apply(c.A, c.B, c.At)
+		worst = math.Max(worst, err)
+	}
+	return worst
+}
+
+// mesh returns the simplified mesh, without the positions that were
+// collapsed away.
+func (s *simplifier) mesh() *Mesh {
+	ret := &Mesh{
+		Normals:   s.m.Normals,
+		UVs:       s.m.UVs,
+		Materials: s.m.Materials,
+	}
+	index := make([]int, len(s.m.Positions))
+	for i := range index {
+		index[i] = -1
+	}
+	for f, alive := range s.alive {
+		if !alive {
+			continue
+		}
+		for k := 3 * f; k < 3*f+3; k++ {
+			v := s.m.Indices[k]
+			if index[v] < 0 {
+				index[v] = len(ret.Positions)
+				ret.Positions = append(ret.Positions, s.m.Positions[v])
+			}
+			ret.Indices = append(ret.Indices, index[v])
+			ret.NormalIndices = append(ret.NormalIndices, s.m.NormalIndices[k])
+			ret.UVIndices = append(ret.UVIndices, s.m.UVIndices[k])
+		}
+		ret.FaceMaterials = append(ret.FaceMaterials, s.m.FaceMaterials[f])
+	}
+	return ret
+}
+
+// Simplify returns m with edges collapsed until it has at most targetFaces
+// faces, or until the next collapse would move the surface more than
+// maxError, where either limit is ignored when it is zero. Boundaries, and
+// edges between materials or texture coordinates that do not match, are
+// kept: their points only slide along them. Weld m first, as only the
+// positions faces share hold them together.
+func (m *Mesh) Simplify(targetFaces int, maxError float64) *Mesh {
+	s := newSimplifier(m)
+	s.run(targetFaces, maxError)
+	return s.mesh()
+}
+
+// LOD is a mesh at levels of detail from full to coarse, to draw with fewer
+// faces when it is small on screen.
+type LOD struct {
+	Levels []*Mesh
+	// Errors is how far each level strays from the full mesh at most, as
+	// measured by the quadrics.
+	Errors []float64
+	// Center and Radius bound the full mesh.
+	Center *Vector3
+	Radius float64
+}
+
+// NewLOD simplifies m into levels levels, each with half the faces of the
+// one before.
+func NewLOD(m *Mesh, levels int) *LOD {
+	l := &LOD{
+		Levels: []*Mesh{m},
+		Errors: []float64{0},
+	}
+	l.Center, l.Radius = m.BoundingSphere()
+	for i := 1; i < levels; i++ {
+		s := newSimplifier(m)
+		err := s.run(m.NumFaces()>>uint(i), 0)
+		l.Levels = append(l.Levels, s.mesh())
+		l.Errors = append(l.Errors, math.Max(err, l.Errors[i-1]))
+	}
+	return l
+}
+
+// Select returns the index of the coarsest level whose error, with the
+// mesh moved by transform in front of the camera, covers at most a pixel of
+// an image size pixels wide spanning -1 to 1 on the screen.
+func (l *LOD) Select(transform *Mat4, size int) int {
+	z := transformPoint(transform, l.Center).Z - transformLength(transform, l.Radius)
+	if z <= 0 {
+		return 0
+	}
+	pixels := float64(size) / 2 / z
+	level := 0
+	for i, err := range l.Errors {
+		if transformLength(transform, err)*pixels <= 1 {
+			level = i
+		}
+	}
+	return level
+}
@@ -0,0 +1,108 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMesh_Simplify(t *testing.T) {
+	sphere := NewMesh(Icosphere(3, &SolidMaterial{}))
+	simple := sphere.Simplify(200, 0)
+	if n := simple.NumFaces(); n > 200 || n < 150 {
+		t.Errorf("simplified sphere has %d faces, want 200 or just under", n)
+	}
+	for e, faces := range simple.EdgeFaces() {
+		if len(faces) != 2 {
+			t.Fatalf("edge %v has faces %v, want two", e, faces)
+		}
+	}
+	for _, tri := range simple.Triangles() {
+		for _, p := range []*Vector3{tri.P0, tri.P1, tri.P2} {
+			if math.Abs(p.Norm()-1) > .05 {
+				t.Fatalf("point %v is %v from the center, want about 1", p, p.Norm())
+			}
+		}
+		if tri.Norm.Dot(tri.Centroid()) < 0 {
+			t.Fatalf("face at %v folded over", tri.Centroid())
+		}
+	}
+	if n := sphere.Simplify(0, 1e-3).NumFaces(); n != sphere.NumFaces() {
+		t.Errorf("simplifying a sphere to within 1e-3 left %d faces of %d", n, sphere.NumFaces())
+	}
+
+	// A flat square of two materials can lose every point but its corners
+	// and the ends of the line between them without changing shape.
+	a, b := &SolidMaterial{}, &SolidMaterial{}
+	tris := Plane(8, a)
+	for _, tri := range tris {
+		if tri.Centroid().X > 0 {
+			tri.Material = b
+		}
+	}
+	plane := NewMesh(tris).Simplify(0, 1e-9)
+	if n := plane.NumFaces(); n != 4 {
+		t.Errorf("simplified plane has %d faces, want 4", n)
+	}
+	areas := map[Material]float64{}
+	for _, tri := range plane.Triangles() {
+		areas[tri.Material] += Cross(tri.P1.Sub(tri.P0), tri.P2.Sub(tri.P0)).Norm() / 2
+	}
+	if math.Abs(areas[a]-2) > 1e-9 || math.Abs(areas[b]-2) > 1e-9 {
+		t.Errorf("the materials cover %v and %v, want 2 each", areas[a], areas[b])
+	}
+
+	// Two pieces of a plane whose texture coordinates are equal along the
+	// bent seam between them, but are kept apart as if cut from different
+	// parts of the texture, keep the corners of the seam.
+	seamed := NewMesh(Plane(8, a))
+	if n := seamed.Simplify(0, 1e-9).NumFaces(); n != 2 {
+		t.Errorf("simplified plane without a seam has %d faces, want 2", n)
+	}
+	shared := len(seamed.UVs)
+	copies := map[int]int{}
+	for i := 0; i < seamed.NumFaces(); i++ {
+		p0, p1, p2 := seamed.face(i)
+		c := p0.Add(p1).Add(p2).Scale(1.0 / 3)
+		if c.X < 0 || c.Z > 0 && c.X < .5 {
+			continue
+		}
+		for k := 3 * i; k < 3*i+3; k++ {
+			uv := seamed.UVIndices[k]
+			if _, ok := copies[uv]; !ok {
+				copies[uv] = len(seamed.UVs)
+				seamed.UVs = append(seamed.UVs, seamed.UVs[uv])
+			}
+			seamed.UVIndices[k] = copies[uv]
+		}
+	}
+	simple = seamed.Simplify(0, 1e-9)
+	kept := map[Vector3]bool{}
+	for i := 0; i < simple.NumFaces(); i++ {
+		f := simple.Face(i)
+		right := simple.UVIndices[3*i] >= shared
+		for k := 0; k < 3; k++ {
+			kept[*simple.Positions[f[k]]] = true
+			if simple.UVIndices[3*i+k] >= shared != right {
+				t.Fatalf("face %d reaches across the seam", i)
+			}
+		}
+	}
+	for _, p := range []Vector3{{0, 0, -1}, {0, 0, 0}, {.5, 0, 0}, {.5, 0, 1}} {
+		if !kept[p] {
+			t.Errorf("the seam lost its corner at %v", p)
+		}
+	}
+}
+
+func TestLOD(t *testing.T) {
+	l := NewLOD(NewMesh(Icosphere(3, &SolidMaterial{})), 4)
+	for i := 1; i < len(l.Levels); i++ {
+		if l.Levels[i].NumFaces() >= l.Levels[i-1].NumFaces() || l.Errors[i] < l.Errors[i-1] {
+			t.Errorf("level %d has %d faces and error %v after %d and %v", i, l.Levels[i].NumFaces(), l.Errors[i], l.Levels[i-1].NumFaces(), l.Errors[i-1])
+		}
+	}
+	near, far := l.Select(Translate(0, 0, 3), 1000), l.Select(Translate(0, 0, 300), 1000)
+	if near != 0 || far != len(l.Levels)-1 {
+		t.Errorf("levels %d near and %d far, want 0 and %d", near, far, len(l.Levels)-1)
+	}
+}
@@ -0,0 +1,161 @@
+package graphics
+
+import "math"
+
+// Weld merges the positions of m closer than epsilon, which must be
+// positive, into the first of them, and drops the faces that collapse. It
+// returns the number of positions merged away.
+func (m *Mesh) Weld(epsilon float64) int {
+	// Positions are bucketed in cells epsilon wide, so that those within
+	// epsilon of each other are in the same or neighboring cells.
+	type cell [3]int64
+	cellOf := func(p *Vector3) cell {
+		return cell{int64(math.Floor(p.X / epsilon)), int64(math.Floor(p.Y / epsilon)), int64(math.Floor(p.Z / epsilon))}
+	}
+	grid := map[cell][]int{}
+	remap := make([]int, len(m.Positions))
+	var kept []*Vector3
+	for i, p := range m.Positions {
+		c := cellOf(p)
+		remap[i] = -1
+	search:
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, j := range grid[cell{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						if kept[j].Sub(p).Norm() <= epsilon {
+							remap[i] = j
+							break search
+						}
+					}
+				}
+			}
+		}
+		if remap[i] < 0 {
+			remap[i] = len(kept)
+			grid[c] = append(grid[c], len(kept))
+			kept = append(kept, p)
+		}
+	}
+
+	merged := len(m.Positions) - len(kept)
+	m.Positions = kept
+	faces := 0
+	for i := 0; i < m.NumFaces(); i++ {
+		a, b, c := remap[m.Indices[3*i]], remap[m.Indices[3*i+1]], remap[m.Indices[3*i+2]]
+		if a == b || b == c || a == c {
+			continue
+		}
+		m.Indices[3*faces], m.Indices[3*faces+1], m.Indices[3*faces+2] = a, b, c
+		copy(m.NormalIndices[3*faces:3*faces+3], m.NormalIndices[3*i:3*i+3])
+		copy(m.UVIndices[3*faces:3*faces+3], m.UVIndices[3*i:3*i+3])
+		m.FaceMaterials[faces] = m.FaceMaterials[i]
+		faces++
+	}
+	m.Indices = m.Indices[:3*faces]
+	m.NormalIndices = m.NormalIndices[:3*faces]
+	m.UVIndices = m.UVIndices[:3*faces]
+	m.FaceMaterials = m.FaceMaterials[:faces]
+	return merged
+}
+
+// SmoothNormals replaces the normals of m with the average of the normals of
+// the faces around each position, weighted by the angle of their corners
+// there. Faces meeting at more than creaseAngle radians are left out of each
+// other's averages, so that the edge between them stays sharp: zero gives
+// flat shading and Pi smooths everything. Faces face the way they are
+// wound, unless they have normals already, which decide the side that is
+// out as they do for CSG. Weld the mesh first, as faces only share normals
+// across the positions they share.
+func (m *Mesh) SmoothNormals(creaseAngle float64) {
+	minCos := math.Cos(creaseAngle)
+	faceNormals, angles := m.faceNormals()
+	vertexFaces := m.VertexFaces()
+	normals := map[Vector3]int{}
+	m.Normals = nil
+	for i, v := range m.Indices {
+		n := faceNormals[i/3]
+		if n == nil {
+			m.NormalIndices[i] = -1
+			continue
+		}
+		sum := &Vector3{}
+		for _, g := range vertexFaces[v] {
+			if g != i/3 && (faceNormals[g] == nil || faceNormals[g].Dot(n) < minCos) {
+				continue
+			}
+			for k, w := range m.Face(g) {
+				if w == v {
+					sum = sum.Add(faceNormals[g].Scale(angles[3*g+k]))
+				}
+			}
+		}
+		if sum.Norm() == 0 {
+			sum = n
+		}
+		m.NormalIndices[i] = m.addNormal(normals, sum.Normalize())
+	}
+}
+
+// faceNormals returns the unit normals of the faces of m, nil for those that
+// are degenerate, and the angles of their corners. Faces face the way they
+// are wound, unless they have normals, which decide.
+func (m *Mesh) faceNormals() ([]*Vector3, []float64) {
+	normals := make([]*Vector3, m.NumFaces())
+	angles := make([]float64, len(m.Indices))
+	for i := range normals {
+		f := m.Face(i)
+		p := [3]*Vector3{m.Positions[f[0]], m.Positions[f[1]], m.Positions[f[2]]}
+		if n := Cross(p[1].Sub(p[0]), p[2].Sub(p[0])); n.Norm() > 0 {
+			normals[i] = n.Normalize()
+			if m.faceNormalSum(i).Dot(n) < 0 {
+				normals[i] = normals[i].Scale(-1)
+			}
+		}
+		for k := range p {
+			a, b := p[(k+1)%3].Sub(p[k]), p[(k+2)%3].Sub(p[k])
+			if a.Norm() > 0 && b.Norm() > 0 {
+				angles[3*i+k] = math.Acos(math.Max(math.Min(a.Normalize().Dot(b.Normalize()), 1), -1))
+			}
+		}
+	}
+	return normals, angles
+}
+
+// addNormal returns the index of n in the normals of m, adding it if it is
+// not in index, which maps the normals added so far to their indices.
+func (m *Mesh) addNormal(index map[Vector3]int, n *Vector3) int {
+	i, ok := index[*n]
+	if !ok {
+		i = len(m.Normals)
+		index[*n] = i
+		m.Normals = append(m.Normals, n)
+	}
+	return i
+}
+
+// faceNormalSum is the sum of the normals of the corners of face i, zero if
+// any corner has none.
+func (m *Mesh) faceNormalSum(i int) *Vector3 {
+	sum := &Vector3{}
+	for _, n := range m.NormalIndices[3*i : 3*i+3] {
+		if n < 0 {
+			return &Vector3{}
+		}
+		sum = sum.Add(m.Normals[n])
+	}
+	return sum
+}
+
+// OpenObjSmooth reads an OBJ file as OpenObj does, then welds its points
+// closer than weld and gives it smooth normals with creases sharper than
+// creaseAngle, in place of those of the file. See SmoothNormals.
+func OpenObjSmooth(filename string, rgba *Color, weld, creaseAngle float64) ([]*Triangle, error) {
+	m, err := OpenObjMesh(filename, rgba)
+	if err != nil {
+		return nil, err
+	}
+	m.Weld(weld)
+	m.SmoothNormals(creaseAngle)
+	return m.Triangles(), nil
+}
@@ -0,0 +1,57 @@
+package graphics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMesh_Weld(t *testing.T) {
+	m := NewMesh(SphereMat(8, &SolidMaterial{}))
+	// The seam of the sphere is off from its start by rounding, and its poles
+	// are a ring of points.
+	if merged := m.Weld(1e-9); merged == 0 {
+		t.Fatal("nothing welded")
+	}
+	if want := 2 + 7*16; len(m.Positions) != want {
+		t.Errorf("welded sphere has %d positions, want %d", len(m.Positions), want)
+	}
+	for e, faces := range m.EdgeFaces() {
+		if len(faces) != 2 {
+			t.Fatalf("edge %v has faces %v, want two", e, faces)
+		}
+	}
+	if len(m.NormalIndices) != len(m.Indices) || len(m.FaceMaterials) != m.NumFaces() {
+		t.Error("faces lost their normals or materials")
+	}
+}
+
+func TestMesh_SmoothNormals(t *testing.T) {
+	cube := NewMesh(Cube(&SolidMaterial{}))
+	cube.SmoothNormals(math.Pi / 3)
+	for _, tri := range cube.Triangles() {
+		for _, n := range []*Vector3{tri.N0, tri.N1, tri.N2} {
+			if n.Dot(tri.Norm) < 1-1e-12 {
+				t.Fatalf("normal %v across a crease, want %v", n, tri.Norm)
+			}
+		}
+	}
+	cube.SmoothNormals(math.Pi)
+	for _, tri := range cube.Triangles() {
+		for _, v := range [][2]*Vector3{{tri.P0, tri.N0}, {tri.P1, tri.N1}, {tri.P2, tri.N2}} {
+			if v[1].Sub(v[0].Normalize()).Norm() > 1e-12 {
+				t.Fatalf("normal %v at corner %v, want it along the diagonal", v[1], v[0])
+			}
+		}
+	}
+
+	sphere := NewMesh(Icosphere(2, &SolidMaterial{}))
+	sphere.Weld(1e-9)
+	sphere.SmoothNormals(math.Pi / 3)
+	for _, tri := range sphere.Triangles() {
+		for _, v := range [][2]*Vector3{{tri.P0, tri.N0}, {tri.P1, tri.N1}, {tri.P2, tri.N2}} {
+			if v[1].Dot(v[0]) < .99 {
+				t.Fatalf("normal %v at %v, want it pointing out", v[1], v[0])
+			}
+		}
+	}
+}
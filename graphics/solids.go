@@ -9,219 +9,305 @@ var (
 	White = &Color{255, 255, 255, 255}
 )
 
-func Sphere(subdivisions int) []*Triangle {
-	ret := make([]*Triangle, 0)
-	pts := make([][]*Vector3, subdivisions-1)
-	m := &SolidMaterial{
-		Color:         White,
-		SpecColor_:    White,
-		SpecCoeff_:    8,
-		AmbientCoeff_: .05,
+// The generators below make primitives around the origin with a radius or
+// half extent of 1, unless they take their dimensions, with smooth vertex
+// normals, texture coordinates and tangents. Up is -Y, as in the scenes.
+// Place them with ApplyTransform.
+
+// primVertex is a corner of a generated triangle.
+type primVertex struct {
+	P  *Vector3
+	N  *Vector3
+	UV *Vector2
+}
+
+// primTriangle returns the triangle between a, b and c, or nil when two of
+// them are at the same point, as at the pole of a sphere.
+func primTriangle(a, b, c *primVertex, mat Material) *Triangle {
+	if *a.P == *b.P || *b.P == *c.P || *a.P == *c.P {
+		return nil
 	}
-	for i := range pts {
-		pts[i] = make([]*Vector3, subdivisions*2)
-		theta := math.Pi * (-0.5*float64(subdivisions) + 1.0 + float64(i)) / float64(subdivisions)
-		y := math.Sin(theta)
-		radius := math.Cos(theta)
-		for j := range pts[i] {
-			phi := math.Pi * float64(j) / float64(subdivisions)
-			x := math.Cos(phi) * radius
-			z := math.Sin(phi) * radius
-			pts[i][j] = &Vector3{x, y, z}
-		}
-		if i == 0 {
+	t := NewTriangle(a.P, b.P, c.P, mat)
+	t.N0, t.N1, t.N2 = a.N, b.N, c.N
+	t.UV0, t.UV1, t.UV2 = a.UV, b.UV, c.UV
+	return t
+}
 
-			continue
+// gridSurface stitches cols by rows quads between the points f(i, j), for
+// 0 <= i <= cols and 0 <= j <= rows, which are given the texture coordinates
+// (i/cols, j/rows). Every primitive is built from one or more of these grids.
+func gridSurface(cols, rows int, mat Material, f func(i, j int) (p, n *Vector3)) []*Triangle {
+	grid := make([][]*primVertex, rows+1)
+	for j := range grid {
+		grid[j] = make([]*primVertex, cols+1)
+		for i := range grid[j] {
+			p, n := f(i, j)
+			grid[j][i] = &primVertex{p, n.Normalize(), &Vector2{float64(i) / float64(cols), float64(j) / float64(rows)}}
 		}
-		for j := range pts[i] {
-			l := (2*subdivisions + j - 1) % (2 * subdivisions)
-			r := j
-			t := i
-			b := i - 1
-
-			t1 := NewTriangle(pts[t][l], pts[t][r], pts[b][l], m)
-			t1.N0 = pts[t][l]
-			t1.N1 = pts[t][r]
-			t1.N2 = pts[b][l]
-			t2 := NewTriangle(pts[b][r], pts[t][r], pts[b][l], m)
-			t2.N0 = pts[b][r]
-			t2.N1 = pts[t][r]
-			t2.N2 = pts[b][l]
-
-			ret = append(ret, t1, t2)
+	}
+	ret := make([]*Triangle, 0, 2*cols*rows)
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			a, b, c, d := grid[j][i], grid[j][i+1], grid[j+1][i+1], grid[j+1][i]
+			for _, t := range []*Triangle{primTriangle(a, b, c, mat), primTriangle(a, c, d, mat)} {
+				if t != nil {
+					ret = append(ret, t)
+				}
+			}
 		}
 	}
-	i := 0
-	for j := range pts[i] {
-		l := (2*subdivisions + j - 1) % (2 * subdivisions)
-		r := j
-		top := subdivisions - 2
-		t1 := NewTriangle(pts[i][l], pts[i][r], &Vector3{0, -1, 0}, m)
-		t1.N0 = pts[i][l]
-		t1.N1 = pts[i][r]
-		t1.N2 = &Vector3{0, -1, 0}
-		t2 := NewTriangle(pts[top][l], pts[top][r], &Vector3{0, 1, 0}, m)
-		t2.N0 = pts[top][l]
-		t2.N1 = pts[top][r]
-		t2.N2 = &Vector3{0, 1, 0}
-		ret = append(ret, t1, t2)
+	return ret
+}
 
+// profilePoint is a point of the outline a surface of revolution is swept
+// from: its distance R from the Y axis, its height Y, and the normal there
+// as NR outward and NY along Y. Repeating a point with another normal makes
+// a crease.
+type profilePoint struct {
+	R, Y   float64
+	NR, NY float64
+}
+
+// lathe sweeps profile around the Y axis in segments steps. U runs around
+// the axis, from +X towards +Z, and V along the profile.
+func lathe(profile []profilePoint, segments int, mat Material) []*Triangle {
+	return gridSurface(segments, len(profile)-1, mat, func(i, j int) (*Vector3, *Vector3) {
+		phi := 2 * math.Pi * float64(i) / float64(segments)
+		c, s := math.Cos(phi), math.Sin(phi)
+		pp := profile[j]
+		return &Vector3{pp.R * c, pp.Y, pp.R * s}, &Vector3{pp.NR * c, pp.NY, pp.NR * s}
+	})
+}
+
+// arc is the profile of the part of a sphere of radius r centered at y
+// between the latitudes from and to, in steps steps. A latitude of -Pi/2 is
+// the top pole.
+func arc(r, y, from, to float64, steps int) []profilePoint {
+	ret := make([]profilePoint, steps+1)
+	for k := range ret {
+		theta := from + (to-from)*float64(k)/float64(steps)
+		c, s := math.Cos(theta), math.Sin(theta)
+		if math.Abs(theta) == math.Pi/2 {
+			c = 0
+		}
+		ret[k] = profilePoint{r * c, y + r*s, c, s}
 	}
 	return ret
 }
 
+func Sphere(subdivisions int) []*Triangle {
+	return SphereMat(subdivisions, &SolidMaterial{
+		Color:         White,
+		SpecColor_:    White,
+		SpecCoeff_:    8,
+		AmbientCoeff_: .05,
+	})
+}
+
+// SphereMat is a UV sphere of subdivisions bands from pole to pole and twice
+// as many around. U follows the longitude and V runs from the top pole to
+// the bottom one.
 func SphereMat(subdivisions int, mat Material) []*Triangle {
-	ret := make([]*Triangle, 0)
-	pts := make([][]*Vector3, subdivisions-1)
-	for i := range pts {
-		pts[i] = make([]*Vector3, subdivisions*2)
-		theta := math.Pi * (-0.5*float64(subdivisions) + 1.0 + float64(i)) / float64(subdivisions)
-		y := math.Sin(theta)
-		radius := math.Cos(theta)
-		for j := range pts[i] {
-			phi := math.Pi * float64(j) / float64(subdivisions)
-			x := math.Cos(phi) * radius
-			z := math.Sin(phi) * radius
-			pts[i][j] = &Vector3{x, y, z}
-		}
-		if i == 0 {
+	ret := lathe(arc(1, 0, -math.Pi/2, math.Pi/2, subdivisions), 2*subdivisions, mat)
+	ComputeTangents(ret)
+	return ret
+}
 
-			continue
-		}
-		for j := range pts[i] {
-			l := (2*subdivisions + j - 1) % (2 * subdivisions)
-			r := j
-			t := i
-			b := i - 1
-
-			t1 := NewTriangle(pts[t][l], pts[t][r], pts[b][l], mat)
-			t1.N0 = pts[t][l]
-			t1.N1 = pts[t][r]
-			t1.N2 = pts[b][l]
-			t2 := NewTriangle(pts[b][r], pts[t][r], pts[b][l], mat)
-			t2.N0 = pts[b][r]
-			t2.N1 = pts[t][r]
-			t2.N2 = pts[b][l]
-
-			ret = append(ret, t1, t2)
+func ImgSphere(subdivisions int, im image.Image) []*Triangle {
+	tex := NewTexture(im)
+	tex.WrapT = WrapClamp
+	return TextureSphere(subdivisions, tex)
+}
+
+// TextureSphere is ImgSphere with a mipmapped texture shared by every
+// triangle. tex should repeat horizontally, across the seam, and clamp
+// vertically, at the poles.
+func TextureSphere(subdivisions int, tex *Texture) []*Triangle {
+	mat := &TextureMaterial{
+		Texture:       tex,
+		SpecColor_:    ColorScale(White, .5),
+		SpecCoeff_:    8,
+		AmbientCoeff_: .05,
+	}
+	bottomMat := &TextureMaterial{
+		Texture:       tex,
+		SpecColor_:    ColorScale(White, .3),
+		SpecCoeff_:    8,
+		AmbientCoeff_: .05,
+	}
+	ret := SphereMat(subdivisions, mat)
+	// The last band, around the bottom pole, is one triangle per segment.
+	for _, t := range ret[len(ret)-2*subdivisions:] {
+		t.Material = bottomMat
+	}
+	return ret
+}
+
+// Plane is the square from -1 to 1 in X and Z, facing up, split into
+// subdivisions by subdivisions quads. U runs along X and V along Z.
+func Plane(subdivisions int, mat Material) []*Triangle {
+	ret := gridSurface(subdivisions, subdivisions, mat, func(i, j int) (*Vector3, *Vector3) {
+		x := 2*float64(i)/float64(subdivisions) - 1
+		z := 2*float64(j)/float64(subdivisions) - 1
+		return &Vector3{x, 0, z}, &Vector3{0, -1, 0}
+	})
+	ComputeTangents(ret)
+	return ret
+}
+
+// Cube is the cube from -1 to 1 on every axis. Its faces are flat, each
+// with the whole texture.
+func Cube(mat Material) []*Triangle {
+	ret := make([]*Triangle, 0, 12)
+	for _, n := range []*Vector3{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+		// u and v span the face, with u cross v along n.
+		u := &Vector3{n.Y + n.Z, 0, n.X}
+		if n.Y != 0 {
+			u = &Vector3{n.Y, 0, 0}
 		}
+		v := Cross(n, u)
+		ret = append(ret, gridSurface(1, 1, mat, func(i, j int) (*Vector3, *Vector3) {
+			return n.Add(u.Scale(float64(2*i - 1))).Add(v.Scale(float64(2*j - 1))), n
+		})...)
 	}
-	i := 0
-	for j := range pts[i] {
-		l := (2*subdivisions + j - 1) % (2 * subdivisions)
-		r := j
-		top := subdivisions - 2
-		t1 := NewTriangle(pts[i][l], pts[i][r], &Vector3{0, -1, 0}, mat)
-		t1.N0 = pts[i][l]
-		t1.N1 = pts[i][r]
-		t1.N2 = &Vector3{0, -1, 0}
-		t2 := NewTriangle(pts[top][l], pts[top][r], &Vector3{0, 1, 0}, mat)
-		t2.N0 = pts[top][l]
-		t2.N1 = pts[top][r]
-		t2.N2 = &Vector3{0, 1, 0}
-		ret = append(ret, t1, t2)
+	ComputeTangents(ret)
+	return ret
+}
+
+// Disk is the unit disk in the XZ plane, facing up, with polar texture
+// coordinates: U around and V out from the center.
+func Disk(segments int, mat Material) []*Triangle {
+	ret := lathe([]profilePoint{{0, 0, 0, -1}, {1, 0, 0, -1}}, segments, mat)
+	ComputeTangents(ret)
+	return ret
+}
+
+// Cylinder is the cylinder of radius 1 from y = -1 to 1, closed by flat
+// caps. Its side is smooth and its rims are sharp.
+func Cylinder(segments int, mat Material) []*Triangle {
+	ret := lathe([]profilePoint{
+		{0, -1, 0, -1}, {1, -1, 0, -1},
+		{1, -1, 1, 0}, {1, 1, 1, 0},
+		{1, 1, 0, 1}, {0, 1, 0, 1},
+	}, segments, mat)
+	ComputeTangents(ret)
+	return ret
+}
+
+// Cone is the cone with its apex at y = -1 and a base of radius 1 at y = 1.
+func Cone(segments int, mat Material) []*Triangle {
+	// The side rises 2 over a run of 1, so its normal is (2, -1) over its
+	// length.
+	nr, ny := 2/math.Sqrt(5), -1/math.Sqrt(5)
+	ret := lathe([]profilePoint{
+		{0, -1, nr, ny}, {1, 1, nr, ny},
+		{1, 1, 0, 1}, {0, 1, 0, 1},
+	}, segments, mat)
+	ComputeTangents(ret)
+	return ret
+}
 
+// Capsule is a cylinder of radius and height, centered on the origin along
+// Y, capped by hemispheres.
+func Capsule(radius, height float64, segments int, mat Material) []*Triangle {
+	rings := maxi(segments/4, 1)
+	profile := arc(radius, -height/2, -math.Pi/2, 0, rings)
+	profile = append(profile, arc(radius, height/2, 0, math.Pi/2, rings)...)
+	ret := lathe(profile, segments, mat)
+	ComputeTangents(ret)
+	return ret
+}
+
+// Torus is the ring of radius major around the Y axis of a tube of radius
+// minor. U runs around the ring and V around the tube, sides steps.
+func Torus(major, minor float64, segments, sides int, mat Material) []*Triangle {
+	profile := make([]profilePoint, sides+1)
+	for k := range profile {
+		theta := 2 * math.Pi * float64(k) / float64(sides)
+		c, s := math.Cos(theta), math.Sin(theta)
+		profile[k] = profilePoint{major + minor*c, minor * s, c, s}
 	}
+	ret := lathe(profile, segments, mat)
+	ComputeTangents(ret)
 	return ret
 }
 
-func ImgSphere(subdivisions int, im image.Image) []*Triangle {
-	ret := make([]*Triangle, 0)
-	pts := make([][]*Vector3, subdivisions-1)
-	for i := range pts {
-		pts[i] = make([]*Vector3, subdivisions*2)
-		theta := math.Pi * (-0.5*float64(subdivisions) + 1.0 + float64(i)) / float64(subdivisions)
-		y := math.Sin(theta)
-		radius := math.Cos(theta)
-		for j := range pts[i] {
-			phi := math.Pi * float64(j) / float64(subdivisions)
-			x := math.Cos(phi) * radius
-			z := math.Sin(phi) * radius
-			pts[i][j] = &Vector3{x, y, z}
+// Icosphere is the unit sphere made by splitting each triangle of an
+// icosahedron in four, subdivisions times. Its triangles are all close to the
+// same size, unlike those of SphereMat, which crowd at the poles. It has the
+// texture coordinates of SphereMat.
+func Icosphere(subdivisions int, mat Material) []*Triangle {
+	g := (1 + math.Sqrt(5)) / 2
+	pts := []*Vector3{
+		{-1, g, 0}, {1, g, 0}, {-1, -g, 0}, {1, -g, 0},
+		{0, -1, g}, {0, 1, g}, {0, -1, -g}, {0, 1, -g},
+		{g, 0, -1}, {g, 0, 1}, {-g, 0, -1}, {-g, 0, 1},
+	}
+	for i, p := range pts {
+		pts[i] = p.Normalize()
+	}
+	faces := [][3]int{
+		{0, 11, 5}, {0, 5, 1}, {0, 1, 7}, {0, 7, 10}, {0, 10, 11},
+		{1, 5, 9}, {5, 11, 4}, {11, 10, 2}, {10, 7, 6}, {7, 1, 8},
+		{3, 9, 4}, {3, 4, 2}, {3, 2, 6}, {3, 6, 8}, {3, 8, 9},
+		{4, 9, 5}, {2, 4, 11}, {6, 2, 10}, {8, 6, 7}, {9, 8, 1},
+	}
+	for s := 0; s < subdivisions; s++ {
+		mid := map[[2]int]int{}
+		midpoint := func(a, b int) int {
+			key := [2]int{mini(a, b), maxi(a, b)}
+			if k, ok := mid[key]; ok {
+				return k
+			}
+			pts = append(pts, pts[a].Add(pts[b]).Normalize())
+			mid[key] = len(pts) - 1
+			return len(pts) - 1
 		}
-		if i == 0 {
-
-			continue
+		next := make([][3]int, 0, 4*len(faces))
+		for _, f := range faces {
+			ab, bc, ca := midpoint(f[0], f[1]), midpoint(f[1], f[2]), midpoint(f[2], f[0])
+			next = append(next, [3]int{f[0], ab, ca}, [3]int{f[1], bc, ab}, [3]int{f[2], ca, bc}, [3]int{ab, bc, ca})
 		}
-		for j := range pts[i] {
-			l := (2*subdivisions + j - 1) % (2 * subdivisions)
-			r := j
-			t := i
-			b := i - 1
-			tlTex := &Vector2{float64(l) / float64(2*subdivisions), float64(t+1) / float64(subdivisions)}
-			blTex := &Vector2{float64(l) / float64(2*subdivisions), float64(b+1) / float64(subdivisions)}
-			trTex := &Vector2{float64(r) / float64(2*subdivisions), float64(t+1) / float64(subdivisions)}
-			brTex := &Vector2{float64(r) / float64(2*subdivisions), float64(b+1) / float64(subdivisions)}
-			if j == 0 {
-				trTex.X = 1
-				brTex.X = 1
+		faces = next
+	}
+
+	ret := make([]*Triangle, 0, len(faces))
+	for _, f := range faces {
+		var v [3]*primVertex
+		for k, i := range f {
+			p := pts[i]
+			u := math.Atan2(p.Z, p.X) / (2 * math.Pi)
+			if u < 0 {
+				u++
 			}
-			m1 := &TextureMaterial{
-				P1:            tlTex,
-				P2:            trTex,
-				P3:            blTex,
-				Im:            im,
-				SpecColor_:    ColorScale(White, .5),
-				SpecCoeff_:    8,
-				AmbientCoeff_: .05,
+			v[k] = &primVertex{p, p, &Vector2{u, math.Acos(math.Max(-1, math.Min(1, -p.Y))) / math.Pi}}
+		}
+		// Faces across the seam take U past 1 rather than wrapping back to
+		// 0, and vertices on a pole, where U is undefined, take the mean U
+		// of the rest of the face.
+		pole := func(k int) bool {
+			p := v[k].P
+			return p.X*p.X+p.Z*p.Z < 1e-18
+		}
+		for k := range v {
+			if pole(k) || v[k].UV.X >= .25 {
+				continue
 			}
-			t1 := NewTriangle(pts[t][l], pts[t][r], pts[b][l], m1)
-			t1.N0 = pts[t][l]
-			t1.N1 = pts[t][r]
-			t1.N2 = pts[b][l]
-
-			m2 := &TextureMaterial{
-				P1:            brTex,
-				P2:            trTex,
-				P3:            blTex,
-				Im:            im,
-				SpecColor_:    ColorScale(White, .5),
-				SpecCoeff_:    8,
-				AmbientCoeff_: .05,
+			for _, o := range []int{(k + 1) % 3, (k + 2) % 3} {
+				if !pole(o) && v[o].UV.X > .75 {
+					v[k].UV = &Vector2{v[k].UV.X + 1, v[k].UV.Y}
+					break
+				}
 			}
-			t2 := NewTriangle(pts[b][r], pts[t][r], pts[b][l], m2)
-			t2.N0 = pts[b][r]
-			t2.N1 = pts[t][r]
-			t2.N2 = pts[b][l]
-
-			ret = append(ret, t1, t2)
 		}
-	}
-	i := 0
-	for j := range pts[i] {
-		l := (2*subdivisions + j - 1) % (2 * subdivisions)
-		r := j
-
-		m1 := &TextureMaterial{
-			P1:            &Vector2{float64(l) / float64(2*subdivisions), 1 / float64(subdivisions)},
-			P2:            &Vector2{float64(r) / float64(2*subdivisions), 1 / float64(subdivisions)},
-			P3:            &Vector2{.5, 0},
-			Im:            im,
-			SpecColor_:    ColorScale(White, .5),
-			SpecCoeff_:    8,
-			AmbientCoeff_: .05,
-		}
-
-		top := subdivisions - 2
-		t1 := NewTriangle(pts[i][l], pts[i][r], &Vector3{0, -1, 0}, m1)
-		t1.N0 = pts[i][l]
-		t1.N1 = pts[i][r]
-		t1.N2 = &Vector3{0, -1, 0}
-		m2 := &TextureMaterial{
-			P1:            &Vector2{float64(l) / float64(2*subdivisions), 1 - 1/float64(subdivisions)},
-			P2:            &Vector2{float64(r) / float64(2*subdivisions), 1 - 1/float64(subdivisions)},
-			P3:            &Vector2{.5, 1},
-			Im:            im,
-			SpecColor_:    ColorScale(White, .3),
-			SpecCoeff_:    8,
-			AmbientCoeff_: .05,
+		for k := range v {
+			if pole(k) {
+				a, b := v[(k+1)%3].UV, v[(k+2)%3].UV
+				v[k].UV = &Vector2{(a.X + b.X) / 2, v[k].UV.Y}
+			}
 		}
-		t2 := NewTriangle(pts[top][l], pts[top][r], &Vector3{0, 1, 0}, m2)
-		t2.N0 = pts[top][l]
-		t2.N1 = pts[top][r]
-		t2.N2 = &Vector3{0, 1, 0}
-		ret = append(ret, t1, t2)
-
+		ret = append(ret, primTriangle(v[0], v[1], v[2], mat))
 	}
+	ComputeTangents(ret)
 	return ret
 }
@@ -0,0 +1,61 @@
+package graphics
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestPrimitives(t *testing.T) {
+	m := &SolidMaterial{Color: White}
+	for _, tc := range []struct {
+		name   string
+		tris   []*Triangle
+		area   float64
+		convex bool
+	}{
+		{"SphereMat", SphereMat(40, m), 4 * math.Pi, true},
+		{"Icosphere", Icosphere(4, m), 4 * math.Pi, true},
+		{"Plane", Plane(3, m), 4, false},
+		{"Cube", Cube(m), 24, true},
+		{"Disk", Disk(200, m), math.Pi, false},
+		{"Cylinder", Cylinder(200, m), 6 * math.Pi, true},
+		{"Cone", Cone(200, m), math.Pi + math.Pi*math.Sqrt(5), true},
+		{"Capsule", Capsule(1, 2, 200, m), 8 * math.Pi, true},
+		{"Torus", Torus(2, .5, 200, 100, m), 4 * math.Pi * math.Pi * 2 * .5, false},
+	} {
+		if a := NewMesh(tc.tris).Area(); math.Abs(a-tc.area) > .01*tc.area {
+			t.Errorf("%s has area %v, want %v", tc.name, a, tc.area)
+		}
+		for _, tri := range tc.tris {
+			if tri.Material != m || tri.UV0 == nil || tri.Tan0 == nil {
+				t.Fatalf("%s triangle is missing its material, UVs or tangents", tc.name)
+			}
+			for _, v := range [][2]*Vector3{{tri.P0, tri.N0}, {tri.P1, tri.N1}, {tri.P2, tri.N2}} {
+				if math.Abs(v[1].Norm()-1) > 1e-9 {
+					t.Fatalf("%s normal %v is not a unit vector", tc.name, v[1])
+				}
+				if tc.convex && v[0].Dot(v[1]) <= 0 {
+					t.Fatalf("%s normal %v at %v points inward", tc.name, v[1], v[0])
+				}
+			}
+		}
+	}
+}
+
+func TestSphereMat(t *testing.T) {
+	n := 10
+	if got := len(SphereMat(n, &SolidMaterial{})); got != 4*n*n-4*n {
+		t.Errorf("SphereMat(%d) has %d triangles, want %d", n, got, 4*n*n-4*n)
+	}
+	sphere := TextureSphere(n, NewTexture(image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	top, bottom := sphere[0].Material, sphere[len(sphere)-1].Material
+	if top == bottom {
+		t.Error("TextureSphere bottom cap shares the material of the rest")
+	}
+	for _, tri := range sphere {
+		if (tri.Centroid().Y > .93) != (tri.Material == bottom) {
+			t.Errorf("triangle at %v is in the wrong part of the sphere", tri.Centroid())
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package graphics
+
+import "math"
+
+// SharpEdges returns the edges of m between faces that meet at more than
+// angle radians, to keep as creases when subdividing it.
+func (m *Mesh) SharpEdges(angle float64) map[Edge]bool {
+	normals, _ := m.faceNormals()
+	minCos := math.Cos(angle)
+	ret := map[Edge]bool{}
+	for e, faces := range m.EdgeFaces() {
+		if len(faces) != 2 {
+			continue
+		}
+		a, b := normals[faces[0]], normals[faces[1]]
+		if a == nil || b == nil || a.Dot(b) < minCos {
+			ret[e] = true
+		}
+	}
+	return ret
+}
+
+// Loop subdivides m levels times by Loop's scheme, splitting every triangle
+// in four and smoothing the points toward a limit surface. The edges in
+// creases, nil for none, stay sharp, as do the boundaries of m. Texture
+// coordinates are interpolated along the new edges. The normals of m are
+// not carried through: the result gets new smooth normals that break across
+// the creases.
+func (m *Mesh) Loop(levels int, creases map[Edge]bool) *Mesh {
+	ret := *m
+	for i := 0; i < levels; i++ {
+		ret, creases = loopStep(&ret, creases)
+	}
+	ret.creaseNormals(creases)
+	return &ret
+}
+
+// subdivision holds the points and texture coordinates of a mesh being
+// subdivided, and the creases between its points. Its normals are left
+// until the end, when creaseNormals works them out anew.
+type subdivision struct {
+	positions []*Vector3
+	uvs       []*Vector2
+	creases   map[Edge]bool
+	// edgeUVs holds the texture coordinates halfway between pairs of the
+	// old ones.
+	edgeUVs map[[2]int]int
+}
+
+func newSubdivision(uvs []*Vector2) *subdivision {
+	return &subdivision{
+		uvs:     append([]*Vector2(nil), uvs...),
+		creases: map[Edge]bool{},
+		edgeUVs: map[[2]int]int{},
+	}
+}
+
+// uv returns the index of the average of the texture coordinates ids, or -1
+// if any is -1. Averages of two are shared by the faces on both sides of an
+// edge.
+func (s *subdivision) uv(ids ...int) int {
+	key := [2]int{-1, -1}
+	if len(ids) == 2 {
+		key = [2]int{ids[0], ids[1]}
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if i, ok := s.edgeUVs[key]; ok {
+			return i
+		}
+	}
+	sum := &Vector2{}
+	for _, i := range ids {
+		if i < 0 {
+			return -1
+		}
+		sum = sum.Add(s.uvs[i])
+	}
+	s.uvs = append(s.uvs, sum.Scale(1/float64(len(ids))))
+	if len(ids) == 2 {
+		s.edgeUVs[key] = len(s.uvs) - 1
+	}
+	return len(s.uvs) - 1
+}
+
+// splitCreases marks the halves of each old crease, split at the new point
+// at index mid, as creases.
+func (s *subdivision) splitCreases(old map[Edge]bool, mids map[Edge]int) {
+	for e := range old {
+		if mid, ok := mids[e]; ok {
+			s.creases[NewEdge(e[0], mid)] = true
+			s.creases[NewEdge(mid, e[1])] = true
+		}
+	}
+}
+
+// smoothVertex moves the old point v, whose neighbors are ns and whose
+// neighbors along creases are sharp: points on a crease slide along it,
+// points where creases meet or turn a corner stay, and the others move by
+// smooth.
+func smoothVertex(positions []*Vector3, v int, ns, sharp []int, smooth func() *Vector3) *Vector3 {
+	p := positions[v]
+	switch {
+	case len(ns) <= 2 || len(sharp) > 2:
+		return p
+	case len(sharp) == 2:
+		return p.Scale(.75).Add(positions[sharp[0]].Add(positions[sharp[1]]).Scale(.125))
+	default:
+		return smooth()
+	}
+}
+
+// orderedEdges returns the edges of faces in the order they first appear,
+// with the neighbors of every point, so that subdivision does not depend on
+// the order of maps.
+func orderedEdges(points int, faces [][]int) ([]Edge, [][]int) {
+	seen := map[Edge]bool{}
+	var edges []Edge
+	neighbors := make([][]int, points)
+	for _, f := range faces {
+		for k := range f {
+			e := NewEdge(f[k], f[(k+1)%len(f)])
+			if seen[e] {
+				continue
+			}
+			seen[e] = true
+			edges = append(edges, e)
+			neighbors[e[0]] = append(neighbors[e[0]], e[1])
+			neighbors[e[1]] = append(neighbors[e[1]], e[0])
+		}
+	}
+	return edges, neighbors
+}
+
+func loopStep(m *Mesh, creases map[Edge]bool) (Mesh, map[Edge]bool) {
+	faces := make([][]int, m.NumFaces())
+	for i := range faces {
+		f := m.Face(i)
+		faces[i] = f[:]
+	}
+	edgeFaces := m.EdgeFaces()
+	sharp := func(e Edge) bool {
+		return creases[e] || len(edgeFaces[e]) != 2
+	}
+	edges, neighbors := orderedEdges(len(m.Positions), faces)
+
+	s := newSubdivision(m.UVs)
+	s.positions = make([]*Vector3, len(m.Positions), len(m.Positions)+len(edges))
+	for v, ns := range neighbors {
+		var ss []int
+		for _, w := range ns {
+			if sharp(NewEdge(v, w)) {
+				ss = append(ss, w)
+			}
+		}
+		s.positions[v] = smoothVertex(m.Positions, v, ns, ss, func() *Vector3 {
+			n := float64(len(ns))
+			c := 3.0/8 + math.Cos(2*math.Pi/n)/4
+			beta := (5.0/8 - c*c) / n
+			sum := &Vector3{}
+			for _, w := range ns {
+				sum = sum.Add(m.Positions[w])
+			}
+			return m.Positions[v].Scale(1 - n*beta).Add(sum.Scale(beta))
+		})
+	}
+	mids := map[Edge]int{}
+	for _, e := range edges {
+		a, b := m.Positions[e[0]], m.Positions[e[1]]
+		p := a.Add(b).Scale(.5)
+		if !sharp(e) {
+			// Weigh in the far corners of the faces on both sides.
+			p = a.Add(b).Scale(3.0 / 8)
+			for _, f := range edgeFaces[e] {
+				for _, w := range m.Face(f) {
+					if w != e[0] && w != e[1] {
+						p = p.Add(m.Positions[w].Scale(1.0 / 8))
+					}
+				}
+			}
+		}
+		mids[e] = len(s.positions)
+		s.positions = append(s.positions, p)
+	}
+	s.splitCreases(creases, mids)
+
+	ret := Mesh{Positions: s.positions, Materials: m.Materials}
+	for i, f := range faces {
+		// Corners 0 to 2 are those of the face, and 3 to 5 the midpoints
+		// of its edges from them.
+		var v, uv [6]int
+		for k := 0; k < 3; k++ {
+			l := (k + 1) % 3
+			v[k], uv[k] = f[k], m.UVIndices[3*i+k]
+			v[k+3] = mids[NewEdge(f[k], f[l])]
+			uv[k+3] = s.uv(m.UVIndices[3*i+k], m.UVIndices[3*i+l])
+		}
+		for _, t := range [][3]int{{0, 3, 5}, {3, 1, 4}, {5, 4, 2}, {3, 4, 5}} {
+			for _, c := range t {
+				ret.Indices = append(ret.Indices, v[c])
+				ret.NormalIndices = append(ret.NormalIndices, -1)
+				ret.UVIndices = append(ret.UVIndices, uv[c])
+			}
+			ret.FaceMaterials = append(ret.FaceMaterials, m.FaceMaterials[i])
+		}
+	}
+	ret.UVs = s.uvs
+	return ret, s.creases
+}
+
+// CatmullClark subdivides p levels times by Catmull and Clark's scheme,
+// splitting every face into quads around its center and smoothing the
+// points toward a limit surface, and returns the quads as triangles. Creases
+// are as for Loop.
+func (p *PolyMesh) CatmullClark(levels int, creases map[Edge]bool) *Mesh {
+	for i := 0; i < levels; i++ {
+		p, creases = catmullClarkStep(p, creases)
+	}
+	m := p.Triangulate()
+	m.creaseNormals(creases)
+	return m
+}
+
+// Subdivide subdivides p by Loop's scheme if all its faces are triangles,
+// and by Catmull and Clark's otherwise.
+func (p *PolyMesh) Subdivide(levels int, creases map[Edge]bool) *Mesh {
+	for _, f := range p.Faces {
+		if len(f.Indices) != 3 {
+			return p.CatmullClark(levels, creases)
+		}
+	}
+	return p.Triangulate().Loop(levels, creases)
+}
+
+func catmullClarkStep(p *PolyMesh, creases map[Edge]bool) (*PolyMesh, map[Edge]bool) {
+	faces := make([][]int, len(p.Faces))
+	for i, f := range p.Faces {
+		faces[i] = f.Indices
+	}
+	edgeFaces := map[Edge][]int{}
+	vertexFaces := make([][]int, len(p.Positions))
+	for i, f := range faces {
+		for k := range f {
+			e := NewEdge(f[k], f[(k+1)%len(f)])
+			edgeFaces[e] = append(edgeFaces[e], i)
+			vertexFaces[f[k]] = append(vertexFaces[f[k]], i)
+		}
+	}
+	sharp := func(e Edge) bool {
+		return creases[e] || len(edgeFaces[e]) != 2
+	}
+	edges, neighbors := orderedEdges(len(p.Positions), faces)
+
+	s := newSubdivision(p.UVs)
+	s.positions = make([]*Vector3, len(p.Positions), len(p.Positions)+len(faces)+len(edges))
+	centers := make([]*Vector3, len(faces))
+	for i, f := range faces {
+		sum := &Vector3{}
+		for _, v := range f {
+			sum = sum.Add(p.Positions[v])
+		}
+		centers[i] = sum.Scale(1 / float64(len(f)))
+	}
+	for v, ns := range neighbors {
+		var ss []int
+		for _, w := range ns {
+			if sharp(NewEdge(v, w)) {
+				ss = append(ss, w)
+			}
+		}
+		s.positions[v] = smoothVertex(p.Positions, v, ns, ss, func() *Vector3 {
+			// The average of the centers of the faces around the point,
+			// twice that of the midpoints of its edges, and n - 3 times
+			// the point, over the n edges.
+			fs := &Vector3{}
+			for _, f := range vertexFaces[v] {
+				fs = fs.Add(centers[f])
+			}
+			es := &Vector3{}
+			for _, w := range ns {
+				es = es.Add(p.Positions[v].Add(p.Positions[w]).Scale(.5))
+			}
+			n := float64(len(ns))
+			f := fs.Scale(1 / float64(len(vertexFaces[v])))
+			r := es.Scale(1 / n)
+			return f.Add(r.Scale(2)).Add(p.Positions[v].Scale(n - 3)).Scale(1 / n)
+		})
+	}
+	first := len(s.positions)
+	s.positions = append(s.positions, centers...)
+	mids := map[Edge]int{}
+	for _, e := range edges {
+		q := p.Positions[e[0]].Add(p.Positions[e[1]]).Scale(.5)
+		if !sharp(e) {
+			fs := edgeFaces[e]
+			q = q.Add(centers[fs[0]].Add(centers[fs[1]]).Scale(.5)).Scale(.5)
+		}
+		mids[e] = len(s.positions)
+		s.positions = append(s.positions, q)
+	}
+	s.splitCreases(creases, mids)
+
+	ret := &PolyMesh{Positions: s.positions, Materials: p.Materials}
+	for i, f := range p.Faces {
+		n := len(f.Indices)
+		center := first + i
+		centerUV := s.uv(f.UVIndices...)
+		// The quad at each corner runs from it to the midpoint of the edge
+		// after it, the center, and the midpoint of the edge before it.
+		mid := func(k int) (int, int) {
+			l := (k + 1) % n
+			return mids[NewEdge(f.Indices[k], f.Indices[l])], s.uv(f.UVIndices[k], f.UVIndices[l])
+		}
+		for k := 0; k < n; k++ {
+			after, afterUV := mid(k)
+			before, beforeUV := mid((k + n - 1) % n)
+			ret.Faces = append(ret.Faces, &PolyFace{
+				Indices:       []int{f.Indices[k], after, center, before},
+				NormalIndices: []int{-1, -1, -1, -1},
+				UVIndices:     []int{f.UVIndices[k], afterUV, centerUV, beforeUV},
+				Material:      f.Material,
+			})
+		}
+	}
+	ret.UVs = s.uvs
+	return ret, s.creases
+}
+
+// creaseNormals replaces the normals of m with the angle weighted average of
+// the normals of the faces around each point, as SmoothNormals does, but
+// parting the faces on the two sides of each crease rather than by angle.
+func (m *Mesh) creaseNormals(creases map[Edge]bool) {
+	faceNormals, angles := m.faceNormals()
+	normalIndices := make([]int, len(m.Indices))
+	normals := map[Vector3]int{}
+	m.Normals = nil
+	for v, faces := range m.VertexFaces() {
+		// Faces around v are joined across the edges from v that are not
+		// creases, into wedges that share a normal.
+		wedge := map[int]int{}
+		var find func(f int) int
+		find = func(f int) int {
+			if w, ok := wedge[f]; ok && w != f {
+				wedge[f] = find(w)
+				return wedge[f]
+			}
+			return f
+		}
+		across := map[int][]int{}
+		for _, f := range faces {
+			for _, w := range m.Face(f) {
+				if w != v {
+					across[w] = append(across[w], f)
+				}
+			}
+		}
+		for w, fs := range across {
+			if len(fs) == 2 && !creases[NewEdge(v, w)] {
+				wedge[find(fs[0])] = find(fs[1])
+			}
+		}
+		corner := func(f int) int {
+			for k := 3 * f; k < 3*f+3; k++ {
+				if m.Indices[k] == v {
+					return k
+				}
+			}
+			return -1
+		}
+		sums := map[int]*Vector3{}
+		for _, f := range faces {
+			if faceNormals[f] == nil {
+				continue
+			}
+			w := find(f)
+			if sums[w] == nil {
+				sums[w] = &Vector3{}
+			}
+			sums[w] = sums[w].Add(faceNormals[f].Scale(angles[corner(f)]))
+		}
+		for _, f := range faces {
+			k := corner(f)
+			if faceNormals[f] == nil {
+				normalIndices[k] = -1
+				continue
+			}
+			sum := sums[find(f)]
+			if sum.Norm() == 0 {
+				sum = faceNormals[f]
+			}
+			normalIndices[k] = m.addNormal(normals, sum.Normalize())
+		}
+	}
+	m.NormalIndices = normalIndices
+}
@@ -0,0 +1,129 @@
+package graphics
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// quadCube is the cube from -1 to 1 as six quads wound to face out.
+func quadCube(mat Material) *PolyMesh {
+	p := &PolyMesh{Materials: []Material{mat}}
+	for i := 0; i < 8; i++ {
+		p.Positions = append(p.Positions, &Vector3{float64(i&1*2 - 1), float64(i>>1&1*2 - 1), float64(i>>2&1*2 - 1)})
+	}
+	for _, f := range [][]int{{0, 2, 3, 1}, {4, 5, 7, 6}, {0, 1, 5, 4}, {2, 6, 7, 3}, {0, 4, 6, 2}, {1, 3, 7, 5}} {
+		p.Faces = append(p.Faces, &PolyFace{f, []int{-1, -1, -1, -1}, []int{-1, -1, -1, -1}, 0})
+	}
+	return p
+}
+
+func TestMesh_Loop(t *testing.T) {
+	ico := NewMesh(Icosphere(0, &SolidMaterial{}))
+	smooth := ico.Loop(3, nil)
+	if want := 20 * 64; smooth.NumFaces() != want {
+		t.Errorf("subdivided icosahedron has %d faces, want %d", smooth.NumFaces(), want)
+	}
+	for e, faces := range smooth.EdgeFaces() {
+		if len(faces) != 2 {
+			t.Fatalf("edge %v has faces %v, want two", e, faces)
+		}
+	}
+	for _, tri := range smooth.Triangles() {
+		for _, v := range [][2]*Vector3{{tri.P0, tri.N0}, {tri.P1, tri.N1}, {tri.P2, tri.N2}} {
+			// Loop shrinks the icosahedron to about .7 across.
+			if r := v[0].Norm(); r > 1 || r < .65 {
+				t.Fatalf("point %v is %v from the center", v[0], r)
+			}
+			if v[1].Dot(v[0].Normalize()) < .98 {
+				t.Fatalf("normal %v at %v does not point out", v[1], v[0])
+			}
+		}
+	}
+
+	// With its edges creased, a cube stays a cube, flat on every side.
+	cube := NewMesh(Cube(&SolidMaterial{}))
+	sharp := cube.Loop(2, cube.SharpEdges(math.Pi/4))
+	if v := sharp.Volume(); math.Abs(v-8) > 1e-9 {
+		t.Errorf("creased cube has volume %v, want 8", v)
+	}
+	for _, tri := range sharp.Triangles() {
+		for _, n := range []*Vector3{tri.N0, tri.N1, tri.N2} {
+			if n.Dot(tri.Norm) < 1-1e-9 {
+				t.Fatalf("normal %v on a face facing %v", n, tri.Norm)
+			}
+		}
+	}
+}
+
+func TestPolyMesh_CatmullClark(t *testing.T) {
+	cube := quadCube(&SolidMaterial{})
+	smooth := cube.CatmullClark(3, nil)
+	if want := 6 * 64 * 2; smooth.NumFaces() != want {
+		t.Errorf("subdivided cube has %d triangles, want %d", smooth.NumFaces(), want)
+	}
+	for e, faces := range smooth.EdgeFaces() {
+		if len(faces) != 2 {
+			t.Fatalf("edge %v has faces %v, want two", e, faces)
+		}
+	}
+	// The points of a cube shrink to about .85 from its center.
+	for _, p := range smooth.Positions {
+		if r := p.Norm(); r > .9 || r < .8 {
+			t.Fatalf("point %v is %v from the center", p, r)
+		}
+	}
+	sharp := cube.CatmullClark(2, cube.Triangulate().SharpEdges(math.Pi/4))
+	if v := sharp.Volume(); math.Abs(v-8) > 1e-9 {
+		t.Errorf("creased cube has volume %v, want 8", v)
+	}
+}
+
+func TestOpenObjPolyMesh(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "quad.obj")
+	obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nvt 1 0\nvt 1 1\nvt 0 1\nf 1/1 2/2 3/3 4/4\n"
+	if err := os.WriteFile(name, []byte(obj), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := OpenObjPolyMesh(name, White)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Faces) != 1 || len(p.Faces[0].Indices) != 4 {
+		t.Fatalf("read faces %v, want one quad", p.Faces)
+	}
+	m := p.Subdivide(1, nil)
+	if m.NumFaces() != 8 {
+		t.Errorf("subdivided quad has %d triangles, want 8", m.NumFaces())
+	}
+	for _, tri := range m.Triangles() {
+		for _, v := range [][2]interface{}{{tri.P0, tri.UV0}, {tri.P1, tri.UV1}, {tri.P2, tri.UV2}} {
+			p, uv := v[0].(*Vector3), v[1].(*Vector2)
+			if math.Abs(p.X-uv.X) > 1e-9 || math.Abs(p.Y-(1-uv.Y)) > 1e-9 {
+				t.Fatalf("point %v has texture coordinates %v", p, uv)
+			}
+		}
+	}
+
+	// Negative indices count back from the last of each read so far.
+	obj = "v 5 5 5\nv 0 0 0\nv 1 0 0\nv 1 1 0\nvn 0 0 1\nf -3//-1 -2//-1 -1//-1\nv 9 9 9\n"
+	if err := os.WriteFile(name, []byte(obj), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = OpenObjPolyMesh(name, White); err != nil {
+		t.Fatal(err)
+	}
+	if f := p.Faces[0]; f.Indices[0] != 1 || f.Indices[1] != 2 || f.Indices[2] != 3 || f.NormalIndices[0] != 0 || f.UVIndices[0] != -1 {
+		t.Errorf("relative face is %v, %v, %v, want 1, 2, 3 with normal 0", f.Indices, f.NormalIndices, f.UVIndices)
+	}
+	for _, face := range []string{"f 0 1 2", "f 1 2 5", "f -5 1 2", "f 1/3 2/1 3/1", "f 1//2 2//1 3//1", "f 1 x 2"} {
+		obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nvn 0 0 1\n" + face + "\n"
+		if err := os.WriteFile(name, []byte(obj), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenObjPolyMesh(name, White); err == nil {
+			t.Errorf("read %q without error", face)
+		}
+	}
+}
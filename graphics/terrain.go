@@ -0,0 +1,193 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// Heightfield is a grid of heights, Width samples across and Depth deep,
+// stored row by row.
+type Heightfield struct {
+	Width   int
+	Depth   int
+	Heights []float64
+}
+
+// NewHeightfield returns a flat heightfield of width by depth samples.
+func NewHeightfield(width, depth int) *Heightfield {
+	return &Heightfield{width, depth, make([]float64, width*depth)}
+}
+
+// At returns the height at column i of row j, clamped to the edges.
+func (h *Heightfield) At(i, j int) float64 {
+	i = mini(maxi(i, 0), h.Width-1)
+	j = mini(maxi(j, 0), h.Depth-1)
+	return h.Heights[j*h.Width+i]
+}
+
+// Set sets the height at column i of row j.
+func (h *Heightfield) Set(i, j int, height float64) {
+	h.Heights[j*h.Width+i] = height
+}
+
+// Normalize stretches the heights of h to run from 0 to 1.
+func (h *Heightfield) Normalize() {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range h.Heights {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	for k, v := range h.Heights {
+		if hi > lo {
+			h.Heights[k] = (v - lo) / (hi - lo)
+		} else {
+			h.Heights[k] = 0
+		}
+	}
+}
+
+// ImageHeightfield reads the brightness of every pixel of im as a height,
+// from 0 for black to 1 for white. Sixteen bit images keep their precision.
+func ImageHeightfield(im image.Image) *Heightfield {
+	b := im.Bounds()
+	h := NewHeightfield(b.Dx(), b.Dy())
+	for j := 0; j < h.Depth; j++ {
+		for i := 0; i < h.Width; i++ {
+			g := color.Gray16Model.Convert(im.At(b.Min.X+i, b.Min.Y+j)).(color.Gray16)
+			h.Set(i, j, float64(g.Y)/0xffff)
+		}
+	}
+	return h
+}
+
+// DiamondSquare returns a fractal heightfield of 2^n+1 by 2^n+1 samples made
+// by the diamond-square algorithm, normalized to 0..1. Each halving of the
+// grid scales the random offsets by roughness, so .5 gives natural looking
+// hills, less smoother ones and more jagged ones. The same seed always
+// gives the same terrain.
+func DiamondSquare(n int, roughness float64, seed int64) *Heightfield {
+	size := 1<<uint(n) + 1
+	h := NewHeightfield(size, size)
+	r := rand.New(rand.NewSource(seed))
+	offset := func(amplitude float64) float64 {
+		return (2*r.Float64() - 1) * amplitude
+	}
+	for _, c := range [][2]int{{0, 0}, {size - 1, 0}, {0, size - 1}, {size - 1, size - 1}} {
+		h.Set(c[0], c[1], offset(1))
+	}
+	amplitude := roughness
+	for step := size - 1; step > 1; step /= 2 {
+		half := step / 2
+		// Diamonds: the center of every square is the mean of its corners.
+		for j := half; j < size; j += step {
+			for i := half; i < size; i += step {
+				mean := (h.At(i-half, j-half) + h.At(i+half, j-half) + h.At(i-half, j+half) + h.At(i+half, j+half)) / 4
+				h.Set(i, j, mean+offset(amplitude))
+			}
+		}
+		// Squares: the middle of every side is the mean of the points
+		// around it, of which there are three on the edges of the grid.
+		for j := 0; j < size; j += half {
+			for i := (j/half + 1) % 2 * half; i < size; i += step {
+				sum, count := 0.0, 0
+				for _, d := range [][2]int{{-half, 0}, {half, 0}, {0, -half}, {0, half}} {
+					if x, y := i+d[0], j+d[1]; x >= 0 && x < size && y >= 0 && y < size {
+						sum += h.At(x, y)
+						count++
+					}
+				}
+				h.Set(i, j, sum/float64(count)+offset(amplitude))
+			}
+		}
+		amplitude *= roughness
+	}
+	h.Normalize()
+	return h
+}
+
+// FBMHeightfield returns a heightfield of width by depth samples of f, which
+// sees each sample at its place on the terrain of Terrain, or at its texture
+// coordinates when f.UV is set.
+func FBMHeightfield(width, depth int, f *FBM) *Heightfield {
+	h := NewHeightfield(width, depth)
+	for j := 0; j < depth; j++ {
+		for i := 0; i < width; i++ {
+			x, z := h.place(i, j)
+			uv := &Vector2{float64(i) / float64(maxi(width-1, 1)), float64(j) / float64(maxi(depth-1, 1))}
+			h.Set(i, j, f.Value(&Surface{&Vector3{x, 0, z}, uv}))
+		}
+	}
+	return h
+}
+
+// place returns where Terrain puts column i of row j, on a grid from -1 to
+// 1 across X, its rows along Z the same distance apart and centered on the
+// origin.
+func (h *Heightfield) place(i, j int) (x, z float64) {
+	spacing := 2 / float64(maxi(h.Width-1, 1))
+	return spacing*float64(i) - 1, spacing * (float64(j) - float64(h.Depth-1)/2)
+}
+
+// Terrain returns the surface of h, its columns from -1 to 1 across X and
+// its rows along Z at the same spacing, each sample height times its height
+// above the origin. Its normals are those of the smooth surface through the
+// samples and its texture coordinates stretch the texture over the whole
+// of it. A positive skirt hangs walls that far below the lowest point
+// around the edges, which hide the cracks between neighboring tiles of
+// terrain with different detail. A heightfield less than two samples wide
+// or deep has no surface, and gives nil.
+func Terrain(h *Heightfield, height, skirt float64, mat Material) []*Triangle {
+	if h.Width < 2 || h.Depth < 2 {
+		return nil
+	}
+	spacing := 2 / float64(maxi(h.Width-1, 1))
+	point := func(i, j int) *Vector3 {
+		x, z := h.place(i, j)
+		return &Vector3{x, -height * h.At(i, j), z}
+	}
+	// The slopes are central differences, one-sided on the edges.
+	slope := func(i, j, di, dj int) float64 {
+		a, b := h.At(i-di, j-dj), h.At(i+di, j+dj)
+		steps := 2
+		if i-di < 0 || j-dj < 0 || i+di >= h.Width || j+dj >= h.Depth {
+			steps = 1
+		}
+		return height * (b - a) / (float64(steps) * spacing)
+	}
+	ret := gridSurface(h.Width-1, h.Depth-1, mat, func(i, j int) (*Vector3, *Vector3) {
+		return point(i, j), &Vector3{-slope(i, j, 1, 0), -1, -slope(i, j, 0, 1)}
+	})
+
+	if skirt > 0 {
+		bottom := math.Inf(-1)
+		for _, v := range h.Heights {
+			bottom = math.Max(bottom, -height*v)
+		}
+		bottom += skirt
+		// The walls run around the terrain in the order that winds their
+		// faces outward.
+		walls := []struct {
+			n      *Vector3
+			length int
+			at     func(k int) (i, j int)
+		}{
+			{&Vector3{0, 0, 1}, h.Width, func(k int) (int, int) { return k, h.Depth - 1 }},
+			{&Vector3{1, 0, 0}, h.Depth, func(k int) (int, int) { return h.Width - 1, h.Depth - 1 - k }},
+			{&Vector3{0, 0, -1}, h.Width, func(k int) (int, int) { return h.Width - 1 - k, 0 }},
+			{&Vector3{-1, 0, 0}, h.Depth, func(k int) (int, int) { return 0, k }},
+		}
+		for _, w := range walls {
+			w := w
+			ret = append(ret, gridSurface(w.length-1, 1, mat, func(k, down int) (*Vector3, *Vector3) {
+				p := point(w.at(k))
+				if down == 1 {
+					p = &Vector3{p.X, bottom, p.Z}
+				}
+				return p, w.n
+			})...)
+		}
+	}
+	ComputeTangents(ret)
+	return ret
+}
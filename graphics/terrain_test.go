@@ -0,0 +1,92 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestTerrain(t *testing.T) {
+	// A ramp rising along X, 2/5 as deep as it is wide.
+	im := image.NewGray(image.Rect(0, 0, 6, 3))
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 6; i++ {
+			im.SetGray(i, j, color.Gray{uint8(i * 51)})
+		}
+	}
+	h := ImageHeightfield(im)
+	if h.Width != 6 || h.Depth != 3 || h.At(5, 1) != 1 || h.At(-1, 5) != 0 {
+		t.Fatalf("heightfield of %d by %d with corners %v and %v", h.Width, h.Depth, h.At(0, 0), h.At(5, 2))
+	}
+	tris := Terrain(h, 2, 0, &SolidMaterial{})
+	if len(tris) != 2*5*2 {
+		t.Errorf("got %d triangles, want %d", len(tris), 2*5*2)
+	}
+	slope := (&Vector3{-1, -1, 0}).Normalize()
+	for _, tri := range tris {
+		for _, n := range []*Vector3{tri.N0, tri.N1, tri.N2, tri.Norm} {
+			if n.Sub(slope).Norm() > 1e-9 {
+				t.Fatalf("normal %v on the ramp, want %v", n, slope)
+			}
+		}
+		for _, c := range []struct {
+			p  *Vector3
+			uv *Vector2
+		}{{tri.P0, tri.UV0}, {tri.P1, tri.UV1}, {tri.P2, tri.UV2}} {
+			if math.Abs(c.p.X-(2*c.uv.X-1)) > 1e-9 || math.Abs(c.p.Z-(c.uv.Y-.5)*.8) > 1e-9 || math.Abs(c.p.Y+c.p.X+1) > 1e-9 {
+				t.Fatalf("point %v at %v", c.p, c.uv)
+			}
+		}
+	}
+
+	// With skirts only the bottom edges of the walls are open.
+	skirted := Terrain(DiamondSquare(3, .5, 1), 1, .5, &SolidMaterial{})
+	for _, tri := range skirted[2*8*8:] {
+		if c := tri.Centroid(); tri.Norm.Y != 0 || tri.Norm.Dot(&Vector3{c.X, 0, c.Z}) <= 0 {
+			t.Fatalf("wall at %v faces %v", c, tri.Norm)
+		}
+	}
+	mesh := NewMesh(skirted)
+	mesh.Weld(1e-9)
+	edges := mesh.BoundaryEdges()
+	if len(edges) != 4*8 {
+		t.Errorf("skirted terrain has %d open edges, want %d", len(edges), 4*8)
+	}
+	for _, e := range edges {
+		if a, b := mesh.Positions[e[0]], mesh.Positions[e[1]]; a.Y != b.Y || a.Y < .5 {
+			t.Fatalf("open edge from %v to %v is not along the bottom", a, b)
+		}
+	}
+	for _, h := range []*Heightfield{ImageHeightfield(image.NewGray(image.Rect(0, 0, 0, 0))), NewHeightfield(1, 5), NewHeightfield(5, 1)} {
+		if tris := Terrain(h, 1, .5, &SolidMaterial{}); tris != nil {
+			t.Errorf("%d by %d heightfield has %d triangles, want none", h.Width, h.Depth, len(tris))
+		}
+	}
+}
+
+func TestDiamondSquare(t *testing.T) {
+	a, b, c := DiamondSquare(5, .5, 1), DiamondSquare(5, .5, 1), DiamondSquare(5, .5, 2)
+	if a.Width != 33 || a.Depth != 33 {
+		t.Fatalf("got %d by %d, want 33 by 33", a.Width, a.Depth)
+	}
+	lo, hi, same := 1.0, 0.0, true
+	for k, v := range a.Heights {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+		if v != b.Heights[k] {
+			t.Fatalf("the same seed gave %v and %v", v, b.Heights[k])
+		}
+		same = same && v == c.Heights[k]
+	}
+	if lo != 0 || hi != 1 || same {
+		t.Errorf("heights from %v to %v, the same for another seed: %v", lo, hi, same)
+	}
+	f := FBMHeightfield(16, 8, &FBM{Scale: 3, Octaves: 4})
+	lo, hi = 1, 0
+	for _, v := range f.Heights {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	if lo < 0 || hi > 1 || hi-lo < .1 {
+		t.Errorf("fBm heights from %v to %v", lo, hi)
+	}
+}
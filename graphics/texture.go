@@ -0,0 +1,383 @@
+package graphics
+
+import (
+	"image"
+	"math"
+)
+
+// TextureFilter picks how a Texture is sampled over the footprint of a pixel.
+type TextureFilter int
+
+const (
+	// FilterBilinear reads the full resolution level only.
+	FilterBilinear TextureFilter = iota
+	// FilterTrilinear blends the two mip levels closest to the footprint.
+	FilterTrilinear
+	// FilterAnisotropic takes several trilinear samples along the long axis
+	// of the footprint.
+	FilterAnisotropic
+)
+
+// WrapMode picks what a Texture shows outside of texture coordinates 0..1.
+type WrapMode int
+
+const (
+	WrapRepeat WrapMode = iota
+	// WrapMirror repeats the texture, flipping every other copy.
+	WrapMirror
+	// WrapClamp stretches the edge texels outwards.
+	WrapClamp
+)
+
+// wrap folds texel index i into 0..n-1.
+func (w WrapMode) wrap(i, n int) int {
+	switch w {
+	case WrapMirror:
+		i = ((i % (2 * n)) + 2*n) % (2 * n)
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+		return i
+	case WrapClamp:
+		return mini(maxi(i, 0), n-1)
+	}
+	return ((i % n) + n) % n
+}
+
+// filter bilinearly samples the w by h block of texels at (x0, y0) as if it
+// were the whole image, at continuous texel coordinates x, y relative to the
+// block and wrapping with s and t.
+func (f *floatImage) filter(x, y float64, s, t WrapMode, x0, y0, w, h int) *Color {
+	x -= .5
+	y -= .5
+	fx := x - math.Floor(x)
+	fy := y - math.Floor(y)
+	at := func(i, j int) *Color {
+		return f.Pix[(y0+t.wrap(j, h))*f.Width+x0+s.wrap(i, w)]
+	}
+	i, j := int(math.Floor(x)), int(math.Floor(y))
+	top := ColorAdd(ColorScale(at(i, j), 1-fx), ColorScale(at(i+1, j), fx))
+	bottom := ColorAdd(ColorScale(at(i, j+1), 1-fx), ColorScale(at(i+1, j+1), fx))
+	return ColorAdd(ColorScale(top, 1-fy), ColorScale(bottom, fy))
+}
+
+// Texture is an image with a precomputed mip pyramid. Levels[0] is the full
+// resolution image and every following level halves it, down to 1x1. WrapS
+// and WrapT wrap the horizontal and vertical texture coordinates.
+type Texture struct {
+	Levels        []*floatImage
+	Filter        TextureFilter
+	MaxAnisotropy int
+	WrapS         WrapMode
+	WrapT         WrapMode
+}
+
+func NewTexture(im image.Image) *Texture {
+	level := newFloatImage(im)
+	t := &Texture{
+		Levels:        []*floatImage{level},
+		Filter:        FilterTrilinear,
+		MaxAnisotropy: 8,
+	}
+	for level.Width > 1 || level.Height > 1 {
+		level = level.downsample()
+		t.Levels = append(t.Levels, level)
+	}
+	return t
+}
+
+// downsample box filters the image to half its size, rounding down. The last
+// row or column of an odd sized image is folded into its neighbour.
+func (f *floatImage) downsample() *floatImage {
+	res := &floatImage{
+		Width:  maxi(f.Width/2, 1),
+		Height: maxi(f.Height/2, 1),
+	}
+	res.Pix = make([]*Color, res.Width*res.Height)
+	for j := 0; j < res.Height; j++ {
+		y0, y1 := mini(2*j, f.Height-1), mini(2*j+1, f.Height-1)
+		if j == res.Height-1 {
+			y1 = f.Height - 1
+		}
+		for i := 0; i < res.Width; i++ {
+			x0, x1 := mini(2*i, f.Width-1), mini(2*i+1, f.Width-1)
+			if i == res.Width-1 {
+				x1 = f.Width - 1
+			}
+			c := &Color{}
+			n := 0.0
+			for y := y0; y <= y1; y++ {
+				for x := x0; x <= x1; x++ {
+					c = ColorAdd(c, f.Pix[y*f.Width+x])
+					n++
+				}
+			}
+			res.Pix[j*res.Width+i] = ColorScale(c, 1/n)
+		}
+	}
+	return res
+}
+
+func (t *Texture) Width() int {
+	return t.Levels[0].Width
+}
+
+func (t *Texture) Height() int {
+	return t.Levels[0].Height
+}
+
+// At bilinearly samples the full resolution level at texture coordinates st,
+// where (0, 0) is the top left corner of the image and (1, 1) the bottom
+// right.
+func (t *Texture) At(st *Vector2) *Color {
+	return t.level(0, nil, st)
+}
+
+// level samples mip level l, treating the texels covered by r as the whole
+// texture so that wrapping and filtering stay inside it.
+func (t *Texture) level(l int, r *TextureRegion, st *Vector2) *Color {
+	im := t.Levels[l]
+	x0, y0, x1, y1 := 0, 0, im.Width, im.Height
+	if r != nil {
+		x0 = mini(maxi(int(math.Floor(r.Min.X*float64(im.Width))), 0), im.Width-1)
+		y0 = mini(maxi(int(math.Floor(r.Min.Y*float64(im.Height))), 0), im.Height-1)
+		x1 = mini(maxi(int(math.Ceil(r.Max.X*float64(im.Width))), x0+1), im.Width)
+		y1 = mini(maxi(int(math.Ceil(r.Max.Y*float64(im.Height))), y0+1), im.Height)
+	}
+	w, h := x1-x0, y1-y0
+	return im.filter(st.X*float64(w), st.Y*float64(h), t.WrapS, t.WrapT, x0, y0, w, h)
+}
+
+// trilinear blends the mip levels on either side of lod.
+func (t *Texture) trilinear(lod float64, r *TextureRegion, st *Vector2) *Color {
+	lod = math.Min(math.Max(lod, 0), float64(len(t.Levels)-1))
+	l := int(lod)
+	frac := lod - float64(l)
+	if frac == 0 {
+		return t.level(l, r, st)
+	}
+	return ColorAdd(ColorScale(t.level(l, r, st), 1-frac), ColorScale(t.level(l+1, r, st), frac))
+}
+
+// Sample filters the texture around st. dx and dy are the change in texture
+// coordinates to the neighbouring pixels in x and y; when either is nil the
+// full resolution level is read.
+func (t *Texture) Sample(st, dx, dy *Vector2) *Color {
+	return t.SampleRegion(nil, st, dx, dy)
+}
+
+// SampleRegion is Sample on the part r of an atlas, with st, dx and dy
+// relative to r. A nil r is the whole texture.
+func (t *Texture) SampleRegion(r *TextureRegion, st, dx, dy *Vector2) *Color {
+	if dx == nil || dy == nil || t.Filter == FilterBilinear {
+		return t.level(0, r, st)
+	}
+	w, h := float64(t.Width()), float64(t.Height())
+	if r != nil {
+		w *= r.Max.X - r.Min.X
+		h *= r.Max.Y - r.Min.Y
+	}
+	lx := math.Hypot(dx.X*w, dx.Y*h)
+	ly := math.Hypot(dy.X*w, dy.Y*h)
+	major, minor, axis := lx, ly, dx
+	if ly > lx {
+		major, minor, axis = ly, lx, dy
+	}
+	if t.Filter == FilterTrilinear || major <= 1 {
+		return t.trilinear(math.Log2(major), r, st)
+	}
+
+	n := t.MaxAnisotropy
+	if minor > 0 {
+		n = mini(int(math.Ceil(major/minor)), n)
+	}
+	n = maxi(n, 1)
+	lod := math.Log2(major / float64(n))
+	c := &Color{}
+	for k := 0; k < n; k++ {
+		offset := (float64(k)+.5)/float64(n) - .5
+		c = ColorAdd(c, t.trilinear(lod, r, st.Add(axis.Scale(offset))))
+	}
+	return ColorScale(c, 1/float64(n))
+}
+
+// TextureRegion is the rectangle of an atlas texture between Min and Max, in
+// texture coordinates, that is used as a texture of its own.
+type TextureRegion struct {
+	Min *Vector2
+	Max *Vector2
+}
+
+// GridRegion is cell index, counted row by row, of an atlas laid out as a
+// grid of cols by rows equally sized cells.
+func GridRegion(cols, rows, index int) *TextureRegion {
+	x, y := float64(index%cols), float64(index/cols)
+	return &TextureRegion{
+		Min: &Vector2{x / float64(cols), y / float64(rows)},
+		Max: &Vector2{(x + 1) / float64(cols), (y + 1) / float64(rows)},
+	}
+}
+
+// UVTransform moves texture coordinates before the lookup: they are scaled,
+// rotated by Rotation radians about the origin, then offset. Nil Offset and
+// Scale leave the coordinates alone.
+type UVTransform struct {
+	Offset   *Vector2
+	Scale    *Vector2
+	Rotation float64
+}
+
+// Apply transforms the texture coordinates st.
+func (u *UVTransform) Apply(st *Vector2) *Vector2 {
+	st = u.linear(st)
+	if u.Offset != nil {
+		st = st.Add(u.Offset)
+	}
+	return st
+}
+
+// linear is Apply without the offset, which is how derivatives transform.
+func (u *UVTransform) linear(d *Vector2) *Vector2 {
+	if u.Scale != nil {
+		d = &Vector2{d.X * u.Scale.X, d.Y * u.Scale.Y}
+	}
+	sin, cos := math.Sincos(u.Rotation)
+	return &Vector2{cos*d.X - sin*d.Y, sin*d.X + cos*d.Y}
+}
+
+// Filterer is implemented by materials whose color can be filtered over the
+// footprint of a pixel. dx and dy are the change in the barycentric uv to the
+// neighbouring pixels in x and y.
+type Filterer interface {
+	CFiltered(uv, dx, dy *Vector2) *Color
+}
+
+// UVMaterial is implemented by materials that can be shared between
+// triangles because they read their texture coordinates st from the
+// triangle's UV0, UV1 and UV2. dx and dy are the change in st to the
+// neighbouring pixels in x and y, nil when unknown.
+type UVMaterial interface {
+	CAt(st, dx, dy *Vector2) *Color
+}
+
+// fragment binds a material to the triangle and pixel footprint being shaded
+// so that a Filterer, UVMaterial or SurfaceMaterial can be shaded through the
+// plain Material interface. origin is added to positions on tri to bring them
+// back to scene coordinates, for triangles without rest positions.
+type fragment struct {
+	Material
+	tri    *Triangle
+	origin *Vector3
+	dx     *Vector2
+	dy     *Vector2
+}
+
+func (f *fragment) C(uv *Vector2) *Color {
+	if m, ok := f.Material.(SurfaceMaterial); ok {
+		w := 1 - uv.X - uv.Y
+		s := &Surface{
+			P: f.origin.Add(f.tri.P0.Scale(uv.X)).Add(f.tri.P1.Scale(uv.Y)).Add(f.tri.P2.Scale(w)),
+		}
+		if t := f.tri; t.Rest0 != nil {
+			s.P = t.Rest0.Scale(uv.X).Add(t.Rest1.Scale(uv.Y)).Add(t.Rest2.Scale(w))
+		}
+		if f.tri.UV0 != nil {
+			s.UV = f.tri.TexCoord(uv)
+		}
+		return m.CSurface(s)
+	}
+	if m, ok := f.Material.(UVMaterial); ok && f.tri.UV0 != nil {
+		var dx, dy *Vector2
+		if f.dx != nil && f.dy != nil {
+			dx, dy = f.tri.texCoordDelta(f.dx), f.tri.texCoordDelta(f.dy)
+		}
+		return m.CAt(f.tri.TexCoord(uv), dx, dy)
+	}
+	if m, ok := f.Material.(Filterer); ok && f.dx != nil && f.dy != nil {
+		return m.CFiltered(uv, f.dx, f.dy)
+	}
+	return f.Material.C(uv)
+}
+
+func (f *fragment) Emission(uv *Vector2) *Color {
+	if e, ok := f.Material.(Emitter); ok {
+		return e.Emission(uv)
+	}
+	return nil
+}
+
+// needsFootprint reports whether m makes use of the derivatives bind takes.
+func needsFootprint(m Material) bool {
+	_, filters := m.(Filterer)
+	_, mapped := m.(UVMaterial)
+	return filters || mapped
+}
+
+// bind returns m bound to tri, the origin of its coordinates and the
+// barycentric derivatives dx and dy, which may be nil, or m itself when it
+// would not use them.
+func bind(m Material, tri *Triangle, origin *Vector3, dx, dy *Vector2) Material {
+	_, mapped := m.(UVMaterial)
+	_, filters := m.(Filterer)
+	_, surface := m.(SurfaceMaterial)
+	if !surface && !(mapped && tri.UV0 != nil) && !(filters && dx != nil && dy != nil) {
+		return m
+	}
+	return &fragment{m, tri, origin, dx, dy}
+}
+
+// linearBary is Bary without the absolute values, so that it extends
+// linearly to points of the triangle's plane outside of it.
+func (t *Triangle) linearBary(p *Vector3) (float64, float64, float64) {
+	n := Cross(t.P1.Sub(t.P0), t.P2.Sub(t.P0))
+	nn := n.Dot(n)
+	u := Cross(t.P2.Sub(t.P1), p.Sub(t.P1)).Dot(n) / nn
+	v := Cross(t.P0.Sub(t.P2), p.Sub(t.P2)).Dot(n) / nn
+	return u, v, 1 - u - v
+}
+
+// screenFootprint is the change in barycentric uv of tri between the screen
+// point (x, y) and its neighbours (x+dx, y) and (x, y+dy).
+func screenFootprint(tri *Triangle, x, y, dx, dy float64) (*Vector2, *Vector2) {
+	u, v, _ := tri.linearBary(tri.DePerp(&Vector2{x, y}))
+	ux, vx, _ := tri.linearBary(tri.DePerp(&Vector2{x + dx, y}))
+	uy, vy, _ := tri.linearBary(tri.DePerp(&Vector2{x, y + dy}))
+	return &Vector2{ux - u, vx - v}, &Vector2{uy - u, vy - v}
+}
+
+// rayDiff is the ray differential of Igehy: how the origin and direction of
+// a ray change to the rays of the neighbouring pixels in x and y.
+type rayDiff struct {
+	Px, Py *Vector3
+	Dx, Dy *Vector3
+}
+
+// transfer moves the differentials of the ray dir, leaving the origin, to
+// its hit p on tri and returns the change of barycentric uv there.
+func (r *rayDiff) transfer(tri *Triangle, dir, p *Vector3) (*Vector3, *Vector3, *Vector2, *Vector2) {
+	n := tri.Norm
+	t := p.Norm() / dir.Norm()
+	dn := dir.Dot(n)
+	hit := func(dp, dd *Vector3) *Vector3 {
+		d := dp.Add(dd.Scale(t))
+		return d.Sub(dir.Scale(d.Dot(n) / dn))
+	}
+	hx, hy := hit(r.Px, r.Dx), hit(r.Py, r.Dy)
+	u, v, _ := tri.linearBary(p)
+	ux, vx, _ := tri.linearBary(p.Add(hx))
+	uy, vy, _ := tri.linearBary(p.Add(hy))
+	return hx, hy, &Vector2{ux - u, vx - v}, &Vector2{uy - u, vy - v}
+}
+
+// reflect returns the differentials of the mirror reflection about normal of
+// dir at a hit whose position differentials are hx and hy. The reflected
+// direction is normalized, so are its differentials.
+func (r *rayDiff) reflect(dir, normal, hx, hy *Vector3) *rayDiff {
+	d := dir.Normalize()
+	l := dir.Norm()
+	mirror := func(dd *Vector3) *Vector3 {
+		dd = dd.Sub(d.Scale(d.Dot(dd))).Scale(1 / l)
+		return dd.Sub(normal.Scale(2 * dd.Dot(normal)))
+	}
+	return &rayDiff{hx, hy, mirror(r.Dx), mirror(r.Dy)}
+}
@@ -0,0 +1,146 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func checkerboard(size, square int) *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, size, size))
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			if (i/square+j/square)%2 == 0 {
+				im.Set(i, j, color.White)
+			} else {
+				im.Set(i, j, color.Black)
+			}
+		}
+	}
+	return im
+}
+
+func TestNewTexture(t *testing.T) {
+	tex := NewTexture(image.NewRGBA(image.Rect(0, 0, 5, 3)))
+	sizes := [][2]int{{5, 3}, {2, 1}, {1, 1}}
+	if len(tex.Levels) != len(sizes) {
+		t.Fatalf("%d levels, want %d", len(tex.Levels), len(sizes))
+	}
+	for i, s := range sizes {
+		if tex.Levels[i].Width != s[0] || tex.Levels[i].Height != s[1] {
+			t.Errorf("level %d is %dx%d, want %dx%d", i, tex.Levels[i].Width, tex.Levels[i].Height, s[0], s[1])
+		}
+	}
+
+	tex = NewTexture(checkerboard(64, 1))
+	if c := tex.Levels[len(tex.Levels)-1].Pix[0]; math.Abs(c.R-127.5) > 1e-9 {
+		t.Errorf("top of the pyramid is %v, want the average gray", c)
+	}
+}
+
+func TestTexture_Sample(t *testing.T) {
+	tex := NewTexture(checkerboard(64, 1))
+	st := &Vector2{.5 + .25/64, .5 + .25/64}
+	if c := tex.Sample(st, nil, nil); c.R > 100 && c.R < 155 {
+		t.Errorf("unfiltered sample is %v, want close to black or white", c)
+	}
+	for _, filter := range []TextureFilter{FilterTrilinear, FilterAnisotropic} {
+		tex.Filter = filter
+		c := tex.Sample(st, &Vector2{8.0 / 64, 0}, &Vector2{0, 2.0 / 64})
+		if math.Abs(c.R-127.5) > 5 {
+			t.Errorf("filter %d over a large footprint gives %v, want gray", filter, c)
+		}
+	}
+
+	// A footprint stretched along horizontal stripes stays within one stripe
+	// when filtered anisotropically, but blurs across them otherwise.
+	stripes := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for j := 0; j < 64; j++ {
+		for i := 0; i < 64; i++ {
+			if j/4%2 == 0 {
+				stripes.Set(i, j, color.White)
+			}
+		}
+	}
+	tex = NewTexture(stripes)
+	st = &Vector2{.5, 2.0 / 64}
+	dx, dy := &Vector2{16.0 / 64, 0}, &Vector2{0, .5 / 64}
+	tex.Filter = FilterAnisotropic
+	if c := tex.Sample(st, dx, dy); c.R < 250 {
+		t.Errorf("anisotropic sample inside a white stripe is %v", c)
+	}
+	tex.Filter = FilterTrilinear
+	if c := tex.Sample(st, dx, dy); c.R > 200 {
+		t.Errorf("trilinear sample of a long footprint is %v, want it blurred", c)
+	}
+}
+
+func TestRayDiff(t *testing.T) {
+	tri := NewTriangle(&Vector3{-1, -1, 3}, &Vector3{1, -1, 2}, &Vector3{0, 1, 4}, nil)
+	x, y, d := .05, -.1, .01
+	dx, dy := screenFootprint(tri, x, y, d, d)
+
+	dir := (&Vector2{x, y}).Hom()
+	diff := &rayDiff{zero, zero, &Vector3{d, 0, 0}, &Vector3{0, d, 0}}
+	_, _, du, dv := diff.transfer(tri, dir, tri.DePerp(&Vector2{x, y}))
+	for _, p := range [][2]*Vector2{{dx, du}, {dy, dv}} {
+		if math.Abs(p[0].X-p[1].X) > 1e-3 || math.Abs(p[0].Y-p[1].Y) > 1e-3 {
+			t.Errorf("ray differential footprint %v, want %v from the rasterizer", p[1], p[0])
+		}
+	}
+}
+
+func TestWrapMode(t *testing.T) {
+	cases := []struct {
+		mode WrapMode
+		want []int
+	}{
+		{WrapRepeat, []int{0, 1, 2, 0, 1, 2, 0}},
+		{WrapMirror, []int{2, 1, 0, 0, 1, 2, 2}},
+		{WrapClamp, []int{0, 0, 0, 0, 1, 2, 2}},
+	}
+	for _, c := range cases {
+		for k, want := range c.want {
+			if got := c.mode.wrap(k-3, 3); got != want {
+				t.Errorf("mode %d wraps %d to %d, want %d", c.mode, k-3, got, want)
+			}
+		}
+	}
+}
+
+func TestTexture_SampleRegion(t *testing.T) {
+	// A 2x1 atlas of a red and a green cell.
+	im := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 8; i++ {
+			if i < 4 {
+				im.Set(i, j, color.RGBA{255, 0, 0, 255})
+			} else {
+				im.Set(i, j, color.RGBA{0, 255, 0, 255})
+			}
+		}
+	}
+	tex := NewTexture(im)
+	red := GridRegion(2, 1, 0)
+	for _, st := range []*Vector2{{0, 0}, {.99, .5}, {1.5, -.25}} {
+		if c := tex.SampleRegion(red, st, nil, nil); c.G != 0 || c.R != 255 {
+			t.Errorf("red cell at %v is %v", st, c)
+		}
+	}
+	if c := tex.Sample(&Vector2{.5, .5}, nil, nil); c.R != 127.5 || c.G != 127.5 {
+		t.Errorf("the middle of the atlas is %v, want red and green blended", c)
+	}
+}
+
+func TestUVTransform(t *testing.T) {
+	u := &UVTransform{
+		Offset:   &Vector2{1, 0},
+		Scale:    &Vector2{2, 3},
+		Rotation: math.Pi / 2,
+	}
+	got := u.Apply(&Vector2{1, 1})
+	if math.Abs(got.X+2) > 1e-9 || math.Abs(got.Y-2) > 1e-9 {
+		t.Errorf("Apply gives %v, want (-2, 2)", got)
+	}
+}
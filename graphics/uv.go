@@ -0,0 +1,104 @@
+package graphics
+
+import "math"
+
+// TexCoord interpolates the UVs of t at the barycentric uv.
+func (t *Triangle) TexCoord(uv *Vector2) *Vector2 {
+	w := 1 - uv.X - uv.Y
+	return t.UV0.Scale(uv.X).Add(t.UV1.Scale(uv.Y)).Add(t.UV2.Scale(w))
+}
+
+// texCoordDelta is how much the texture coordinates change for a change d in
+// the barycentric uv.
+func (t *Triangle) texCoordDelta(d *Vector2) *Vector2 {
+	return t.UV0.Scale(d.X).Add(t.UV1.Scale(d.Y)).Add(t.UV2.Scale(-d.X - d.Y))
+}
+
+// Tangent is the direction of increasing U across the face, not normalized,
+// or nil when the triangle has no UVs or they are degenerate.
+func (t *Triangle) Tangent() *Vector3 {
+	if t.UV0 == nil {
+		return nil
+	}
+	e1, e2 := t.P1.Sub(t.P0), t.P2.Sub(t.P0)
+	d1, d2 := t.UV1.Sub(t.UV0), t.UV2.Sub(t.UV0)
+	det := d1.X*d2.Y - d2.X*d1.Y
+	if det == 0 {
+		return nil
+	}
+	return e1.Scale(d2.Y).Sub(e2.Scale(d1.Y)).Scale(1 / det)
+}
+
+// TangentAt interpolates the vertex tangents at the barycentric uv, falling
+// back to the face tangent, and makes it perpendicular to normal.
+func (t *Triangle) TangentAt(uv *Vector2, normal *Vector3) *Vector3 {
+	tan := t.Tangent()
+	if t.Tan0 != nil {
+		tan = t.Tan0.Scale(uv.X).Add(t.Tan1.Scale(uv.Y)).Add(t.Tan2.Scale(1 - uv.X - uv.Y))
+	}
+	if tan == nil {
+		return nil
+	}
+	return tan.Sub(normal.Scale(normal.Dot(tan))).Normalize()
+}
+
+// tangentVertex identifies a vertex the way MikkTSpace does: corners that
+// agree in position, normal, texture coordinates and handedness share a
+// tangent.
+type tangentVertex struct {
+	P    Vector3
+	N    Vector3
+	UV   Vector2
+	Sign float64
+}
+
+// ComputeTangents sets the vertex tangents of every triangle with UVs, in the
+// manner of MikkTSpace: the face tangents around each vertex are weighted by
+// the angle of the corner, summed, and made perpendicular to the vertex
+// normal. The bitangent is rebuilt when shading as the cross product of
+// normal and tangent, flipped for mirrored texture coordinates.
+func ComputeTangents(t []*Triangle) {
+	key := func(tri *Triangle, k int) tangentVertex {
+		p := []*Vector3{tri.P0, tri.P1, tri.P2}[k]
+		n := []*Vector3{tri.N0, tri.N1, tri.N2}[k]
+		uv := []*Vector2{tri.UV0, tri.UV1, tri.UV2}[k]
+		return tangentVertex{*p, *n, *uv, tri.handedness()}
+	}
+	sums := map[tangentVertex]*Vector3{}
+	for _, tri := range t {
+		tan := tri.Tangent()
+		if tan == nil {
+			continue
+		}
+		tan = tan.Normalize()
+		p := []*Vector3{tri.P0, tri.P1, tri.P2}
+		for k := range p {
+			a, b := p[(k+1)%3].Sub(p[k]), p[(k+2)%3].Sub(p[k])
+			angle := math.Acos(math.Max(math.Min(a.Normalize().Dot(b.Normalize()), 1), -1))
+			v := key(tri, k)
+			if sum, ok := sums[v]; ok {
+				sums[v] = sum.Add(tan.Scale(angle))
+			} else {
+				sums[v] = tan.Scale(angle)
+			}
+		}
+	}
+	vertex := func(tri *Triangle, k int) *Vector3 {
+		n := []*Vector3{tri.N0, tri.N1, tri.N2}[k].Normalize()
+		tan := sums[key(tri, k)]
+		tan = tan.Sub(n.Scale(n.Dot(tan)))
+		if tan.Norm() < 1e-12 {
+			// Degenerate, as at a pole: any perpendicular will do.
+			tan, _ = orthoBasis(n)
+		}
+		return tan.Normalize()
+	}
+	for _, tri := range t {
+		if tri.Tangent() == nil {
+			continue
+		}
+		tri.Tan0 = vertex(tri, 0)
+		tri.Tan1 = vertex(tri, 1)
+		tri.Tan2 = vertex(tri, 2)
+	}
+}
@@ -0,0 +1,89 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func uvTriangle() *Triangle {
+	tri := NewTriangle(&Vector3{0, 0, 1}, &Vector3{2, 0, 1}, &Vector3{0, 3, 1}, nil)
+	tri.UV0 = &Vector2{0, 0}
+	tri.UV1 = &Vector2{1, 0}
+	tri.UV2 = &Vector2{0, 1}
+	return tri
+}
+
+func TestTriangle_TexCoord(t *testing.T) {
+	tri := uvTriangle()
+	st := tri.TexCoord(&Vector2{.25, .5})
+	if math.Abs(st.X-.5) > 1e-9 || math.Abs(st.Y-.25) > 1e-9 {
+		t.Errorf("TexCoord is %v, want (.5, .25)", st)
+	}
+	tan := tri.TangentAt(&Vector2{.25, .5}, &Vector3{0, 0, -1})
+	if math.Abs(tan.X-1) > 1e-9 || math.Abs(tan.Y) > 1e-9 {
+		t.Errorf("tangent is %v, want +X", tan)
+	}
+}
+
+func TestComputeTangents(t *testing.T) {
+	tex := NewTexture(image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	sphere := TextureSphere(10, tex)
+	for _, tri := range sphere {
+		for _, v := range [][2]*Vector3{{tri.Tan0, tri.N0}, {tri.Tan1, tri.N1}, {tri.Tan2, tri.N2}} {
+			if v[0] == nil {
+				t.Fatal("sphere triangle without tangents")
+			}
+			if math.Abs(v[0].Norm()-1) > 1e-9 || math.Abs(v[0].Dot(v[1].Normalize())) > 1e-9 {
+				t.Errorf("tangent %v is not a unit vector perpendicular to %v", v[0], v[1])
+			}
+		}
+	}
+	moved := ApplyTransform(sphere, Translate(1, 2, 3))
+	if moved[0].UV0 != sphere[0].UV0 || moved[0].Tan0 == nil {
+		t.Error("ApplyTransform drops UVs or tangents")
+	}
+}
+
+func TestSharedTextureMaterial(t *testing.T) {
+	im := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	im.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	im.Set(1, 0, color.RGBA{0, 0, 255, 255})
+	tex := NewTexture(im)
+	tex.WrapS = WrapClamp
+	m := &TextureMaterial{Texture: tex}
+
+	left, right := uvTriangle(), uvTriangle()
+	left.Material, right.Material = m, m
+	right.UV0, right.UV1, right.UV2 = &Vector2{1, 0}, &Vector2{1, 0}, &Vector2{1, 1}
+	if c := bind(m, left, zero, nil, nil).C(&Vector2{1, 0}); c.R != 255 || c.B != 0 {
+		t.Errorf("left triangle is %v, want red", c)
+	}
+	if c := bind(m, right, zero, nil, nil).C(&Vector2{1, 0}); c.B != 255 || c.R != 0 {
+		t.Errorf("right triangle is %v, want blue", c)
+	}
+}
+
+func TestOpenObj_TexCoords(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "quad.obj")
+	obj := "v 0 0 0\nv 1 0 0\nv 1 1 0\nvt 0 0\nvt 1 0\nvt 1 1\nvn 0 0 1\nf 1/1/1 2/2/1 3/3/1\nf 1//1 2//1 3//1\n"
+	if err := os.WriteFile(name, []byte(obj), 0644); err != nil {
+		t.Fatal(err)
+	}
+	triangles, err := OpenObj(name, White)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uv := triangles[0].UV2; uv == nil || uv.X != 1 || uv.Y != 0 {
+		t.Errorf("UV2 is %v, want (1, 0) with v flipped", uv)
+	}
+	if triangles[0].Tan0 == nil {
+		t.Error("textured triangle has no tangents")
+	}
+	if triangles[1].UV0 != nil {
+		t.Error("untextured face has UVs")
+	}
+}
@@ -14,8 +14,20 @@ import (
 	"strconv"
 )
 
-type helloHandler struct{ T []*graphics.Triangle }
-type otherHandler struct{ T []*graphics.Triangle }
+// model is the input file at every level of detail.
+type model struct {
+	lod    *graphics.LOD
+	levels [][]*graphics.Triangle
+}
+
+// at returns the triangles of m moved by transform, at the level of detail
+// for their size on screen.
+func (m *model) at(transform *graphics.Mat4) []*graphics.Triangle {
+	return graphics.ApplyTransform(m.levels[m.lod.Select(transform, *size)], transform)
+}
+
+type helloHandler struct{ M *model }
+type otherHandler struct{ M *model }
 
 var (
 	inputFile = flag.String("i", "in.obj", "Input file (png)")
@@ -27,6 +39,7 @@ var (
 	yr        = flag.Float64("yr", math.Pi, "Rotation in Y direction")
 	zr        = flag.Float64("zr", math.Pi, "Rotation in Z direction")
 	port      = flag.String("p", "8080", "port")
+	levels    = flag.Int("lod", 4, "number of levels of detail, each with half the triangles of the one before")
 )
 
 func parseForm(r *http.Request) (xrp, yrp, zrp, xtp, ytp, ztp float64) {
@@ -63,7 +76,7 @@ func parseForm(r *http.Request) (xrp, yrp, zrp, xtp, ytp, ztp float64) {
 func (h *helloHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("request")
 	xrp, yrp, zrp, xtp, ytp, ztp := parseForm(r)
-	t := graphics.ApplyTransform(h.T, graphics.Translate(*xt+xtp, *yt+ytp, *zt+ztp).
+	t := h.M.at(graphics.Translate(*xt+xtp, *yt+ytp, *zt+ztp).
 		Mult(graphics.RotZ(zrp)).
 		Mult(graphics.RotY(yrp)).
 		Mult(graphics.RotX(xrp)))
@@ -102,7 +115,7 @@ func (h *helloHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *otherHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("request")
 	xrp, yrp, zrp, xtp, ytp, ztp := parseForm(r)
-	t := graphics.ApplyTransform(h.T, graphics.Translate(*xt+xtp, *yt+ytp, *zt+ztp).
+	t := h.M.at(graphics.Translate(*xt+xtp, *yt+ytp, *zt+ztp).
 		Mult(graphics.RotZ(zrp)).
 		Mult(graphics.RotY(yrp)).
 		Mult(graphics.RotX(xrp)))
@@ -143,14 +156,21 @@ func (h *otherHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	flag.Parse()
-	fg := &color.RGBA{255, 255, 255, 255}
-	triangles, _ := graphics.OpenObj(*inputFile, fg)
+	fg := &graphics.Color{255, 255, 255, 255}
+	mesh, err := graphics.OpenObjMesh(*inputFile, fg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mesh.Weld(1e-6)
 	transform := graphics.RotZ(*zr).
 		Mult(graphics.RotY(*yr)).
 		Mult(graphics.RotX(*xr))
-	triangles = graphics.ApplyTransform(triangles, transform)
-	handler := &helloHandler{triangles}
-	http.Handle("/points", &otherHandler{triangles})
+	m := &model{lod: graphics.NewLOD(mesh.Transform(transform), *levels)}
+	for _, level := range m.lod.Levels {
+		m.levels = append(m.levels, level.Triangles())
+	}
+	handler := &helloHandler{m}
+	http.Handle("/points", &otherHandler{m})
 	http.Handle("/", handler)
 	fmt.Println("Listening on port " + *port)
 	fmt.Print(http.ListenAndServe(":"+*port, nil))
@@ -11,10 +11,11 @@ import (
 	"fmt"
 	"image/gif"
 	"image/jpeg"
+	"strings"
 )
 
 var (
-	outputFile = flag.String("o", "out.png", "Output File (png)")
+	outputFile = flag.String("o", "out.png", "Output File (png, or pfm, hdr or exr for linear output)")
 	inputFile  = flag.String("i", "in.obj", "Input file (png)")
 	imageFile  = flag.String("image", "earth.jpg", "Input file (png)")
 	size       = flag.Int("s", 2000, "Size of output image")
@@ -25,15 +26,109 @@ var (
 	yr         = flag.Float64("yr", math.Pi, "Rotation in Y direction")
 	zr         = flag.Float64("zr", math.Pi, "Rotation in Z direction")
 	shadow     = flag.Bool("h", false, "whether to draw shadows")
+	exact      = flag.Bool("hx", false, "whether to draw exact (slow) shadows instead of shadow maps")
+	shadowRes  = flag.Int("sr", 2048, "resolution of each shadow map")
+	pcf        = flag.Int("pcf", 1, "radius of the soft shadow filter in shadow map texels")
+	lightSize  = flag.Float64("lr", 0, "radius of the lights, non-zero for soft shadows from sphere lights")
+	lightRays  = flag.Int("ls", 16, "number of shadow rays per sphere light on the ray tracer")
+	envFile    = flag.String("env", "", "equirectangular environment map used for the background and lighting")
+	envLight   = flag.Float64("envi", 1, "intensity of the environment lighting")
+	cubeFiles  = flag.String("cube", "", "six cube map faces, +X, -X, +Y, -Y, +Z and -Z separated by commas, used instead of -env")
 	trace     = flag.Bool("t", false, "whether to raytrace")
 	bounces = flag.Int("b", 3, "number of bounces on the ray tracer")
 	circles = flag.Bool("circles", false, "draw alternate scene")
 	grey = flag.Bool("g", false, "use white lighting instead of colored")
 	parallel = flag.Int("p", 16, "number of parallel goroutines to use for rendering")
+	hdr = flag.Bool("hdr", false, "light in linear space and tone map the result to sRGB")
+	exposure = flag.Float64("exposure", 0, "exposure adjustment in stops for -hdr")
+	toneMapper = flag.String("tm", "aces", "tone mapper for -hdr: clamp, reinhard, aces or filmic")
+	filter = flag.String("filter", "trilinear", "texture filter: bilinear, trilinear or aniso")
+	aniso = flag.Int("aniso", 8, "maximum number of samples for -filter aniso")
+	tile = flag.Float64("tile", 0, "tile the texture this many times across the floor instead of a plain floor")
+	normalFile = flag.String("nmap", "", "tangent space normal map for the textured sphere")
+	bump = flag.Float64("bump", 0, "bump map the textured sphere with its own texture, this high")
+	floorStyle = flag.String("floor", "checker", "floor pattern: plain, checker, grid, marble, wood or cells")
+	analytic = flag.Bool("analytic", false, "with -t, trace the left shape of -circles as an exact sphere instead of triangles")
+	sdf = flag.Bool("sdf", false, "draw a signed distance field scene in place of the model, sphere traced with -t and polygonized otherwise")
+	cut = flag.Bool("cut", false, "cut the octant facing the camera out of the left shape of -circles")
+	crease = flag.Float64("crease", 0, "weld the model and smooth its normals, keeping edges sharper than this many degrees; 0 keeps the normals of the file")
+	terrain = flag.String("terrain", "", "draw terrain in place of the model, from an elevation image or made by diamond or fbm")
+	terrainHeight = flag.Float64("th", .4, "height of the highest point of -terrain, which is 4 wide")
+	lines = flag.String("lines", "", "with the rasterizer, draw these edges of the model over it, any of wire, silhouette, crease and boundary separated by commas")
+	lineWidth = flag.Float64("lw", 1.5, "width of -lines in pixels")
+	linesOnly = flag.Bool("lonly", false, "draw -lines on white instead of over the shaded model")
+	hiddenLines = flag.Bool("lhidden", false, "draw -lines hidden behind the model as well")
+	aov = flag.String("aov", "", "with the rasterizer, also write the depth, normal, UV, triangle, material and per light buffers to files starting with this")
+	fit = flag.Float64("fit", 0, "center the model on the origin and scale it to fit a cube this big before moving it; 0 leaves it as the file has it")
+	tolerance = flag.Float64("tol", .005, "how far the triangles of a .bpt input may stray from its patches")
+	subdiv = flag.Int("subdiv", 0, "subdivide the model this many times, by Catmull-Clark if it has faces other than triangles and by Loop otherwise, keeping edges sharper than -crease sharp")
+	shape = flag.String("shape", "sphere", "left shape of -circles: sphere, icosphere, cube, cylinder, cone, capsule or torus")
 )
 
+var filters = map[string]graphics.TextureFilter{
+	"bilinear":  graphics.FilterBilinear,
+	"trilinear": graphics.FilterTrilinear,
+	"aniso":     graphics.FilterAnisotropic,
+}
+
+var shapes = map[string]func(graphics.Material) []*graphics.Triangle{
+	"sphere":    func(m graphics.Material) []*graphics.Triangle { return graphics.SphereMat(50, m) },
+	"icosphere": func(m graphics.Material) []*graphics.Triangle { return graphics.Icosphere(3, m) },
+	"cube": func(m graphics.Material) []*graphics.Triangle {
+		return graphics.ApplyTransform(graphics.Cube(m), graphics.RotY(math.Pi/6).Mult(graphics.Scale(.7)))
+	},
+	"cylinder": func(m graphics.Material) []*graphics.Triangle { return graphics.Cylinder(50, m) },
+	"cone":     func(m graphics.Material) []*graphics.Triangle { return graphics.Cone(50, m) },
+	"capsule": func(m graphics.Material) []*graphics.Triangle {
+		return graphics.ApplyTransform(graphics.Capsule(.5, 1, 50, m), graphics.RotZ(math.Pi/4))
+	},
+	"torus": func(m graphics.Material) []*graphics.Triangle {
+		return graphics.ApplyTransform(graphics.Torus(.7, .3, 50, 25, m), graphics.RotX(-math.Pi/3))
+	},
+}
+
+var toneMappers = map[string]graphics.ToneMapper{
+	"clamp":    graphics.ClampToneMapper{},
+	"reinhard": graphics.ReinhardToneMapper{},
+	"aces":     graphics.ACESToneMapper{},
+	"filmic":   graphics.FilmicToneMapper{},
+}
+
 func main() {
 	flag.Parse()
+	if *envFile != "" && *cubeFiles != "" {
+		fmt.Println("-env and -cube are two skies, so only one can be used")
+		return
+	}
+	if (*envFile != "" || *cubeFiles != "") && (*shadow || *exact) && !*trace {
+		fmt.Println("-env and -cube light without shadows, so they cannot be used with -h or -hx")
+		return
+	}
+	if *linesOnly && *aov != "" {
+		fmt.Println("-lonly draws no surfaces, so it has no -aov buffers")
+		return
+	}
+	lineOpts := &graphics.LineOptions{
+		Width:      *lineWidth,
+		ShowHidden: *hiddenLines,
+	}
+	if *lines != "" {
+		for _, kind := range strings.Split(*lines, ",") {
+			switch kind {
+			case "wire":
+				lineOpts.Edges |= graphics.EdgesAll
+			case "silhouette":
+				lineOpts.Edges |= graphics.EdgesSilhouette
+			case "crease":
+				lineOpts.Edges |= graphics.EdgesCrease
+			case "boundary":
+				lineOpts.Edges |= graphics.EdgesBoundary
+			default:
+				fmt.Println("unknown kind of line", kind)
+				return
+			}
+		}
+	}
 
 	imfile, err := os.Open(*imageFile)
 	if err != nil {
@@ -71,6 +166,30 @@ func main() {
 	gc := &graphics.Color{253, 181, 21, 255}
 	bc := &graphics.Color{0,58,98,255}
 	bg := &graphics.Color{0, 0, 0, 255}
+	encoding := &graphics.Encoding{}
+	texFilter, ok := filters[*filter]
+	if !ok {
+		fmt.Println("unknown texture filter", *filter)
+		return
+	}
+	if _, ok := shapes[*shape]; !ok {
+		fmt.Println("unknown shape", *shape)
+		return
+	}
+	if *hdr {
+		tm, ok := toneMappers[*toneMapper]
+		if !ok {
+			fmt.Println("unknown tone mapper", *toneMapper)
+			return
+		}
+		encoding = &graphics.Encoding{
+			Exposure:   *exposure,
+			ToneMapper: tm,
+			SRGB:       true,
+		}
+		fg, gc, bc = graphics.LinearColor(fg), graphics.LinearColor(gc), graphics.LinearColor(bc)
+		textureIm = graphics.Linearize(textureIm)
+	}
 
 	m := &graphics.SolidMaterial{
 		Color:         fg,
@@ -91,12 +210,87 @@ func main() {
 		AmbientCoeff_: .01,
 	}
 	_ = bm
-	for i := 0; i < *size; i++ {
-		for j := 0; j < *size; j++ {
-			im.Set(i, j, bg.ToRGBA())
+	var sky graphics.Environment = &graphics.SolidEnvironment{bg}
+	if *envFile != "" && graphics.IsHDR(*envFile) {
+		envFb, err := graphics.OpenHDR(*envFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		sky = graphics.NewHDREquirectEnvironment(envFb)
+	} else if *envFile != "" {
+		f, err := os.Open(*envFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		envIm, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			fmt.Println(err)
+			return
 		}
+		if *hdr {
+			envIm = graphics.Linearize(envIm)
+		}
+		sky = graphics.NewEquirectEnvironment(envIm)
+	} else if *cubeFiles != "" {
+		names := strings.Split(*cubeFiles, ",")
+		if len(names) != 6 {
+			fmt.Println("-cube needs six images, got", len(names))
+			return
+		}
+		var faces [6]image.Image
+		for i, name := range names {
+			f, err := os.Open(name)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			faces[i], _, err = image.Decode(f)
+			f.Close()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if *hdr {
+				faces[i] = graphics.Linearize(faces[i])
+			}
+		}
+		sky = graphics.NewCubeEnvironment(faces)
+	}
+	fb := graphics.NewFramebuffer(*size, *size)
+	fb.DrawBackground(sky)
+	var triangles []*graphics.Triangle
+	switch {
+	case strings.HasSuffix(*inputFile, ".bpt"):
+		patches, err := graphics.OpenBPT(*inputFile, &graphics.SolidMaterial{
+			Color:         fg,
+			SpecColor_:    &graphics.Color{10, 10, 10, 255},
+			SpecCoeff_:    8,
+			AmbientCoeff_: .01,
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		triangles = graphics.TessellatePatches(patches, *tolerance)
+	case *subdiv > 0:
+		if p, err := graphics.OpenObjPolyMesh(*inputFile, fg); err == nil {
+			var creases map[graphics.Edge]bool
+			if *crease > 0 {
+				creases = p.Triangulate().SharpEdges(*crease*math.Pi/180)
+			}
+			triangles = p.Subdivide(*subdiv, creases).Triangles()
+		}
+	case *crease > 0:
+		triangles, _ = graphics.OpenObjSmooth(*inputFile, fg, 1e-6, *crease*math.Pi/180)
+	default:
+		triangles, _ = graphics.OpenObj(*inputFile, fg)
+	}
+	if *fit > 0 && len(triangles) > 0 {
+		triangles = graphics.ApplyTransform(triangles, graphics.NewMesh(triangles).Bounds().Fit(*fit))
 	}
-	triangles, _ := graphics.OpenObj(*inputFile, fg)
 
 	lit1 := &graphics.PointLight{
 		Location: &graphics.Vector3{1.5, -1, -0},
@@ -141,24 +335,157 @@ func main() {
 	t2.N1 = n
 	t2.N2 = n
 
+	var pattern graphics.Pattern
+	dark := graphics.ColorScale(fg, .4)
+	switch *floorStyle {
+	case "plain":
+	case "checker":
+		pattern = graphics.CheckerPattern(fg, dark, 2)
+	case "grid":
+		pattern = &graphics.Mix{&graphics.Uniform{fg}, &graphics.Uniform{dark}, &graphics.Grid{Scale: 2, Width: .05}}
+	case "marble":
+		pattern = graphics.MarblePattern(fg, dark, 1)
+	case "wood":
+		pattern = graphics.WoodPattern(fg, dark, 1)
+	case "cells":
+		pattern = graphics.NewRamp(&graphics.Worley{Scale: 2, Edges: true}, &graphics.RampStop{0, dark}, &graphics.RampStop{.15, fg})
+	default:
+		fmt.Println("unknown floor pattern", *floorStyle)
+		return
+	}
+	if pattern != nil {
+		floor := &graphics.ProceduralMaterial{
+			Pattern:       pattern,
+			SpecColor_:    m.SpecColor_,
+			SpecCoeff_:    m.SpecCoeff_,
+			AmbientCoeff_: m.AmbientCoeff_,
+		}
+		t1.Material, t2.Material = floor, floor
+	}
+
+	if *tile > 0 {
+		floorTex := graphics.NewTexture(textureIm)
+		floorTex.Filter = texFilter
+		floorTex.MaxAnisotropy = *aniso
+		floor := &graphics.TextureMaterial{
+			Texture:       floorTex,
+			UV:            &graphics.UVTransform{Scale: &graphics.Vector2{*tile, *tile}},
+			SpecColor_:    &graphics.Color{50, 50, 50, 255},
+			SpecCoeff_:    8,
+			AmbientCoeff_: .01,
+		}
+		t1.Material, t2.Material = floor, floor
+		t1.UV0, t1.UV1, t1.UV2 = &graphics.Vector2{0, 0}, &graphics.Vector2{1, 0}, &graphics.Vector2{1, 1}
+		t2.UV0, t2.UV1, t2.UV2 = &graphics.Vector2{0, 0}, &graphics.Vector2{1, 1}, &graphics.Vector2{0, 1}
+	}
+
+	// The floor is kept apart from the model, which is all that -lines
+	// draws, and goes in with it once the scene is placed.
+	floor := []*graphics.Triangle{t1, t2}
+	var scene graphics.Shape
 	if *circles {
 		r := .5
-		c1 := graphics.ApplyTransform(graphics.SphereMat(50, gm),graphics.Translate(-r, 0, 0).Mult(graphics.Scale(r)))
-		c2 := graphics.ApplyTransform(graphics.ImgSphere(50, textureIm),graphics.Translate(r, 0, 0).Mult(graphics.Scale(r)))
+		c1 := graphics.ApplyTransform(shapes[*shape](gm),graphics.Translate(-r, 0, 0).Mult(graphics.Scale(r)))
+		if *cut {
+			octant := graphics.ApplyTransform(graphics.Cube(bm), graphics.Translate(0, -r, -r).Mult(graphics.Scale(r)))
+			c1 = graphics.CSGDifference(c1, octant)
+		}
+		if *analytic && *trace {
+			c1 = nil
+			scene = (&graphics.SphereShape{&graphics.Vector3{-r, 0, 0}, r, gm}).Transform(graphics.RotX(math.Pi/8).Mult(graphics.Translate(0, r, 1.5)))
+		}
+		tex := graphics.NewTexture(textureIm)
+		tex.Filter = texFilter
+		tex.MaxAnisotropy = *aniso
+		tex.WrapT = graphics.WrapClamp
+		sphere := graphics.TextureSphere(50, tex)
+		if *normalFile != "" || *bump > 0 {
+			normals := &graphics.NormalMap{BumpScale: *bump}
+			if *normalFile != "" {
+				f, err := os.Open(*normalFile)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				nmIm, _, err := image.Decode(f)
+				f.Close()
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
+				normals.Normal = graphics.NewTexture(nmIm)
+			}
+			if *bump > 0 {
+				normals.Height = tex
+			}
+			for _, tri := range sphere {
+				tri.Material.(*graphics.TextureMaterial).Normals = normals
+			}
+		}
+		c2 := graphics.ApplyTransform(sphere,graphics.Translate(r, 0, 0).Mult(graphics.Scale(r)))
 		mesh := append(c1, c2...)
 		mesh = graphics.ApplyTransform(mesh, graphics.Translate(0, r, 1.5))
-		triangles = append(mesh, t1, t2)
 		asdf := graphics.RotX(math.Pi/8)
-		triangles = graphics.ApplyTransform(triangles, asdf)
+		triangles = graphics.ApplyTransform(mesh, asdf)
+		floor = graphics.ApplyTransform(floor, asdf)
 
-	}else {
-		triangles = append(triangles, t1, t2)
+	}else if *sdf {
+		triangles = nil
+		field := sdfScene(gm, bm)
+		if *trace {
+			scene = &graphics.SDFShape{SDF: field}
+		} else {
+			bounds := &graphics.Bounds{&graphics.Vector3{-1, -.2, 1.4}, &graphics.Vector3{1.2, 1.2, 2.8}}
+			triangles = graphics.MarchingCubesSDF(field, bounds, 120)
+		}
+	}else if *terrain != "" {
+		var h *graphics.Heightfield
+		switch *terrain {
+		case "diamond":
+			h = graphics.DiamondSquare(7, .55, 1)
+		case "fbm":
+			h = graphics.FBMHeightfield(128, 128, &graphics.FBM{Scale: 1.5, Octaves: 6})
+			h.Normalize()
+		default:
+			f, err := os.Open(*terrain)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			elevation, _, err := image.Decode(f)
+			f.Close()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			h = graphics.ImageHeightfield(elevation)
+		}
+		ground := graphics.Terrain(h, *terrainHeight/2, .05, gm)
+		ground = graphics.ApplyTransform(ground, graphics.Translate(0, 1, 3.5).Mult(graphics.Scale(2)))
+		triangles = graphics.ApplyTransform(ground, graphics.RotX(math.Pi/8))
+		floor = graphics.ApplyTransform(floor, graphics.RotX(math.Pi/8))
 	}
+	model := triangles
+	triangles = append(model[:len(model):len(model)], floor...)
 
 
-	if *shadow {
-		_ = lit3
-		graphics.DrawTrianglesParallelShadow(im, triangles, []graphics.Light{lit1, lit2 /*, lit3*/})
+	lights := []graphics.Light{lit1, lit2 /*, lit3*/}
+	_ = lit3
+	if *lightSize > 0 {
+		for i, l := range lights {
+			p := l.(*graphics.PointLight)
+			lights[i] = &graphics.SphereLight{
+				Center:  p.Location,
+				Radius:  *lightSize,
+				R:       p.R,
+				G:       p.G,
+				B:       p.B,
+				Samples: *lightRays,
+			}
+		}
+	}
+	if *aov != "" && !*trace {
+		fb.AOVs = graphics.NewAOVs(*size, *size, lights)
 	}
 	if *trace {
 		source := &graphics.PixelSource{13, im}
@@ -171,13 +498,57 @@ func main() {
 			YMin:-1,
 			YMax: 1,
 			Mesh: triangles,
-			Lights:[]graphics.Light{lit1, lit2},
+			Lights: lights,
+			Environment: sky,
+			Shapes: scene,
 		}
-		writer := &graphics.WriterMapper{im, 0, *size * *size}
+		writer := &graphics.FramebufferWriter{fb, 0, *size * *size}
 		maps.GeneratorSource(source, nil).MapLocalParallel(mapper, *parallel).MapLocal(writer).Sink()
-	}else {
-		graphics.DrawTrianglesParallel(im, triangles, []graphics.Light{lit1, lit2 /*, lit3*/})
+	} else if *linesOnly {
+		fb.DrawBackground(&graphics.SolidEnvironment{graphics.White})
+	} else if *exact {
+		fb.DrawTriangles(triangles, graphics.ShadowShader(triangles, lights))
+	} else if *envFile != "" || *cubeFiles != "" {
+		fb.DrawTriangles(triangles, graphics.IBLShader(lights, graphics.NewIBL(sky, *envLight)))
+	} else if *shadow {
+		opts := *graphics.DefaultShadowOptions
+		opts.Resolution = *shadowRes
+		opts.PCFRadius = *pcf
+		fb.DrawTriangles(triangles, graphics.ShadowMapShader(triangles, lights, &opts))
+	} else {
+		fb.DrawTriangles(triangles, graphics.PhongShader(lights))
 	}
+	if *lines != "" && !*trace {
+		// The floor only hides lines.
+		lineOpts.Occluders = floor
+		fb.DrawLines(model, lineOpts)
+	}
+	if fb.AOVs != nil {
+		if err := fb.AOVs.Save(*aov); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if graphics.IsHDR(*outputFile) {
+		if err := graphics.SaveHDR(*outputFile, fb); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+	im = fb.Image(encoding)
 	f, _ := os.Create(*outputFile)
 	png.Encode(f, im)
 }
+
+// sdfScene is a rounded box with a sphere cut out of it, melting into a
+// torus, beside a row of capsules repeated along X.
+func sdfScene(a, b graphics.Material) graphics.SDF {
+	box := &graphics.SDFBox{&graphics.Vector3{-.4, .6, 2}, &graphics.Vector3{.35, .35, .35}, .05, a}
+	hole := &graphics.SDFSphere{&graphics.Vector3{-.4, .6, 2}, .45, b}
+	torus := graphics.TransformSDF(&graphics.SDFTorus{&graphics.Vector3{}, .3, .08, b}, graphics.Translate(-.4, .15, 2).Mult(graphics.RotX(math.Pi/2)))
+	capsule := &graphics.SDFCapsule{&graphics.Vector3{0, .95, 2.6}, &graphics.Vector3{0, .55, 2.6}, .05, a}
+	row := &graphics.SDFIntersection{
+		&graphics.SDFRepeat{capsule, &graphics.Vector3{.25, 0, 0}},
+		&graphics.SDFBox{&graphics.Vector3{.5, .75, 2.6}, &graphics.Vector3{.45, .25, .1}, 0, a},
+	}
+	return &graphics.SDFUnion{&graphics.SDFSmoothUnion{&graphics.SDFSubtraction{box, hole}, torus, .1}, row}
+}
@@ -27,37 +27,25 @@ func main() {
 	im := image.NewRGBA(image.Rect(0, 0, *size, *size))
 	fg := &graphics.Color{255, 255, 255, 255}
 	bg := &graphics.Color{0, 0, 0, 255}
-	for i := 0; i < *size; i++ {
-		for j := 0; j < *size; j++ {
-			im.Set(i, j, bg.ToRGBA())
-		}
-	}
+	graphics.DrawBackground(im, &graphics.SolidEnvironment{bg})
 	imfile, _ := os.Open("asdf.jpg")
 	defer imfile.Close()
 	textureIm, _ := jpeg.Decode(imfile)
+	tex := graphics.NewTexture(textureIm)
 
 	p1 := &graphics.Vector3{-1, -1, 0}
 	p2 := &graphics.Vector3{1, -1, 0}
 	p3 := &graphics.Vector3{1, 1, 0}
 	p4 := &graphics.Vector3{-1, 1, 0}
 	m := &graphics.TextureMaterial{
-		Im:         textureIm,
-		P1:         &graphics.Vector2{0, 0},
-		P2:         &graphics.Vector2{1, 0},
-		P3:         &graphics.Vector2{1, 1},
-		SpecColor_: fg,
-		SpecCoeff_: 8,
-	}
-	m2 := &graphics.TextureMaterial{
-		Im:         textureIm,
-		P1:         &graphics.Vector2{0, 0},
-		P2:         &graphics.Vector2{0, 1},
-		P3:         &graphics.Vector2{1, 1},
+		Texture:    tex,
 		SpecColor_: fg,
 		SpecCoeff_: 8,
 	}
 	t := graphics.NewTriangle(p1, p2, p3, m)
-	t2 := graphics.NewTriangle(p1, p4, p3, m2)
+	t.UV0, t.UV1, t.UV2 = &graphics.Vector2{0, 0}, &graphics.Vector2{1, 0}, &graphics.Vector2{1, 1}
+	t2 := graphics.NewTriangle(p1, p4, p3, m)
+	t2.UV0, t2.UV1, t2.UV2 = &graphics.Vector2{0, 0}, &graphics.Vector2{0, 1}, &graphics.Vector2{1, 1}
 	triangles := []*graphics.Triangle{t, t2}
 	transform := graphics.Translate(*xt, *yt, *zt).
 		Mult(graphics.RotZ(*zr)).